@@ -0,0 +1,17 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/whisper-project/server.golang/handlers"
+)
+
+func AddRoutes(r *gin.RouterGroup) {
+	r.GET("/metrics", handlers.GetServerMetricsHandler)
+	r.GET("/handoffs", handlers.GetPendingHandoffsHandler)
+}
@@ -19,8 +19,21 @@ func AddRoutes(r *gin.RouterGroup) {
 	r.GET("/whisper-conversations", handlers.GetProfileWhisperConversationsHandler)
 	r.POST("/whisper-conversations", handlers.PostProfileWhisperConversationHandler)
 	r.GET("/whisper-conversations/:name", handlers.GetProfileWhisperConversationIdHandler)
+	r.PATCH("/whisper-conversations/:name", handlers.PatchProfileWhisperConversationHandler)
 	r.DELETE("/whisper-conversations/:name", handlers.DeleteProfileWhisperConversationHandler)
 	r.GET("/whisper-start/:conversationId", handlers.StartWhisperSessionHandler)
 	r.GET("/listen-start/:conversationId", handlers.StartListenSessionHandler)
 	r.GET("/authenticate-conversation/:conversationId", handlers.GetClientSessionTokenHandler)
+	r.GET("/whisper-requests/:conversationId", handlers.GetSessionRequestersHandler)
+	r.POST("/whisper-requests/:conversationId/:clientId/approve", handlers.PostApproveListenerHandler)
+	r.POST("/whisper-requests/:conversationId/:clientId/deny", handlers.PostDenyListenerHandler)
+	r.DELETE("/whisper-listeners/:conversationId/:clientId", handlers.DeleteSessionListenerHandler)
+	r.PUT("/whisper-roles/:conversationId/:clientId", handlers.PutSessionRoleHandler)
+	r.POST("/whisper-handoff/:conversationId/:clientId", handlers.PostWhispererHandoffHandler)
+	r.GET("/whisper-transcription/:conversationId", handlers.GetSessionTranscriptionHandler)
+	r.POST("/whisper-transcription/:conversationId/start", handlers.PostStartTranscriptionHandler)
+	r.POST("/whisper-transcription/:conversationId/stop", handlers.PostStopTranscriptionHandler)
+	r.GET("/whisper-bans/:conversationId", handlers.GetConversationBansHandler)
+	r.PUT("/whisper-bans/:conversationId/:profileId", handlers.PutConversationBanHandler)
+	r.DELETE("/whisper-bans/:conversationId/:profileId", handlers.DeleteConversationBanHandler)
 }
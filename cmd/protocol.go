@@ -0,0 +1,58 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+// protocolCmd represents the protocol command
+var protocolCmd = &cobra.Command{
+	Use:   "protocol",
+	Short: "Generate protocol bindings and conformance vectors",
+	Long: `Generate the TypeScript protocol bindings used by the web apps,
+and the JSON conformance vectors that all clients test against,
+from the server's protocol definitions. Run it from the repository root.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		log.SetFlags(0)
+		tsPaths, _ := cmd.Flags().GetStringSlice("ts")
+		vectorsPath, _ := cmd.Flags().GetString("vectors")
+		for _, path := range tsPaths {
+			generate(path, protocol.WriteTypeScript)
+		}
+		if vectorsPath != "" {
+			generate(vectorsPath, protocol.WriteVectors)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(protocolCmd)
+	protocolCmd.Args = cobra.NoArgs
+	protocolCmd.Flags().StringSlice("ts",
+		[]string{"listen.js/src/protocol.gen.ts", "saywhat.js/src/protocol.gen.ts"},
+		"paths for the TypeScript bindings")
+	protocolCmd.Flags().String("vectors", "protocol/testdata/vectors.json", "path for the conformance vectors")
+}
+
+func generate(path string, write func(io.Writer) error) {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		panic(err)
+	}
+	log.Printf("Wrote %s.", path)
+}
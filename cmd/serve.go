@@ -9,13 +9,18 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/spf13/cobra"
 
+	"github.com/whisper-project/server.golang/api/admin"
 	"github.com/whisper-project/server.golang/api/console"
 	"github.com/whisper-project/server.golang/api/saywhat"
+	"github.com/whisper-project/server.golang/api/webhooks"
+	"github.com/whisper-project/server.golang/handlers"
 	"github.com/whisper-project/server.golang/lifecycle"
 	"github.com/whisper-project/server.golang/platform"
+	"github.com/whisper-project/server.golang/storage"
 )
 
 // serveCmd represents the serve command
@@ -33,6 +38,20 @@ var serveCmd = &cobra.Command{
 			panic(fmt.Sprintf("Can't load configuration: %v", err))
 		}
 		defer platform.PopConfig()
+		lifecycle.SetContentLimits(contentLimitFlags(cmd))
+		lifecycle.SetIdlePolicy(idlePolicyFlags(cmd))
+		webhookPresence, _ := cmd.Flags().GetBool("webhook-presence")
+		lifecycle.UseWebhookPresence(webhookPresence)
+		observers, _ := cmd.Flags().GetStringSlice("observer")
+		if err := lifecycle.UseObservers(observers...); err != nil {
+			panic(fmt.Sprintf("Can't enable session observers: %v", err))
+		}
+		storage.ServerUrl, _ = cmd.Flags().GetString("advertise-url")
+		if storage.ServerUrl == "" {
+			storage.ServerUrl = fmt.Sprintf("http://%s:%s", address, port)
+		}
+		redirectToOwner, _ := cmd.Flags().GetBool("redirect-to-owner")
+		handlers.UseOwnerRedirects(redirectToOwner)
 		serve(address, port)
 	},
 }
@@ -43,6 +62,47 @@ func init() {
 	serveCmd.Flags().StringP("env", "e", "development", "The environment to run in")
 	serveCmd.Flags().StringP("address", "a", "127.0.0.1", "The IP address to listen on")
 	serveCmd.Flags().StringP("port", "p", "8080", "The port to listen on")
+	serveCmd.Flags().Bool("webhook-presence", false, "Track session presence from Ably webhooks")
+	serveCmd.Flags().String("advertise-url", "", "The URL other server instances reach this one at (default http://address:port)")
+	serveCmd.Flags().Bool("redirect-to-owner", false, "Redirect requests for sessions owned by other instances, instead of proxying them")
+	serveCmd.Flags().StringSlice("observer", nil,
+		fmt.Sprintf("Session observers to enable (registered: %s)", strings.Join(lifecycle.ObserverNames(), ", ")))
+	d := lifecycle.DefaultContentLimits
+	serveCmd.Flags().Int("client-chunk-rate", d.ClientChunksPerSecond, "Max content chunks/sec from a client")
+	serveCmd.Flags().Int("client-byte-rate", d.ClientBytesPerSecond, "Max content bytes/sec from a client")
+	serveCmd.Flags().Int("client-line-rate", d.ClientPastLinesPerMinute, "Max past lines/min from a client")
+	serveCmd.Flags().Int("session-chunk-rate", d.SessionChunksPerSecond, "Max content chunks/sec in a session")
+	serveCmd.Flags().Int("session-byte-rate", d.SessionBytesPerSecond, "Max content bytes/sec in a session")
+	serveCmd.Flags().Int("session-line-rate", d.SessionPastLinesPerMinute, "Max past lines/min in a session")
+	serveCmd.Flags().Int("warnings-before-mute", d.WarningsBeforeMute, "Content limit warnings before a client is muted")
+	serveCmd.Flags().Duration("mute-duration", d.MuteDuration, "How long a client that floods content is muted")
+	i := lifecycle.DefaultIdlePolicy
+	serveCmd.Flags().Duration("whisperer-absence", i.WhispererAbsence, "End sessions with no whisperer online this long")
+	serveCmd.Flags().Duration("content-idle", i.ContentIdle, "End sessions with no content this long")
+	serveCmd.Flags().Duration("max-session-length", i.MaxLength, "End sessions that last this long")
+	serveCmd.Flags().Duration("idle-warning", i.Warning, "Warn participants this long before ending an idle session")
+}
+
+func contentLimitFlags(cmd *cobra.Command) lifecycle.ContentLimits {
+	var l lifecycle.ContentLimits
+	l.ClientChunksPerSecond, _ = cmd.Flags().GetInt("client-chunk-rate")
+	l.ClientBytesPerSecond, _ = cmd.Flags().GetInt("client-byte-rate")
+	l.ClientPastLinesPerMinute, _ = cmd.Flags().GetInt("client-line-rate")
+	l.SessionChunksPerSecond, _ = cmd.Flags().GetInt("session-chunk-rate")
+	l.SessionBytesPerSecond, _ = cmd.Flags().GetInt("session-byte-rate")
+	l.SessionPastLinesPerMinute, _ = cmd.Flags().GetInt("session-line-rate")
+	l.WarningsBeforeMute, _ = cmd.Flags().GetInt("warnings-before-mute")
+	l.MuteDuration, _ = cmd.Flags().GetDuration("mute-duration")
+	return l
+}
+
+func idlePolicyFlags(cmd *cobra.Command) lifecycle.IdlePolicy {
+	var p lifecycle.IdlePolicy
+	p.WhispererAbsence, _ = cmd.Flags().GetDuration("whisperer-absence")
+	p.ContentIdle, _ = cmd.Flags().GetDuration("content-idle")
+	p.MaxLength, _ = cmd.Flags().GetDuration("max-session-length")
+	p.Warning, _ = cmd.Flags().GetDuration("idle-warning")
+	return p
 }
 
 func serve(address, port string) {
@@ -55,5 +115,9 @@ func serve(address, port string) {
 	saywhat.AddRoutes(sayWhat)
 	consoleClient := r.Group("/api/console/v0")
 	console.AddRoutes(consoleClient)
+	adminClient := r.Group("/api/admin/v0")
+	admin.AddRoutes(adminClient)
+	webhookClient := r.Group("/api/webhooks/v0")
+	webhooks.AddRoutes(webhookClient)
 	lifecycle.Startup(r, fmt.Sprintf("%s:%s", address, port))
 }
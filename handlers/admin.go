@@ -0,0 +1,57 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/lifecycle"
+	"github.com/whisper-project/server.golang/middleware"
+	"github.com/whisper-project/server.golang/platform"
+	"github.com/whisper-project/server.golang/pubsub"
+)
+
+// AuthenticateAdmin checks that the request carries the operator token
+// from the server configuration. If there is no configured token, all
+// admin requests are refused.
+func AuthenticateAdmin(c *gin.Context) bool {
+	expected := platform.GetConfig().AdminToken
+	actual := c.GetHeader("X-Admin-Token")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		middleware.CtxLog(c).Info("invalid admin token", zap.Bool("present", actual != ""))
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid admin token"})
+		return false
+	}
+	return true
+}
+
+func GetServerMetricsHandler(c *gin.Context) {
+	if !AuthenticateAdmin(c) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"contentLimits": lifecycle.CurrentContentLimitMetrics(),
+		"presence":      pubsub.CurrentPresenceMetrics(),
+	})
+}
+
+func GetPendingHandoffsHandler(c *gin.Context) {
+	if !AuthenticateAdmin(c) {
+		return
+	}
+	handoffs, err := lifecycle.PendingHandoffs()
+	if err != nil {
+		middleware.CtxLog(c).Error("pending handoffs failure", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, handoffs)
+}
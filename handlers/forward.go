@@ -0,0 +1,66 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/lifecycle"
+	"github.com/whisper-project/server.golang/middleware"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+// forwardedHeader marks requests proxied from another server instance.
+const forwardedHeader = "X-Whisper-Forwarded-By"
+
+var redirectToOwner = false
+
+// UseOwnerRedirects makes session requests for sessions owned by another
+// server instance get a redirect to the owner, instead of being proxied there.
+func UseOwnerRedirects(on bool) {
+	redirectToOwner = on
+}
+
+// forwardToOwner handles a session request that failed because another
+// server instance owns the session, by proxying the request to the owner
+// or redirecting the client there. It returns whether the error was handled.
+func forwardToOwner(c *gin.Context, err error) bool {
+	var owned lifecycle.OwnedElsewhereError
+	if !errors.As(err, &owned) {
+		return false
+	}
+	l := owned.Lease
+	target, perr := url.Parse(l.OwnerUrl)
+	if l.IsOwnedHere() || l.OwnerUrl == "" || perr != nil || c.GetHeader(forwardedHeader) != "" {
+		// ownership is changing hands, so the client should try again shortly
+		middleware.CtxLog(c).Info("session owner unreachable",
+			zap.String("sessionId", l.SessionId), zap.String("owner", l.Owner),
+			zap.String("ownerUrl", l.OwnerUrl), zap.String("forwardedBy", c.GetHeader(forwardedHeader)))
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "session is moving between servers"})
+		return true
+	}
+	if redirectToOwner {
+		location := target.JoinPath(c.Request.URL.Path)
+		location.RawQuery = c.Request.URL.RawQuery
+		c.Redirect(http.StatusTemporaryRedirect, location.String())
+		return true
+	}
+	middleware.CtxLog(c).Info("proxying session request to owner",
+		zap.String("sessionId", l.SessionId), zap.String("owner", l.Owner), zap.String("ownerUrl", l.OwnerUrl))
+	c.Request.Header.Set(forwardedHeader, storage.ServerId)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Abort()
+	return true
+}
@@ -165,3 +165,62 @@ func DeleteProfileWhisperConversationHandler(c *gin.Context) {
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// ConversationSettings are the per-conversation options a whisperer can change.
+// Omitted settings are left as they are.
+type ConversationSettings struct {
+	Encrypted   *bool `json:"encrypted"`
+	Transcribed *bool `json:"transcribed"`
+}
+
+func PatchProfileWhisperConversationHandler(c *gin.Context) {
+	var settings ConversationSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		middleware.CtxLog(c).Info("Can't bind conversation settings", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "Invalid request format"})
+		return
+	}
+	if AuthenticateRequest(c) == nil {
+		return
+	}
+	profileId := c.GetHeader("X-Profile-Id")
+	name := c.Param("name")
+	conversationId, err := storage.WhisperConversation(profileId, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if conversationId == "" {
+		middleware.CtxLog(c).Info("whisper conversation not found",
+			zap.String("profileId", profileId), zap.String("name", name))
+		c.JSON(http.StatusNotFound,
+			gin.H{"status": "error", "error": fmt.Sprintf("whisper conversation %q not found", name)})
+		return
+	}
+	conversation, err := storage.GetConversation(conversationId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	if conversation == nil {
+		middleware.CtxLog(c).Error("whisper conversation has no data",
+			zap.String("profileId", profileId), zap.String("conversationId", conversationId))
+		c.JSON(http.StatusNotFound,
+			gin.H{"status": "error", "error": fmt.Sprintf("whisper conversation %q not found", name)})
+		return
+	}
+	if settings.Encrypted != nil {
+		conversation.Encrypted = *settings.Encrypted
+	}
+	if settings.Transcribed != nil {
+		conversation.Transcribed = *settings.Transcribed
+	}
+	if err := storage.SaveConversation(conversation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "error": err.Error()})
+		return
+	}
+	middleware.CtxLog(c).Info("Patched whisper conversation settings",
+		zap.String("profileId", profileId), zap.String("conversationId", conversationId),
+		zap.Any("settings", settings))
+	c.Status(http.StatusNoContent)
+}
@@ -7,10 +7,17 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
 	"github.com/whisper-project/server.golang/lifecycle"
+	"github.com/whisper-project/server.golang/middleware"
+	"github.com/whisper-project/server.golang/protocol"
 	"github.com/whisper-project/server.golang/storage"
 )
 
@@ -28,8 +35,12 @@ func StartWhisperSessionHandler(c *gin.Context) {
 	}
 	if !isOwned {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conversation id"})
+		return
 	}
 	s, err := lifecycle.GetSession(conversationId)
+	if forwardToOwner(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -38,7 +49,8 @@ func StartWhisperSessionHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	unit := s.NegotiateOffsetUnit(clientId, c.GetHeader("X-Offset-Unit"))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "offsetUnit": unit})
 }
 
 func StartListenSessionHandler(c *gin.Context) {
@@ -48,12 +60,24 @@ func StartListenSessionHandler(c *gin.Context) {
 	}
 	clientId := c.GetHeader("X-Client-Id")
 	conversationId := c.Param("conversationId")
+	isBanned, err := storage.IsBannedProfile(p.Id, conversationId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if isBanned {
+		c.JSON(http.StatusForbidden, gin.H{"error": lifecycle.BannedError.Error()})
+		return
+	}
 	isAllowed, err := storage.IsAllowedListener(p.Id, conversationId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	s, err := lifecycle.GetSession(conversationId)
+	if forwardToOwner(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -67,6 +91,10 @@ func StartListenSessionHandler(c *gin.Context) {
 		return
 	}
 	if err = s.AddListenerRequest(clientId, p.Id, p.Name); err != nil {
+		if errors.Is(err, lifecycle.BannedError) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -81,7 +109,10 @@ func GetClientSessionTokenHandler(c *gin.Context) {
 	}
 	clientId := c.GetHeader("X-Client-Id")
 	conversationId := c.Param("conversationId")
-	s, err := lifecycle.AuthenticateParticipant(conversationId, clientId)
+	s, key, err := lifecycle.AuthenticateParticipant(conversationId, clientId)
+	if forwardToOwner(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -90,5 +121,304 @@ func GetClientSessionTokenHandler(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Not a participant in this conversation"})
 		return
 	}
+	if key != nil {
+		// the session content is encrypted, so the client needs the key
+		c.Header("X-Content-Key", base64.StdEncoding.EncodeToString(key))
+	}
 	c.JSON(http.StatusOK, s)
 }
+
+// whisperSession authenticates a request from the whisperer of a conversation
+// and returns the conversation's running session. If there's no such session
+// here, it responds to the request itself and returns nil.
+func whisperSession(c *gin.Context) *lifecycle.Session {
+	if !isWhisperer(c) {
+		return nil
+	}
+	s, err := lifecycle.FindSession(c.Param("conversationId"))
+	if forwardToOwner(c, err) {
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if s == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no session in progress"})
+		return nil
+	}
+	return s
+}
+
+// isWhisperer authenticates a request from the whisperer of a conversation.
+// If it isn't one, it responds to the request itself.
+func isWhisperer(c *gin.Context) bool {
+	p := AuthenticateRequest(c)
+	if p == nil {
+		return false
+	}
+	isOwned, err := storage.IsOwnedConversation(p.Id, c.Param("conversationId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !isOwned {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conversation id"})
+		return false
+	}
+	return true
+}
+
+// waitlistError responds to a failed change to the session's participants.
+func waitlistError(c *gin.Context, err error) {
+	if errors.Is(err, lifecycle.NotPresentError) || errors.Is(err, lifecycle.EndedError) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, lifecycle.WhispererError) || errors.Is(err, lifecycle.LastWhispererError) ||
+		errors.Is(err, lifecycle.NotWhispererError) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func GetSessionRequestersHandler(c *gin.Context) {
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "requesters": s.Requesters()})
+}
+
+// ListenerApproval is the optional body of an approval. If Remember is set,
+// the listener's profile is allowed to listen to future sessions without asking.
+type ListenerApproval struct {
+	Remember bool `json:"remember"`
+}
+
+func PostApproveListenerHandler(c *gin.Context) {
+	// the body is read only once the session is known to run here,
+	// so a request forwarded to the owner still has it.
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	var approval ListenerApproval
+	if err := c.ShouldBindJSON(&approval); err != nil && !errors.Is(err, io.EOF) {
+		middleware.CtxLog(c).Info("Can't bind listener approval", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "Invalid request format"})
+		return
+	}
+	listener, err := s.ApproveListener(c.Param("clientId"))
+	if err != nil {
+		waitlistError(c, err)
+		return
+	}
+	if approval.Remember {
+		if err = storage.MakeAllowedListener(listener.ProfileId, s.Id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	middleware.CtxLog(c).Info("approved listener",
+		zap.String("sessionId", s.Id), zap.String("clientId", listener.ClientId),
+		zap.String("profileId", listener.ProfileId), zap.Bool("remember", approval.Remember))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "listener": listener})
+}
+
+func PostDenyListenerHandler(c *gin.Context) {
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	clientId := c.Param("clientId")
+	if err := s.DenyListener(clientId); err != nil {
+		waitlistError(c, err)
+		return
+	}
+	middleware.CtxLog(c).Info("denied listener", zap.String("sessionId", s.Id), zap.String("clientId", clientId))
+	c.Status(http.StatusNoContent)
+}
+
+func DeleteSessionListenerHandler(c *gin.Context) {
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	clientId := c.Param("clientId")
+	if err := s.RemoveListener(clientId); err != nil {
+		waitlistError(c, err)
+		return
+	}
+	middleware.CtxLog(c).Info("removed listener", zap.String("sessionId", s.Id), zap.String("clientId", clientId))
+	c.Status(http.StatusNoContent)
+}
+
+// ParticipantRole is the body of a role change: either "whisperer" or "listener".
+type ParticipantRole struct {
+	Role string `json:"role"`
+}
+
+// PutSessionRoleHandler makes a participant a whisperer or a listener.
+func PutSessionRoleHandler(c *gin.Context) {
+	// as with approvals, the body is left for the owner if the request is forwarded
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	var body ParticipantRole
+	if err := c.ShouldBindJSON(&body); err != nil ||
+		(body.Role != protocol.RoleWhisperer && body.Role != protocol.RoleListener) {
+		middleware.CtxLog(c).Info("Can't bind participant role", zap.Any("role", body), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"status": "error", "error": "Invalid request format"})
+		return
+	}
+	clientId := c.Param("clientId")
+	if err := s.SetRole(clientId, body.Role == protocol.RoleWhisperer); err != nil {
+		waitlistError(c, err)
+		return
+	}
+	middleware.CtxLog(c).Info("changed participant role",
+		zap.String("sessionId", s.Id), zap.String("clientId", clientId), zap.String("role", body.Role))
+	c.Status(http.StatusNoContent)
+}
+
+// PostWhispererHandoffHandler passes the whisperer role from the
+// requesting client to the given participant.
+func PostWhispererHandoffHandler(c *gin.Context) {
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	fromClientId, toClientId := c.GetHeader("X-Client-Id"), c.Param("clientId")
+	if err := s.HandOff(fromClientId, toClientId); err != nil {
+		waitlistError(c, err)
+		return
+	}
+	middleware.CtxLog(c).Info("handed off whisperer role",
+		zap.String("sessionId", s.Id), zap.String("from", fromClientId), zap.String("to", toClientId))
+	c.Status(http.StatusNoContent)
+}
+
+func GetSessionTranscriptionHandler(c *gin.Context) {
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	transcriptId, err := s.TranscriptionStatus()
+	if err != nil {
+		transcriptionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "recording": transcriptId != "", "transcriptId": transcriptId})
+}
+
+func PostStartTranscriptionHandler(c *gin.Context) {
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	transcriptId, err := s.StartTranscription()
+	if err != nil {
+		transcriptionError(c, err)
+		return
+	}
+	middleware.CtxLog(c).Info("started transcription",
+		zap.String("sessionId", s.Id), zap.String("transcriptId", transcriptId))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "recording": true, "transcriptId": transcriptId})
+}
+
+func PostStopTranscriptionHandler(c *gin.Context) {
+	s := whisperSession(c)
+	if s == nil {
+		return
+	}
+	transcriptId, err := s.StopTranscription()
+	if err != nil {
+		transcriptionError(c, err)
+		return
+	}
+	middleware.CtxLog(c).Info("stopped transcription",
+		zap.String("sessionId", s.Id), zap.String("transcriptId", transcriptId))
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "recording": false, "transcriptId": transcriptId})
+}
+
+// transcriptionError responds to a failed change to the session's transcription.
+func transcriptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, lifecycle.EndedError):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.EncryptedError), errors.Is(err, lifecycle.NotTranscribingError):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.TranscriptLeaseError):
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func GetConversationBansHandler(c *gin.Context) {
+	if !isWhisperer(c) {
+		return
+	}
+	profiles, err := storage.GetBannedProfiles(c.Param("conversationId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "banned": profiles})
+}
+
+// PutConversationBanHandler bans a profile from the conversation. If the
+// conversation has a session running, the profile's clients are removed from it.
+func PutConversationBanHandler(c *gin.Context) {
+	if !isWhisperer(c) {
+		return
+	}
+	conversationId, profileId := c.Param("conversationId"), c.Param("profileId")
+	s, err := lifecycle.FindSession(conversationId)
+	if forwardToOwner(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err = storage.BanProfile(profileId, conversationId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if s != nil {
+		s.BanProfile(profileId)
+	}
+	middleware.CtxLog(c).Info("banned profile",
+		zap.String("conversationId", conversationId), zap.String("profileId", profileId))
+	c.Status(http.StatusNoContent)
+}
+
+func DeleteConversationBanHandler(c *gin.Context) {
+	if !isWhisperer(c) {
+		return
+	}
+	conversationId, profileId := c.Param("conversationId"), c.Param("profileId")
+	s, err := lifecycle.FindSession(conversationId)
+	if forwardToOwner(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err = storage.UnbanProfile(profileId, conversationId); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if s != nil {
+		s.UnbanProfile(profileId)
+	}
+	middleware.CtxLog(c).Info("unbanned profile",
+		zap.String("conversationId", conversationId), zap.String("profileId", profileId))
+	c.Status(http.StatusNoContent)
+}
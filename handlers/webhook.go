@@ -0,0 +1,53 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/lifecycle"
+	"github.com/whisper-project/server.golang/middleware"
+	"github.com/whisper-project/server.golang/platform"
+	"github.com/whisper-project/server.golang/pubsub"
+)
+
+// maxWebhookBody bounds how much of a webhook request we will read.
+const maxWebhookBody = 1 << 20
+
+func PostAblyWebhookHandler(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		middleware.CtxLog(c).Info("can't read webhook body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	keyName, signature := c.GetHeader("X-Ably-Key"), c.GetHeader("X-Ably-Signature")
+	if keyName == "" || signature == "" {
+		middleware.CtxLog(c).Info("unsigned webhook request")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing signature"})
+		return
+	}
+	if err := pubsub.VerifyWebhookSignature(platform.GetConfig().AblyPublishKey, body, keyName, signature); err != nil {
+		middleware.CtxLog(c).Info("invalid webhook signature", zap.String("keyName", keyName), zap.Error(err))
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid signature"})
+		return
+	}
+	batch, err := pubsub.ParseWebhookBatch(body)
+	if err != nil {
+		middleware.CtxLog(c).Info("invalid webhook body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	applied := lifecycle.ApplyPubsubWebhook(batch)
+	middleware.CtxLog(c).Debug("applied webhook batch",
+		zap.Int("items", len(batch.Items)), zap.Int("applied", applied))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+const (
+	// catchUpLines is how many lines of past text a catch-up includes.
+	catchUpLines = 50
+	// catchUpPartBytes is how much text goes in each catch-up packet,
+	// which keeps it well under the pubsub message size limit.
+	catchUpPartBytes = 16 * 1024
+)
+
+// sendCatchUp sends a listener the recent past text and the current live
+// text, so it doesn't have to wait for the whisperer to type. Clients that
+// don't understand catch-up packets get nothing, as do clients of encrypted
+// sessions, because the server doesn't have their text.
+//
+// Clients that know about co-whisperers get the live text of each whisperer
+// in separate packets after the catch-up, split the same way as the catch-up.
+// Other clients only get the live text of the whisperer who most recently typed.
+func (s *Session) sendCatchUp(clientId string) {
+	if s.state.Encrypted || !s.supports(clientId, protocol.FeatureCatchUp) {
+		return
+	}
+	lines := s.state.PastText[max(0, len(s.state.PastText)-catchUpLines):]
+	past := make([]string, len(lines))
+	for i, line := range lines {
+		past[i] = line.Text
+	}
+	coWhisperers := s.supports(clientId, protocol.FeatureCoWhisperers)
+	live := ""
+	if !coWhisperers {
+		live = s.latestLive()
+	}
+	packets := protocol.CatchUpPackets(uuid.NewString(), past, live, catchUpPartBytes)
+	if coWhisperers {
+		for _, whispererId := range s.liveClients() {
+			if text := s.live[whispererId].text; text != "" {
+				packets = append(packets, protocol.WhispererLivePackets(uuid.NewString(), whispererId, text, catchUpPartBytes)...)
+			}
+		}
+	}
+	sLog().Info("catching up client",
+		zap.String("sessionId", s.Id), zap.String("clientId", clientId),
+		zap.Int("lines", len(past)), zap.Int("packets", len(packets)))
+	for _, packet := range packets {
+		s.sendControl(clientId, packet)
+	}
+}
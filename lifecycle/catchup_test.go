@@ -0,0 +1,88 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/pubsub"
+)
+
+// receivedCatchUp reassembles the catch-up packets sent to a client.
+func receivedCatchUp(t *testing.T, packets []string) ([]string, string) {
+	t.Helper()
+	var parts []protocol.CatchUp
+	for _, packet := range packets {
+		if m, err := protocol.ParseControl(packet); err == nil {
+			if part, ok := m.(protocol.CatchUp); ok {
+				parts = append(parts, part)
+			}
+		}
+	}
+	past, live, err := protocol.AssembleCatchUp(parts)
+	if err != nil {
+		t.Fatalf("catch-up didn't assemble: %v", err)
+	}
+	return past, live
+}
+
+func TestCatchUpLateJoiner(t *testing.T) {
+	s, ps := newTestSession(t, "test-catch-up")
+	addTestParticipant(s, "w", true)
+	addTestParticipant(s, "l", false, protocol.FeatureCatchUp)
+	addTestParticipant(s, "legacy", false)
+	var expected []string
+	for i := range catchUpLines + 5 {
+		line := fmt.Sprintf("line %d: %s", i, strings.Repeat("x", 1000))
+		sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: line}, protocol.ContentChunk{Offset: protocol.CoNewline})
+		expected = append(expected, line)
+	}
+	sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "still typing"})
+	expected = expected[len(expected)-catchUpLines:]
+
+	s.applyStatus(pubsub.ClientStatus{ClientId: "l", IsOnline: true})
+	if len(ps.sent["l"]) < 2 {
+		t.Fatalf("expected a catch-up in several packets, got %d", len(ps.sent["l"]))
+	}
+	past, live := receivedCatchUp(t, ps.sent["l"])
+	if !slices.Equal(past, expected) {
+		t.Errorf("caught up with %d past lines, want the last %d", len(past), len(expected))
+	}
+	if live != "still typing" {
+		t.Errorf("caught up with live text %q, want %q", live, "still typing")
+	}
+
+	s.applyStatus(pubsub.ClientStatus{ClientId: "legacy", IsOnline: true})
+	if len(ps.sent["legacy"]) != 0 {
+		t.Errorf("legacy client was sent %v", ps.sent["legacy"])
+	}
+}
+
+func TestCatchUpRequest(t *testing.T) {
+	s, ps := newTestSession(t, "test-catch-up-request")
+	addTestParticipant(s, "w", true)
+	addTestParticipant(s, "l", false, protocol.FeatureCatchUp).IsOnline = true
+	sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "live"})
+
+	// a status that doesn't bring the listener online doesn't catch it up
+	s.applyStatus(pubsub.ClientStatus{ClientId: "l", IsOnline: true})
+	if len(ps.sent["l"]) != 0 {
+		t.Fatalf("listener already online was caught up: %v", ps.sent["l"])
+	}
+	s.applyStatus(pubsub.ClientStatus{ClientId: "l", IsOnline: true, Control: protocol.RequestCatchUpPacket()})
+	if past, live := receivedCatchUp(t, ps.sent["l"]); len(past) != 0 || live != "live" {
+		t.Errorf("requested catch-up was %q, %q", past, live)
+	}
+	s.applyStatus(pubsub.ClientStatus{ClientId: "w", IsOnline: true, Control: protocol.RequestCatchUpPacket()})
+	if slices.ContainsFunc(ps.sent["w"], func(p string) bool { return strings.HasPrefix(p, "catch-up|") }) {
+		t.Errorf("whisperer was caught up")
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/storage"
+)
+
+var (
+	handoffClaimTTL     = time.Minute     // how long a server has to resume a claimed session
+	handoffPollInterval = 5 * time.Second // how often to look for handoffs when there are none
+	maxHandoffAttempts  = int64(3)        // how many times to try resuming a session
+)
+
+// ResumeHandoffs resumes sessions suspended by other server instances.
+// It's meant to be invoked as a goroutine, and keeps looking for handoffs
+// until the context is cancelled. Claims abandoned by instances that
+// crashed while resuming are requeued as they expire, and sessions
+// suspended by instances of earlier versions are moved into the queue.
+func ResumeHandoffs(ctx context.Context) {
+	for {
+		if moved, err := storage.MigrateLegacyHandoffs(); err != nil {
+			sLog().Error("migrate legacy handoffs failure", zap.Error(err))
+		} else if moved > 0 {
+			sLog().Info("migrated legacy handoffs", zap.Int64("count", moved))
+		}
+		if requeued, dead, err := storage.RequeueExpiredHandoffs(maxHandoffAttempts); err != nil {
+			sLog().Error("requeue expired handoffs failure", zap.Error(err))
+		} else if requeued > 0 || dead > 0 {
+			sLog().Warn("expired handoff claims",
+				zap.Int64("requeued", requeued), zap.Int64("deadLettered", dead))
+		}
+		claim, ok, err := storage.ClaimHandoff(handoffClaimTTL)
+		if err != nil {
+			sLog().Error("claim handoff failure", zap.Error(err))
+		} else if ok {
+			resumeHandoff(claim)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(handoffPollInterval):
+		}
+	}
+}
+
+// resumeHandoff resumes a claimed session, and acknowledges the claim if
+// the session is running, whether here or on another server instance.
+func resumeHandoff(claim storage.HandoffClaim) {
+	id := claim.Element
+	_, err := GetSession(id)
+	var owned OwnedElsewhereError
+	if err != nil && !(errors.As(err, &owned) && !owned.Lease.IsOwnedHere()) {
+		sLog().Error("resume session failure",
+			zap.String("sessionId", id), zap.Int64("attempt", claim.Attempts), zap.Error(err))
+		dead, err := storage.FailHandoff(claim, maxHandoffAttempts)
+		if err != nil {
+			sLog().Error("fail handoff failure", zap.String("sessionId", id), zap.Error(err))
+		} else if dead {
+			sLog().Error("giving up on resuming session", zap.String("sessionId", id))
+		}
+		return
+	}
+	ok, err := storage.AckHandoff(claim)
+	if err != nil {
+		sLog().Error("ack handoff failure", zap.String("sessionId", id), zap.Error(err))
+	} else if !ok {
+		// the claim expired while resuming, but the lease keeps the session from running twice
+		sLog().Warn("handoff claim expired before ack", zap.String("sessionId", id))
+	} else {
+		sLog().Info("resumed session", zap.String("sessionId", id))
+	}
+}
+
+// PendingHandoffs returns the session handoffs that are waiting to be
+// resumed, being resumed, or were given up on.
+func PendingHandoffs() (*storage.Handoffs, error) {
+	return storage.PendingHandoffs()
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+// capabilities returns what the given client negotiated in its handshake.
+// Clients that never announced themselves speak the legacy protocol.
+func (s *Session) capabilities(clientId string) protocol.Capabilities {
+	if p, ok := s.state.Participants[clientId]; ok && p.Version > 0 {
+		return protocol.Capabilities{Version: p.Version, Features: p.Features}
+	}
+	return protocol.LegacyCapabilities
+}
+
+// supports checks whether a protocol feature can be used with the given client.
+func (s *Session) supports(clientId, feature string) bool {
+	return s.capabilities(clientId).Has(feature)
+}
+
+// requiredFeatures lists the features a client must have to take part in the session.
+func (s *Session) requiredFeatures() []string {
+	if s.state.Encrypted {
+		return []string{protocol.FeatureEncryption}
+	}
+	return nil
+}
+
+// handshake answers a client's hello packet. It records the capabilities
+// the server and the client have in common, and welcomes the client.
+// If the client can't take part in the session, it is told why and
+// removed, and the handshake returns false.
+func (s *Session) handshake(p *storage.Participant, hello string) bool {
+	_, announced := protocol.IsHelloPacket(hello)
+	if !s.admit(p, announced) {
+		return false
+	}
+	negotiated := announced.Negotiate()
+	p.Version, p.Features = negotiated.Version, negotiated.Features
+	// a client says hello when it (re)starts, and then numbers its chunks from 1
+	delete(s.sequences, p.ClientId)
+	sLog().Info("client handshake",
+		zap.String("sessionId", s.Id), zap.String("clientId", p.ClientId),
+		zap.Int("version", p.Version), zap.Strings("features", p.Features))
+	s.sendControl(p.ClientId, protocol.WelcomePacket(negotiated))
+	return true
+}
+
+// admit checks whether a client with the given capabilities can take part
+// in the session. If it can't, it is told why and removed.
+func (s *Session) admit(p *storage.Participant, announced protocol.Capabilities) bool {
+	missing := announced.Missing(s.requiredFeatures()...)
+	if announced.Version >= protocol.MinProtocolVersion && len(missing) == 0 {
+		return true
+	}
+	sLog().Info("refusing incompatible client",
+		zap.String("sessionId", s.Id), zap.String("clientId", p.ClientId),
+		zap.Int("version", announced.Version), zap.Strings("missing", missing))
+	s.sendControl(p.ClientId, protocol.IncompatiblePacket(protocol.MinProtocolVersion, missing))
+	if err := s.removeClient(p.ClientId); err != nil {
+		sLog().Error("failed to remove incompatible client",
+			zap.String("sessionId", s.Id), zap.String("clientId", p.ClientId), zap.Error(err))
+	}
+	return false
+}
+
+// sendControl sends a control packet to one client, in the binary
+// encoding if the client can read it.
+func (s *Session) sendControl(clientId, packet string) {
+	if s.supports(clientId, protocol.FeatureBinary) {
+		packet = protocol.EncodingBinary.Recode(packet)
+	}
+	if err := s.Pubsub.Send(s.Id, clientId, packet); err != nil {
+		sLog().Error("ably send failure",
+			zap.String("sessionId", s.Id), zap.String("clientId", clientId),
+			zap.String("packet", packet), zap.Error(err))
+	}
+}
+
+// broadcastControl sends a control packet to all clients, in the session's encoding.
+func (s *Session) broadcastControl(packet string) {
+	packet = s.currentEncoding().Recode(packet)
+	if err := s.Pubsub.Broadcast(s.Id, packet); err != nil {
+		sLog().Error("ably broadcast failure",
+			zap.String("sessionId", s.Id),
+			zap.String("packet", packet), zap.Error(err))
+	}
+}
+
+func (s *Session) currentEncoding() protocol.Encoding {
+	if s.encoding == "" {
+		return protocol.EncodingText
+	}
+	return s.encoding
+}
+
+// updateEncoding switches the session's broadcasts to the binary encoding
+// when every client that can hear them can read it, and back to text when
+// one can't. Participants can hear broadcasts whether or not they are
+// online, and so can waiting listeners, who haven't negotiated any features.
+// The switch is announced in text, so that every client can read it.
+func (s *Session) updateEncoding() {
+	encoding := protocol.EncodingBinary
+	if len(s.state.Waitlist) > 0 {
+		encoding = protocol.EncodingText
+	}
+	for _, p := range s.state.Participants {
+		if !s.supports(p.ClientId, protocol.FeatureBinary) {
+			encoding = protocol.EncodingText
+		}
+	}
+	if len(s.state.Participants) == 0 || encoding == s.currentEncoding() {
+		return
+	}
+	s.encoding = encoding
+	sLog().Info("session encoding changed",
+		zap.String("sessionId", s.Id), zap.String("encoding", string(encoding)))
+	packet := protocol.EncodingPacket(encoding)
+	if err := s.Pubsub.Broadcast(s.Id, packet); err != nil {
+		sLog().Error("ably broadcast failure",
+			zap.String("sessionId", s.Id),
+			zap.String("packet", packet), zap.Error(err))
+	}
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/pubsub"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+func TestHandshakeNegotiatesFeatures(t *testing.T) {
+	s, ps := newTestSession(t, "test-handshake")
+	p := storage.NewParticipant("l", "profile-l", "Listener", false)
+	s.state.Participants["l"] = p
+	if s.supports("l", protocol.FeatureResync) {
+		t.Errorf("client supports resync before its handshake")
+	}
+	hello := protocol.HelloPacket(protocol.Capabilities{
+		Version:  protocol.ProtocolVersion + 1,
+		Features: []string{"holograms", protocol.FeatureResync},
+	})
+	if !s.handshake(p, hello) {
+		t.Fatalf("compatible client was refused")
+	}
+	expected := protocol.Capabilities{Version: protocol.ProtocolVersion, Features: []string{protocol.FeatureResync}}
+	if diff := deep.Equal(s.capabilities("l"), expected); diff != nil {
+		t.Errorf("negotiated capabilities: %v", diff)
+	}
+	if len(ps.sent["l"]) != 1 {
+		t.Fatalf("expected a welcome, got %v", ps.sent["l"])
+	}
+	if ok, welcomed := protocol.IsWelcomePacket(ps.sent["l"][0]); !ok || deep.Equal(welcomed, expected) != nil {
+		t.Errorf("welcome was %q", ps.sent["l"][0])
+	}
+}
+
+func TestHandshakeRefusesMissingFeatures(t *testing.T) {
+	s, ps := newTestSession(t, "test-refuse")
+	s.state.Encrypted = true
+	p := storage.NewParticipant("l", "profile-l", "Listener", false)
+	s.state.Participants["l"] = p
+	hello := protocol.HelloPacket(protocol.Capabilities{Version: protocol.ProtocolVersion})
+	if s.handshake(p, hello) {
+		t.Fatalf("client without encryption joined an encrypted session")
+	}
+	if _, ok := s.state.Participants["l"]; ok {
+		t.Errorf("incompatible client was not removed")
+	}
+	if len(ps.sent["l"]) != 1 {
+		t.Fatalf("expected an incompatibility notice, got %v", ps.sent["l"])
+	}
+	ok, minVersion, missing := protocol.IsIncompatiblePacket(ps.sent["l"][0])
+	if !ok || minVersion != protocol.MinProtocolVersion || deep.Equal(missing, []string{protocol.FeatureEncryption}) != nil {
+		t.Errorf("incompatibility notice was %q", ps.sent["l"][0])
+	}
+}
+
+func TestEncryptedSessionRefusesLegacyClients(t *testing.T) {
+	s, ps := newTestSession(t, "test-refuse-legacy")
+	s.state.Encrypted = true
+	s.state.Participants["l"] = storage.NewParticipant("l", "profile-l", "Listener", false)
+	addTestParticipant(s, "w", true, protocol.FeatureEncryption)
+	// a client that comes online without saying hello can't encrypt
+	s.applyStatus(pubsub.ClientStatus{ClientId: "l", IsOnline: true})
+	if _, ok := s.state.Participants["l"]; ok {
+		t.Errorf("legacy client was not removed from an encrypted session")
+	}
+	if len(ps.sent["l"]) != 1 {
+		t.Fatalf("expected an incompatibility notice, got %v", ps.sent["l"])
+	}
+	if ok, _, missing := protocol.IsIncompatiblePacket(ps.sent["l"][0]); !ok || deep.Equal(missing, []string{protocol.FeatureEncryption}) != nil {
+		t.Errorf("incompatibility notice was %q", ps.sent["l"][0])
+	}
+	// a client that said hello is still admitted when it comes back online
+	s.applyStatus(pubsub.ClientStatus{ClientId: "w", IsOnline: true})
+	if _, ok := s.state.Participants["w"]; !ok {
+		t.Errorf("client with encryption was removed from an encrypted session")
+	}
+}
+
+func TestSessionEncoding(t *testing.T) {
+	s, ps := newTestSession(t, "test-encoding")
+	addTestParticipant(s, "w", true, protocol.FeatureBinary).IsOnline = true
+	addTestParticipant(s, "l", false, protocol.FeatureBinary).IsOnline = true
+	s.updateEncoding()
+	if s.currentEncoding() != protocol.EncodingBinary {
+		t.Fatalf("session encoding is %q, want binary", s.currentEncoding())
+	}
+	if ok, e := protocol.IsEncodingPacket(ps.broadcasts[0]); !ok || e != protocol.EncodingBinary || protocol.IsBinary(ps.broadcasts[0]) {
+		t.Errorf("encoding change was announced as %q", ps.broadcasts[0])
+	}
+	s.broadcastControl(protocol.ParticipantsChangedPacket())
+	if packet := ps.broadcasts[1]; !protocol.IsBinary(packet) || !protocol.IsParticipantsChangedPacket(packet) {
+		t.Errorf("broadcast in binary session was %q", packet)
+	}
+	sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "text"})
+	s.transcribeOnePacket(protocol.ContentPacket{
+		PacketId: "b", ClientId: "w", Data: protocol.EncodingBinary.Chunk(protocol.ContentChunk{Offset: 4, Text: " in binary"}),
+	})
+	if s.liveOf("w").text != "text in binary" {
+		t.Errorf("live text from binary chunk is %q", s.liveOf("w").text)
+	}
+	// a waiting listener hasn't negotiated binary, so broadcasts go back to text
+	s.state.Waitlist = append(s.state.Waitlist, storage.NewParticipant("waiting", "profile-waiting", "Waiting", false))
+	s.updateEncoding()
+	if s.currentEncoding() != protocol.EncodingText {
+		t.Errorf("session encoding with waiting listener is %q, want text", s.currentEncoding())
+	}
+	s.takeWaiting("waiting")
+	if s.currentEncoding() != protocol.EncodingBinary {
+		t.Errorf("session encoding after waitlist emptied is %q, want binary", s.currentEncoding())
+	}
+	// so has a legacy listener, even before it comes online
+	s.state.Participants["legacy"] = storage.NewParticipant("legacy", "profile-legacy", "Legacy", false)
+	s.updateEncoding()
+	if s.currentEncoding() != protocol.EncodingText {
+		t.Errorf("session encoding with legacy listener is %q, want text", s.currentEncoding())
+	}
+	s.broadcastControl(protocol.ParticipantsChangedPacket())
+	if packet := ps.broadcasts[len(ps.broadcasts)-1]; protocol.IsBinary(packet) {
+		t.Errorf("broadcast with legacy listener was %q", packet)
+	}
+	s.sendControl("w", protocol.ResendLivePacket())
+	s.sendControl("legacy", protocol.ResendLivePacket())
+	if !protocol.IsBinary(ps.sent["w"][0]) || protocol.IsBinary(ps.sent["legacy"][0]) {
+		t.Errorf("sent packets were %q and %q", ps.sent["w"][0], ps.sent["legacy"][0])
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/storage"
+)
+
+// A session runs on the server instance that holds its lease. The owner
+// renews the lease on a heartbeat, and gives it up when the session ends
+// or has been suspended for handoff. If the owner dies, its lease expires and another instance
+// can take over. Each new owner gets a larger fencing token, so an owner
+// that has lost its lease can tell, and stops writing the session's storage.
+
+var (
+	leaseTTL           = 30 * time.Second
+	leaseRenewInterval = 10 * time.Second
+)
+
+// OwnedElsewhereError is returned for sessions owned by another server instance,
+// or by a session on this instance that's being shut down.
+type OwnedElsewhereError struct {
+	Lease storage.SessionLease
+}
+
+func (e OwnedElsewhereError) Error() string {
+	return fmt.Sprintf("session %s is owned by server %s", e.Lease.SessionId, e.Lease.Owner)
+}
+
+// SessionOwner returns the lease on a session, or nil if it isn't running anywhere.
+func SessionOwner(conversationId string) (*storage.SessionLease, error) {
+	return storage.GetSessionLease(conversationId)
+}
+
+// acquireLease makes this server instance the owner of the session.
+func (s *Session) acquireLease() error {
+	l, ok, err := storage.AcquireSessionLease(s.Id, leaseTTL)
+	if err != nil {
+		sLog().Error("session lease acquire failure", zap.String("sessionId", s.Id), zap.Error(err))
+		return err
+	}
+	if !ok {
+		return OwnedElsewhereError{Lease: l}
+	}
+	s.lease = &l
+	return nil
+}
+
+// renewLease is the lease heartbeat. If the lease has lapsed, it's
+// reacquired; if another instance has taken it, the session is abandoned.
+func (s *Session) renewLease() {
+	if s.lease == nil {
+		return
+	}
+	ok, err := storage.RenewSessionLease(*s.lease, leaseTTL)
+	if err != nil {
+		// keep going, the lease may survive until the next heartbeat
+		sLog().Error("session lease renew failure", zap.String("sessionId", s.Id), zap.Error(err))
+		return
+	}
+	if ok {
+		return
+	}
+	sLog().Warn("session lease lapsed", zap.String("sessionId", s.Id), zap.Int64("token", s.lease.Token))
+	if err = s.acquireLease(); err != nil {
+		s.abandon(err)
+	}
+}
+
+// holdsLease checks whether this instance still owns the session,
+// before writing its storage. Sessions without a lease always do.
+func (s *Session) holdsLease() bool {
+	if s.lease == nil {
+		return true
+	}
+	ok, err := storage.RenewSessionLease(*s.lease, leaseTTL)
+	if err != nil {
+		sLog().Error("session lease check failure", zap.String("sessionId", s.Id), zap.Error(err))
+		return false
+	}
+	return ok
+}
+
+// releaseLease gives up ownership of the session.
+func (s *Session) releaseLease() {
+	if s.lease == nil {
+		return
+	}
+	if err := storage.ReleaseSessionLease(*s.lease); err != nil {
+		sLog().Error("session lease release failure", zap.String("sessionId", s.Id), zap.Error(err))
+	}
+	s.lease = nil
+}
+
+// abandon stops running a session that another instance now owns,
+// without ending it for its participants.
+func (s *Session) abandon(reason error) {
+	sLog().Warn("abandoning session", zap.String("sessionId", s.Id), zap.Error(reason))
+	unregisterSession(s)
+	s.lease = nil
+	s.cancel()
+	if err := s.Pubsub.EndSession(s.Id); err != nil {
+		sLog().Error("ably session end failure", zap.String("sessionId", s.Id), zap.Error(err))
+	}
+	// the new owner keeps the snapshot now
+	if err := storage.ForgetServerSession(storage.ServerId, s.Id); err != nil {
+		sLog().Error("server session forget failure", zap.String("sessionId", s.Id), zap.Error(err))
+	}
+}
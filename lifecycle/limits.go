@@ -0,0 +1,197 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+// ContentLimits bounds how fast content can flow into a session,
+// both from each client and from all clients combined.
+// A zero limit is not enforced.
+//
+// Content over a limit is dropped, and the client that sent it is
+// warned (at most once a second). A client that is warned often
+// enough is muted: all of its content is dropped for a while.
+type ContentLimits struct {
+	ClientChunksPerSecond     int
+	ClientBytesPerSecond      int
+	ClientPastLinesPerMinute  int
+	SessionChunksPerSecond    int
+	SessionBytesPerSecond     int
+	SessionPastLinesPerMinute int
+	WarningsBeforeMute        int
+	MuteDuration              time.Duration
+}
+
+var DefaultContentLimits = ContentLimits{
+	ClientChunksPerSecond:     50,
+	ClientBytesPerSecond:      16 * 1024,
+	ClientPastLinesPerMinute:  120,
+	SessionChunksPerSecond:    200,
+	SessionBytesPerSecond:     64 * 1024,
+	SessionPastLinesPerMinute: 300,
+	WarningsBeforeMute:        3,
+	MuteDuration:              30 * time.Second,
+}
+
+var contentLimits atomic.Pointer[ContentLimits]
+
+// SetContentLimits changes the limits for all sessions.
+func SetContentLimits(limits ContentLimits) {
+	contentLimits.Store(&limits)
+}
+
+func currentContentLimits() ContentLimits {
+	if l := contentLimits.Load(); l != nil {
+		return *l
+	}
+	return DefaultContentLimits
+}
+
+// ContentLimitMetrics counts content limit enforcement across all sessions.
+type ContentLimitMetrics struct {
+	DroppedChunks int64
+	Warnings      int64
+	Mutes         int64
+}
+
+var limitMetrics struct {
+	droppedChunks atomic.Int64
+	warnings      atomic.Int64
+	mutes         atomic.Int64
+}
+
+// CurrentContentLimitMetrics returns the enforcement counts since server start.
+func CurrentContentLimitMetrics() ContentLimitMetrics {
+	return ContentLimitMetrics{
+		DroppedChunks: limitMetrics.droppedChunks.Load(),
+		Warnings:      limitMetrics.warnings.Load(),
+		Mutes:         limitMetrics.mutes.Load(),
+	}
+}
+
+// A rateWindow counts events over fixed windows of time.
+type rateWindow struct {
+	length time.Duration
+	start  time.Time
+	count  int
+}
+
+// add counts n events at the given time, and returns the count for the current window.
+func (w *rateWindow) add(now time.Time, n int) int {
+	if now.Sub(w.start) >= w.length {
+		w.start = now
+		w.count = 0
+	}
+	w.count += n
+	return w.count
+}
+
+type contentRates struct {
+	chunks rateWindow
+	bytes  rateWindow
+	lines  rateWindow
+}
+
+func newContentRates() *contentRates {
+	return &contentRates{
+		chunks: rateWindow{length: time.Second},
+		bytes:  rateWindow{length: time.Second},
+		lines:  rateWindow{length: time.Minute},
+	}
+}
+
+// record counts a chunk, and returns the name of the first limit
+// exceeded by doing so, or the empty string if none was exceeded.
+func (r *contentRates) record(now time.Time, size, lines, chunkLimit, byteLimit, lineLimit int) string {
+	exceeded := ""
+	if c := r.chunks.add(now, 1); chunkLimit > 0 && c > chunkLimit {
+		exceeded = "chunks"
+	}
+	if b := r.bytes.add(now, size); exceeded == "" && byteLimit > 0 && b > byteLimit {
+		exceeded = "bytes"
+	}
+	if l := r.lines.add(now, lines); exceeded == "" && lineLimit > 0 && l > lineLimit {
+		exceeded = "lines"
+	}
+	return exceeded
+}
+
+type clientRates struct {
+	*contentRates
+	warnings    int
+	lastWarning time.Time
+	mutedUntil  time.Time
+}
+
+// admitContent enforces the content limits on an incoming packet,
+// and returns whether the packet should be processed.
+func (s *Session) admitContent(packet protocol.ContentPacket) bool {
+	now := time.Now()
+	limits := currentContentLimits()
+	cr, ok := s.clientRates[packet.ClientId]
+	if !ok {
+		cr = &clientRates{contentRates: newContentRates()}
+		s.clientRates[packet.ClientId] = cr
+	}
+	if now.Before(cr.mutedUntil) {
+		limitMetrics.droppedChunks.Add(1)
+		return false
+	}
+	lines := 0
+	if protocol.ParseContentChunk(packet.Data).Offset == protocol.CoNewline {
+		lines = 1
+	}
+	size := len(packet.Data)
+	exceeded := cr.record(now, size, lines,
+		limits.ClientChunksPerSecond, limits.ClientBytesPerSecond, limits.ClientPastLinesPerMinute)
+	if sessionExceeded := s.rates.record(now, size, lines,
+		limits.SessionChunksPerSecond, limits.SessionBytesPerSecond, limits.SessionPastLinesPerMinute,
+	); exceeded == "" && sessionExceeded != "" {
+		exceeded = "session " + sessionExceeded
+	}
+	if exceeded == "" {
+		return true
+	}
+	limitMetrics.droppedChunks.Add(1)
+	if now.Sub(cr.lastWarning) < time.Second {
+		return false
+	}
+	if now.Sub(cr.lastWarning) > time.Minute {
+		// the client has behaved for a while, so forgive its past warnings
+		cr.warnings = 0
+	}
+	cr.lastWarning = now
+	cr.warnings++
+	var packetOut string
+	if limits.WarningsBeforeMute > 0 && cr.warnings >= limits.WarningsBeforeMute {
+		cr.warnings = 0
+		cr.mutedUntil = now.Add(limits.MuteDuration)
+		limitMetrics.mutes.Add(1)
+		sLog().Warn("muting client for exceeding content limits",
+			zap.String("sessionId", s.Id), zap.String("clientId", packet.ClientId),
+			zap.String("limit", exceeded), zap.Duration("duration", limits.MuteDuration))
+		packetOut = protocol.MutedPacket(cr.mutedUntil.UnixMilli())
+	} else {
+		limitMetrics.warnings.Add(1)
+		sLog().Info("client exceeded content limit",
+			zap.String("sessionId", s.Id), zap.String("clientId", packet.ClientId),
+			zap.String("limit", exceeded), zap.Int("warnings", cr.warnings))
+		packetOut = protocol.RateWarningPacket(exceeded)
+	}
+	if !s.supports(packet.ClientId, protocol.FeatureRateLimits) {
+		return false
+	}
+	s.sendControl(packet.ClientId, packetOut)
+	return false
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+func TestRateWindow(t *testing.T) {
+	w := rateWindow{length: time.Second}
+	start := time.Now()
+	if c := w.add(start, 3); c != 3 {
+		t.Errorf("first add count is %d, want 3", c)
+	}
+	if c := w.add(start.Add(500*time.Millisecond), 2); c != 5 {
+		t.Errorf("add within window count is %d, want 5", c)
+	}
+	if c := w.add(start.Add(time.Second), 1); c != 1 {
+		t.Errorf("add in next window count is %d, want 1", c)
+	}
+}
+
+func TestAdmitContentWarnsThenMutes(t *testing.T) {
+	SetContentLimits(ContentLimits{
+		ClientChunksPerSecond: 2,
+		WarningsBeforeMute:    2,
+		MuteDuration:          time.Minute,
+	})
+	defer SetContentLimits(DefaultContentLimits)
+	s, ps := newTestSession(t, "test-limits")
+	addTestParticipant(s, "w", true, protocol.FeatureRateLimits)
+	packet := protocol.ContentPacket{PacketId: "p", ClientId: "w", Data: "0|x"}
+	admitted := 0
+	for i := 0; i < 5; i++ {
+		if s.admitContent(packet) {
+			admitted++
+		}
+	}
+	if admitted != 2 {
+		t.Errorf("admitted %d packets, want 2", admitted)
+	}
+	if len(ps.sent["w"]) != 1 {
+		t.Fatalf("expected one warning, got %v", ps.sent["w"])
+	}
+	if ok, limit := protocol.IsRateWarningPacket(ps.sent["w"][0]); !ok || limit != "chunks" {
+		t.Errorf("expected a chunks warning, got %q", ps.sent["w"][0])
+	}
+	// the next warning comes no sooner than a second later, and mutes the client
+	s.clientRates["w"].lastWarning = time.Now().Add(-2 * time.Second)
+	if s.admitContent(packet) {
+		t.Errorf("packet over the limit was admitted")
+	}
+	if len(ps.sent["w"]) != 2 {
+		t.Fatalf("expected a mute notice, got %v", ps.sent["w"])
+	}
+	if ok, _ := protocol.IsMutedPacket(ps.sent["w"][1]); !ok {
+		t.Errorf("expected a muted packet, got %q", ps.sent["w"][1])
+	}
+	// a muted client's packets are dropped even when under the limit
+	s.clientRates["w"].chunks = rateWindow{length: time.Second}
+	if s.admitContent(packet) {
+		t.Errorf("packet from a muted client was admitted")
+	}
+	if len(ps.sent["w"]) != 2 {
+		t.Errorf("muted client was sent more notices: %v", ps.sent["w"])
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+// The reasons a whisperer can remove a participant.
+const (
+	RemovedKicked = "kicked"
+	RemovedBanned = "banned"
+)
+
+var (
+	BannedError    = fmt.Errorf("banned from conversation")
+	WhispererError = fmt.Errorf("whisperers can't be removed")
+)
+
+// RemoveListener removes a listener, or a waiting listener, from the
+// session at the request of the whisperer. The listener is told why,
+// and their pubsub access is revoked.
+func (s *Session) RemoveListener(clientId string) error {
+	err := EndedError
+	s.do(func() { err = s.kick(clientId, RemovedKicked) })
+	return err
+}
+
+// BanProfile removes all the profile's clients from the session, and keeps
+// them from asking to rejoin. The ban itself is stored by the caller.
+func (s *Session) BanProfile(profileId string) {
+	s.do(func() {
+		s.banned[profileId] = true
+		var clientIds []string
+		for _, p := range s.state.Participants {
+			if p.ProfileId == profileId && !p.IsWhisperer {
+				clientIds = append(clientIds, p.ClientId)
+			}
+		}
+		for _, p := range s.state.Waitlist {
+			if p.ProfileId == profileId {
+				clientIds = append(clientIds, p.ClientId)
+			}
+		}
+		for _, clientId := range clientIds {
+			_ = s.kick(clientId, RemovedBanned)
+		}
+	})
+}
+
+// UnbanProfile lets the profile ask to join the session again.
+func (s *Session) UnbanProfile(profileId string) {
+	s.do(func() { delete(s.banned, profileId) })
+}
+
+// loadBans reads the conversation's bans into the session.
+func (s *Session) loadBans() error {
+	profiles, err := storage.GetBannedProfiles(s.Id)
+	if err != nil {
+		return err
+	}
+	for _, profileId := range profiles {
+		s.banned[profileId] = true
+	}
+	return nil
+}
+
+func (s *Session) kick(clientId, reason string) error {
+	p, ok := s.state.Participants[clientId]
+	if ok {
+		if p.IsWhisperer {
+			return WhispererError
+		}
+	} else if s.takeWaiting(clientId) == nil {
+		return NotPresentError
+	}
+	// tell them before they lose access
+	s.sendControl(clientId, protocol.RemovedPacket(reason))
+	if ok {
+		delete(s.state.Participants, clientId)
+		s.observeParticipant(EventParticipantLeft, p)
+	}
+	if err := s.Pubsub.RevokeClient(s.Id, clientId); err != nil {
+		// they still won't be issued another token
+		sLog().Error("ably revoke client failure",
+			zap.String("sessionId", s.Id), zap.String("clientId", clientId), zap.Error(err))
+	}
+	sLog().Info("removed participant", zap.String("sessionId", s.Id),
+		zap.String("clientId", clientId), zap.String("reason", reason))
+	s.updateEncoding()
+	s.broadcastControl(protocol.ParticipantsChangedPacket())
+	return nil
+}
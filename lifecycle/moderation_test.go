@@ -0,0 +1,78 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+func removedFor(packets []string) string {
+	for _, p := range packets {
+		if ok, reason := protocol.IsRemovedPacket(p); ok {
+			return reason
+		}
+	}
+	return ""
+}
+
+func TestRemoveListener(t *testing.T) {
+	s, ps := newTestSession(t, "test-remove-listener")
+	addTestParticipant(s, "w", true)
+	addTestParticipant(s, "l", false)
+	if err := s.RemoveListener("w"); !errors.Is(err, WhispererError) {
+		t.Errorf("RemoveListener() of whisperer failed, got %v, want %v", err, WhispererError)
+	}
+	if err := s.RemoveListener("l"); err != nil {
+		t.Fatalf("RemoveListener() failed: %v", err)
+	}
+	if reason := removedFor(ps.sent["l"]); reason != RemovedKicked {
+		t.Errorf("RemoveListener() failed, sent reason %q, want %q", reason, RemovedKicked)
+	}
+	if !slices.Equal(ps.revoked, []string{"l"}) {
+		t.Errorf("RemoveListener() failed, revoked %v, want [l]", ps.revoked)
+	}
+	if err := s.RemoveListener("l"); !errors.Is(err, NotPresentError) {
+		t.Errorf("RemoveListener() repeated failed, got %v, want %v", err, NotPresentError)
+	}
+	// removed listeners can ask again
+	if err := s.AddListenerRequest("l", "profile-l", "l"); err != nil {
+		t.Errorf("AddListenerRequest() after removal failed: %v", err)
+	}
+}
+
+func TestBanProfile(t *testing.T) {
+	s, ps := newTestSession(t, "test-ban-profile")
+	addTestParticipant(s, "w", true)
+	addTestParticipant(s, "l1", false).ProfileId = "banned"
+	addTestParticipant(s, "l2", false)
+	if err := s.AddListenerRequest("l3", "banned", "l3"); err != nil {
+		t.Fatalf("AddListenerRequest() failed: %v", err)
+	}
+	s.BanProfile("banned")
+	for _, c := range []string{"l1", "l3"} {
+		if reason := removedFor(ps.sent[c]); reason != RemovedBanned {
+			t.Errorf("BanProfile() failed, sent %s reason %q, want %q", c, reason, RemovedBanned)
+		}
+	}
+	if participants := s.Participants(); len(participants) != 2 {
+		t.Errorf("BanProfile() failed, left participants %v, want w and l2", participants)
+	}
+	if requesters := s.Requesters(); len(requesters) != 0 {
+		t.Errorf("BanProfile() failed, left requesters %v", requesters)
+	}
+	if err := s.AddListenerRequest("l4", "banned", "l4"); !errors.Is(err, BannedError) {
+		t.Errorf("AddListenerRequest() of banned profile failed, got %v, want %v", err, BannedError)
+	}
+	s.UnbanProfile("banned")
+	if err := s.AddListenerRequest("l4", "banned", "l4"); err != nil {
+		t.Errorf("AddListenerRequest() after unban failed: %v", err)
+	}
+}
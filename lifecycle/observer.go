@@ -0,0 +1,213 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/storage"
+)
+
+// Extensions can follow the activity in sessions by registering an
+// Observer, typically from an init function, and having it enabled when
+// the server is started. Observers are told about events after the fact,
+// and can't affect the session. Each observer has its own queue of events,
+// delivered in order on its own goroutine, so a slow observer only delays
+// itself. If its queue is full, events for it are dropped rather than
+// holding up the session, and if it panics, the panic is logged and
+// delivery goes on with the next event.
+
+// The kinds of session events.
+type EventKind string
+
+const (
+	EventSessionStarted    EventKind = "session-started"
+	EventSessionSuspended  EventKind = "session-suspended" // it will be resumed by another server
+	EventSessionEnded      EventKind = "session-ended"
+	EventParticipantJoined EventKind = "participant-joined"
+	EventParticipantLeft   EventKind = "participant-left"
+	EventParticipantOnline EventKind = "participant-online" // the participant went online or offline
+	EventWaitlistRequest   EventKind = "waitlist-request"
+	EventLiveTextChanged   EventKind = "live-text-changed"
+	EventPastLineCommitted EventKind = "past-line-committed"
+)
+
+// An Event is something that happened in a session. Which fields are
+// filled in depends on its kind:
+//
+//   - Participant events, and waitlist requests, have the participant
+//     as it was after the event.
+//   - Live text events have the whisperer's client ID and their new live text.
+//   - Past line events have the line and its index in the session's past text.
+//     A corrected line is committed again at the same index.
+//   - Session end events have the ID of the transcript saved, if any.
+type Event struct {
+	Kind         EventKind
+	SessionId    string
+	Time         time.Time
+	ClientId     string
+	Participant  storage.Participant
+	Text         string
+	Line         storage.PastTextLine
+	LineIndex    int
+	TranscriptId string
+}
+
+// An Observer is told about the events in every session on this server.
+type Observer interface {
+	Observe(event Event)
+}
+
+// An ObserverFunc is an ordinary function used as an Observer.
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+// observerQueueSize is how many events can wait for each observer
+// before events for it are dropped.
+var observerQueueSize = 1024
+
+// observerQueue delivers events to one observer.
+type observerQueue struct {
+	name     string
+	observer Observer
+	events   chan Event
+	dropped  atomic.Int64 // events dropped since the last one queued
+	done     chan struct{}
+}
+
+var observers = struct {
+	sync.RWMutex
+	registered map[string]Observer
+	active     []*observerQueue
+}{registered: map[string]Observer{"log": ObserverFunc(logEvent)}}
+
+// RegisterObserver makes an observer available under the given name.
+// Registering two observers with the same name is a programming error,
+// so it panics.
+func RegisterObserver(name string, o Observer) {
+	observers.Lock()
+	defer observers.Unlock()
+	if _, ok := observers.registered[name]; ok {
+		panic(fmt.Sprintf("session observer %q registered twice", name))
+	}
+	observers.registered[name] = o
+}
+
+// ObserverNames returns the names of the registered observers.
+func ObserverNames() []string {
+	observers.RLock()
+	defer observers.RUnlock()
+	names := make([]string, 0, len(observers.registered))
+	for name := range observers.registered {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// UseObservers enables the named observers, in place of any that were
+// enabled before. Events already waiting for the observers that were
+// enabled before are still delivered to them.
+func UseObservers(names ...string) error {
+	observers.Lock()
+	defer observers.Unlock()
+	active := make([]*observerQueue, 0, len(names))
+	for _, name := range names {
+		o, ok := observers.registered[name]
+		if !ok {
+			return fmt.Errorf("unknown session observer: %s", name)
+		}
+		active = append(active, &observerQueue{
+			name:     name,
+			observer: o,
+			events:   make(chan Event, observerQueueSize),
+			done:     make(chan struct{}),
+		})
+	}
+	for _, q := range observers.active {
+		close(q.events)
+	}
+	observers.active = active
+	for _, q := range active {
+		sLog().Info("session observer enabled", zap.String("observer", q.name))
+		go q.run()
+	}
+	return nil
+}
+
+// observe tells the enabled observers about an event in the session.
+// It never waits for them.
+func (s *Session) observe(e Event) {
+	e.SessionId, e.Time = s.Id, time.Now()
+	observers.RLock()
+	defer observers.RUnlock()
+	for _, q := range observers.active {
+		q.enqueue(e)
+	}
+}
+
+// observeParticipant tells the enabled observers about an event
+// involving a participant. They get a copy of the participant,
+// since the session goes on changing it.
+func (s *Session) observeParticipant(kind EventKind, p *storage.Participant) {
+	c := *p
+	c.Features = slices.Clone(p.Features)
+	s.observe(Event{Kind: kind, ClientId: p.ClientId, Participant: c})
+}
+
+// observePastLine tells the enabled observers about a line of past text
+// that was committed or corrected.
+func (s *Session) observePastLine(index int) {
+	line := s.state.PastText[index]
+	s.observe(Event{Kind: EventPastLineCommitted, ClientId: line.AuthorId, Line: line, LineIndex: index})
+}
+
+func (q *observerQueue) enqueue(e Event) {
+	select {
+	case q.events <- e:
+		if dropped := q.dropped.Swap(0); dropped > 0 {
+			sLog().Warn("session observer dropped events",
+				zap.String("observer", q.name), zap.Int64("dropped", dropped))
+		}
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+func (q *observerQueue) run() {
+	defer close(q.done)
+	for e := range q.events {
+		q.deliver(e)
+	}
+}
+
+func (q *observerQueue) deliver(e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			sLog().Error("session observer panic", zap.String("observer", q.name),
+				zap.String("sessionId", e.SessionId), zap.String("event", string(e.Kind)),
+				zap.Any("panic", r))
+		}
+	}()
+	q.observer.Observe(e)
+}
+
+// logEvent is the built-in "log" observer, which logs every event.
+func logEvent(e Event) {
+	sLog().Info("session event", zap.String("sessionId", e.SessionId),
+		zap.String("event", string(e.Kind)), zap.String("clientId", e.ClientId),
+		zap.Int("lineIndex", e.LineIndex), zap.String("transcriptId", e.TranscriptId))
+}
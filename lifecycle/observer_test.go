@@ -0,0 +1,103 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/pubsub"
+)
+
+// stopObservers disables all observers, and waits for them
+// to be delivered the events already queued for them.
+func stopObservers(t *testing.T) {
+	observers.RLock()
+	active := observers.active
+	observers.RUnlock()
+	if err := UseObservers(); err != nil {
+		t.Fatalf("UseObservers() failed: %v", err)
+	}
+	for _, q := range active {
+		<-q.done
+	}
+}
+
+func TestObserverEvents(t *testing.T) {
+	var events []Event
+	RegisterObserver("test-recorder", ObserverFunc(func(e Event) { events = append(events, e) }))
+	if err := UseObservers("test-recorder"); err != nil {
+		t.Fatalf("UseObservers() failed: %v", err)
+	}
+	if err := UseObservers("test-missing"); err == nil {
+		t.Errorf("UseObservers() of unknown observer succeeded")
+	}
+	s, _ := newTestSession(t, "test-observer-events")
+	addTestParticipant(s, "w", true)
+	sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "hello"}, protocol.ContentChunk{Offset: protocol.CoNewline})
+	s.applyStatus(pubsub.ClientStatus{ClientId: "w", IsOnline: true})
+	stopObservers(t)
+
+	var kinds []EventKind
+	for _, e := range events {
+		if e.SessionId != s.Id {
+			t.Errorf("event %s has session %q, want %q", e.Kind, e.SessionId, s.Id)
+		}
+		kinds = append(kinds, e.Kind)
+	}
+	expected := []EventKind{EventLiveTextChanged, EventPastLineCommitted, EventLiveTextChanged, EventParticipantOnline}
+	if !slices.Equal(kinds, expected) {
+		t.Fatalf("observed events %v, want %v", kinds, expected)
+	}
+	if events[0].Text != "hello" || events[2].Text != "" {
+		t.Errorf("observed live text %q then %q", events[0].Text, events[2].Text)
+	}
+	if line := events[1].Line; line.Text != "hello" || line.AuthorId != "w" || events[1].LineIndex != 0 {
+		t.Errorf("observed past line %v at %d", line, events[1].LineIndex)
+	}
+	if p := events[3].Participant; p.ClientId != "w" || !p.IsOnline {
+		t.Errorf("observed participant %v", p)
+	}
+}
+
+func TestObserversCantStallSession(t *testing.T) {
+	saved := observerQueueSize
+	observerQueueSize = 2
+	defer func() { observerQueueSize = saved }()
+	unblock := make(chan struct{})
+	var blocked, panicked atomic.Int64
+	RegisterObserver("test-blocker", ObserverFunc(func(Event) {
+		blocked.Add(1)
+		<-unblock
+	}))
+	RegisterObserver("test-panicker", ObserverFunc(func(Event) {
+		panicked.Add(1)
+		panic("observer failure")
+	}))
+	if err := UseObservers("test-blocker", "test-panicker"); err != nil {
+		t.Fatalf("UseObservers() failed: %v", err)
+	}
+	s, _ := newTestSession(t, "test-observer-stall")
+	addTestParticipant(s, "w", true)
+	for range 10 {
+		sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "line"}, protocol.ContentChunk{Offset: protocol.CoNewline})
+	}
+	if len(s.state.PastText) != 10 {
+		t.Errorf("past text has %d lines, want 10", len(s.state.PastText))
+	}
+	close(unblock)
+	stopObservers(t)
+	// the blocked observer gets the event it blocked on, and those queued behind it
+	if n := blocked.Load(); n < 1 || n > int64(observerQueueSize)+1 {
+		t.Errorf("blocked observer was delivered %d events", n)
+	}
+	if n := panicked.Load(); n < 2 {
+		t.Errorf("panicking observer was delivered %d events, want more than 1", n)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+// IdlePolicy decides when a session that isn't being used is ended,
+// so that a whisperer who disappears doesn't leave it running forever.
+// A zero limit is not enforced.
+//
+// Participants are warned (with an idle-warning packet) the Warning
+// duration before a session is ended, so they have a chance to keep it going.
+type IdlePolicy struct {
+	WhispererAbsence time.Duration // how long a session can go with no whisperer online
+	ContentIdle      time.Duration // how long a session can go with no content
+	MaxLength        time.Duration // how long a session can last
+	Warning          time.Duration
+}
+
+var DefaultIdlePolicy = IdlePolicy{
+	WhispererAbsence: 10 * time.Minute,
+	ContentIdle:      time.Hour,
+	MaxLength:        12 * time.Hour,
+	Warning:          time.Minute,
+}
+
+// The reasons a session can be ended by the reaper.
+const (
+	IdleWhispererAbsent = "whisperer-absent"
+	IdleNoContent       = "no-content"
+	IdleMaxLength       = "max-length"
+)
+
+var idlePolicy atomic.Pointer[IdlePolicy]
+
+// SetIdlePolicy changes the idle policy for all sessions.
+func SetIdlePolicy(policy IdlePolicy) {
+	idlePolicy.Store(&policy)
+}
+
+func currentIdlePolicy() IdlePolicy {
+	if p := idlePolicy.Load(); p != nil {
+		return *p
+	}
+	return DefaultIdlePolicy
+}
+
+// idleCheckInterval is how often each session checks the idle policy.
+var idleCheckInterval = 15 * time.Second
+
+// checkIdle applies the idle policy to the session at the given time:
+// it warns the participants when the session is about to be ended, and
+// ends the session once it's due. It returns whether the session was ended.
+func (s *Session) checkIdle(now time.Time) bool {
+	policy := currentIdlePolicy()
+	if s.whispererOnline() {
+		s.whispererSeen = now
+	}
+	reason, deadline := s.idleDeadline(policy)
+	if reason == "" {
+		return false
+	}
+	if !now.Before(deadline) {
+		s.reap(reason)
+		return true
+	}
+	if now.Add(policy.Warning).Before(deadline) || s.warnedDeadline.Equal(deadline) {
+		return false
+	}
+	s.warnedDeadline = deadline
+	sLog().Info("warning of idle session end",
+		zap.String("sessionId", s.Id), zap.String("reason", reason), zap.Time("deadline", deadline))
+	s.broadcastControl(protocol.IdleWarningPacket(reason, deadline.UnixMilli()))
+	return false
+}
+
+// idleDeadline returns the earliest time the idle policy will end the
+// session, and why, if the policy has any enforced limits.
+func (s *Session) idleDeadline(policy IdlePolicy) (reason string, deadline time.Time) {
+	consider := func(limit time.Duration, since time.Time, why string) {
+		if limit <= 0 {
+			return
+		}
+		if due := since.Add(limit); reason == "" || due.Before(deadline) {
+			reason, deadline = why, due
+		}
+	}
+	consider(policy.WhispererAbsence, s.whispererSeen, IdleWhispererAbsent)
+	consider(policy.ContentIdle, s.lastContent, IdleNoContent)
+	consider(policy.MaxLength, time.UnixMilli(s.state.StartedAt), IdleMaxLength)
+	return
+}
+
+func (s *Session) whispererOnline() bool {
+	for _, p := range s.state.Participants {
+		if p.IsWhisperer && p.IsOnline {
+			return true
+		}
+	}
+	return false
+}
+
+// reap ends an idle session, just as if its whisperer had ended it.
+func (s *Session) reap(reason string) {
+	sLog().Info("ending idle session", zap.String("sessionId", s.Id), zap.String("reason", reason))
+	unregisterSession(s)
+	if transcriptId := s.end(); transcriptId != "" {
+		sLog().Info("saved transcript of idle session",
+			zap.String("sessionId", s.Id), zap.String("transcriptId", transcriptId))
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+func TestIdleWhispererAbsent(t *testing.T) {
+	SetIdlePolicy(IdlePolicy{WhispererAbsence: 10 * time.Minute, Warning: time.Minute})
+	defer SetIdlePolicy(DefaultIdlePolicy)
+	s, ps := newTestSession(t, "test-idle-absent")
+	registerSession(s)
+	addTestParticipant(s, "w", true)
+	addTestParticipant(s, "l", false).IsOnline = true
+	start := s.whispererSeen
+	if s.checkIdle(start.Add(8 * time.Minute)) {
+		t.Fatalf("session ended before its deadline")
+	}
+	if len(ps.broadcasts) != 0 {
+		t.Errorf("warned too early: %v", ps.broadcasts)
+	}
+	s.checkIdle(start.Add(9*time.Minute + 30*time.Second))
+	s.checkIdle(start.Add(9*time.Minute + 40*time.Second))
+	if len(ps.broadcasts) != 1 {
+		t.Fatalf("expected one idle warning, got %v", ps.broadcasts)
+	}
+	ok, reason, endsAt := protocol.IsIdleWarningPacket(ps.broadcasts[0])
+	if !ok || reason != IdleWhispererAbsent || endsAt != start.Add(10*time.Minute).UnixMilli() {
+		t.Errorf("idle warning was %q", ps.broadcasts[0])
+	}
+	if !s.checkIdle(start.Add(10 * time.Minute)) {
+		t.Fatalf("session didn't end at its deadline")
+	}
+	<-s.done
+	if !protocol.IsEndPacket(ps.broadcasts[len(ps.broadcasts)-1]) {
+		t.Errorf("participants weren't told the session ended: %v", ps.broadcasts)
+	}
+	if findSession(s.Id) != nil {
+		t.Errorf("reaped session is still registered")
+	}
+}
+
+func TestIdleActivityPostponesEnd(t *testing.T) {
+	SetIdlePolicy(IdlePolicy{WhispererAbsence: 10 * time.Minute, ContentIdle: time.Hour, Warning: time.Minute})
+	defer SetIdlePolicy(DefaultIdlePolicy)
+	s, ps := newTestSession(t, "test-idle-activity")
+	addTestParticipant(s, "w", true).IsOnline = true
+	now := time.Now()
+	s.lastContent = now.Add(-59*time.Minute - 30*time.Second)
+	s.checkIdle(now)
+	if len(ps.broadcasts) != 1 {
+		t.Fatalf("expected one idle warning, got %v", ps.broadcasts)
+	}
+	if ok, reason, _ := protocol.IsIdleWarningPacket(ps.broadcasts[0]); !ok || reason != IdleNoContent {
+		t.Errorf("idle warning was %q", ps.broadcasts[0])
+	}
+	s.receiveContent(protocol.ContentPacket{PacketId: "p", ClientId: "w", Data: "0|still here"})
+	if s.checkIdle(now.Add(time.Minute)) {
+		t.Errorf("session with new content was ended")
+	}
+	if len(ps.broadcasts) != 1 {
+		t.Errorf("session with new content was warned again: %v", ps.broadcasts[1:])
+	}
+}
+
+func TestIdleDeadline(t *testing.T) {
+	s, _ := newTestSession(t, "test-idle-deadline")
+	start := time.UnixMilli(s.state.StartedAt)
+	s.whispererSeen, s.lastContent = start.Add(time.Hour), start.Add(2*time.Hour)
+	tests := []struct {
+		name     string
+		policy   IdlePolicy
+		reason   string
+		deadline time.Time
+	}{
+		{"no limits", IdlePolicy{}, "", time.Time{}},
+		{"absence", IdlePolicy{WhispererAbsence: time.Hour}, IdleWhispererAbsent, start.Add(2 * time.Hour)},
+		{"content", IdlePolicy{WhispererAbsence: 2 * time.Hour, ContentIdle: 30 * time.Minute}, IdleNoContent, start.Add(150 * time.Minute)},
+		{"length", IdlePolicy{ContentIdle: time.Hour, MaxLength: 90 * time.Minute}, IdleMaxLength, start.Add(90 * time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, deadline := s.idleDeadline(tt.policy)
+			if reason != tt.reason || !deadline.Equal(tt.deadline) {
+				t.Errorf("idleDeadline() failed, got %q at %v, want %q at %v", reason, deadline, tt.reason, tt.deadline)
+			}
+		})
+	}
+}
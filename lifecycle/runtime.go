@@ -0,0 +1,154 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/storage"
+)
+
+// Once a session has started, its state is only touched by its event loop.
+// Handlers hand the loop commands and wait for them to be done, pubsub hands
+// it participant status and content, tickers have it check the idle policy
+// and renew its lease, and it handles them all one at a time.
+
+// The registry holds the sessions running on this server. A session is
+// registered as soon as it starts starting, so it's only started once.
+var registry = struct {
+	sync.Mutex
+	sessions map[string]*Session
+}{sessions: make(map[string]*Session)}
+
+// registerSession returns the registered session with the given ID, and
+// whether it was found. If none is found, the new session is registered.
+func registerSession(s *Session) (*Session, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	if found, ok := registry.sessions[s.Id]; ok {
+		return found, true
+	}
+	registry.sessions[s.Id] = s
+	return s, false
+}
+
+// unregisterSession removes a session from the registry, unless it has
+// already been replaced by a newer session with the same ID.
+func unregisterSession(s *Session) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.sessions[s.Id] == s {
+		delete(registry.sessions, s.Id)
+	}
+}
+
+// findSession returns the running session with the given ID, or nil.
+// If the session is starting, it waits to see whether it starts.
+func findSession(id string) *Session {
+	registry.Lock()
+	s := registry.sessions[id]
+	registry.Unlock()
+	if s == nil || !s.ready() {
+		return nil
+	}
+	return s
+}
+
+// runningSessions returns all the sessions that are running.
+func runningSessions() []*Session {
+	registry.Lock()
+	all := make([]*Session, 0, len(registry.sessions))
+	for _, s := range registry.sessions {
+		all = append(all, s)
+	}
+	registry.Unlock()
+	running := all[:0]
+	for _, s := range all {
+		if s.ready() {
+			running = append(running, s)
+		}
+	}
+	return running
+}
+
+// ready waits for the session to finish starting, and returns whether it started.
+func (s *Session) ready() bool {
+	<-s.started
+	return s.startErr == nil
+}
+
+// run is the session's event loop. It stops when the session's context
+// is cancelled, after saving the live packets if the session is shutting down.
+// Commands, status changes and content mark the session as changed, and
+// changed sessions are snapshotted periodically.
+func (s *Session) run(ctx context.Context) {
+	sLog().Info("session event loop started", zap.String("sessionId", s.Id))
+	defer close(s.done)
+	idleTicker := time.NewTicker(idleCheckInterval)
+	defer idleTicker.Stop()
+	leaseTicker := time.NewTicker(leaseRenewInterval)
+	defer leaseTicker.Stop()
+	snapshotTicker := time.NewTicker(snapshotInterval)
+	defer snapshotTicker.Stop()
+	s.dirty = true
+	s.snapshot(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			if s.shuttingDown {
+				sLog().Info("saving live packets at shutdown", zap.String("sessionId", s.Id))
+				if packets := s.livePackets(); len(packets) > 0 {
+					if err := storage.SuspendSessionPackets(s.Id, packets...); err != nil {
+						sLog().Error("error saving suspended packets",
+							zap.String("sessionId", s.Id), zap.Error(err))
+					}
+				}
+			}
+			sLog().Info("session event loop stopped", zap.String("sessionId", s.Id))
+			return
+		case command := <-s.commands:
+			command()
+		case status := <-s.sr:
+			s.applyStatus(status)
+			s.dirty = true
+		case packet := <-s.cr:
+			s.receiveContent(packet)
+			s.dirty = true
+		case now := <-idleTicker.C:
+			s.checkIdle(now)
+		case <-leaseTicker.C:
+			s.renewLease()
+		case <-snapshotTicker.C:
+			s.snapshot(ctx)
+		}
+	}
+}
+
+// do runs a command on the session's event loop, and waits for it to be done.
+// It returns false, without running the command, if the loop has stopped.
+// The command is assumed to change the session's state.
+func (s *Session) do(command func()) bool {
+	return s.query(func() { command(); s.dirty = true })
+}
+
+// query runs a command that only reads the session's state on the event
+// loop, and waits for it to be done. It returns false, without running
+// the command, if the loop has stopped.
+func (s *Session) query(command func()) bool {
+	finished := make(chan struct{})
+	select {
+	case s.commands <- func() { defer close(finished); command() }:
+		<-finished
+		return true
+	case <-s.done:
+		return false
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/pubsub"
+	"github.com/whisper-project/server.golang/speech"
+)
+
+// These tests are meant to be run with -race.
+
+func TestSessionStress(t *testing.T) {
+	s, _ := newTestSession(t, "test-stress")
+	if err := s.AddWhisperer("w", "profile-w", "Whisperer"); err != nil {
+		t.Fatalf("AddWhisperer() failed: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientId := fmt.Sprintf("l%d", i)
+			for range 20 {
+				_ = s.AddListenerRequest(clientId, "profile-"+clientId, clientId)
+				_ = s.Requesters()
+				_ = s.AddListener(clientId, "profile-"+clientId, clientId)
+				s.sr <- pubsub.ClientStatus{ClientId: clientId, IsOnline: true}
+				_ = s.NegotiateOffsetUnit(clientId, "runes")
+				_ = s.Participants()
+				_ = s.RemoveClient(clientId)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 200 {
+			chunk := protocol.ContentChunk{Offset: 0, Text: fmt.Sprintf("line %d", i)}
+			s.cr <- protocol.ContentPacket{PacketId: uuid.NewString(), ClientId: "w", Data: chunk.String()}
+			if i%10 == 9 {
+				chunk = protocol.ContentChunk{Offset: protocol.CoNewline}
+				s.cr <- protocol.ContentPacket{PacketId: uuid.NewString(), ClientId: "w", Data: chunk.String()}
+			}
+		}
+	}()
+	wg.Wait()
+	if participants := s.Participants(); len(participants) != 1 || participants[0].ClientId != "w" {
+		t.Errorf("expected only the whisperer to remain, got %v", participants)
+	}
+}
+
+func TestSessionStressWithEnd(t *testing.T) {
+	s, ps := newTestSession(t, "test-stress-end")
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientId := fmt.Sprintf("l%d", i)
+			for {
+				err := s.AddListener(clientId, "profile-"+clientId, clientId)
+				if errors.Is(err, EndedError) {
+					return
+				}
+				s.cr <- protocol.ContentPacket{PacketId: uuid.NewString(), ClientId: clientId, Data: "0|hi"}
+				_ = s.RemoveClient(clientId)
+			}
+		}()
+	}
+	s.End()
+	wg.Wait()
+	if err := s.AddWhisperer("w", "profile-w", "Whisperer"); !errors.Is(err, EndedError) {
+		t.Errorf("AddWhisperer() after end failed, got %v, want %v", err, EndedError)
+	}
+	if participants := s.Participants(); participants != nil {
+		t.Errorf("Participants() after end failed, got %v", participants)
+	}
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+	if len(ps.broadcasts) == 0 || !protocol.IsEndPacket(ps.broadcasts[len(ps.broadcasts)-1]) {
+		t.Errorf("the last broadcast wasn't the end of the session: %v", ps.broadcasts)
+	}
+}
+
+func TestRegistryStress(t *testing.T) {
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				id := fmt.Sprintf("test-registry-%d", j%5)
+				s := newSession(id, newTestPubsub(), speech.NewMockManager())
+				registered, found := registerSession(s)
+				if !found {
+					close(s.started)
+				}
+				_ = findSession(id)
+				_ = runningSessions()
+				if j%7 == 0 {
+					unregisterSession(registered)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, s := range runningSessions() {
+		unregisterSession(s)
+	}
+	if len(runningSessions()) != 0 {
+		t.Errorf("sessions remain in the registry after unregistering them all")
+	}
+}
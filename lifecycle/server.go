@@ -31,8 +31,13 @@ func Startup(router *gin.Engine, hostPort string) {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// Resume listening to suspended conversations left from the last server instance
-	go StartAllSuspendedSessions()
+	// Resume listening to suspended conversations left by other server instances,
+	// resume the sessions of any instances that died without suspending them,
+	// and save the transcripts of any sessions that were lost in a crash
+	go KeepAlive(ctx)
+	go ResumeHandoffs(ctx)
+	go ResumeOrphanedSessions(ctx)
+	go RecoverTranscripts()
 
 	// Run the server in a goroutine so that this instance survives it
 	running := true
@@ -77,6 +82,7 @@ func Shutdown(withoutSuspend bool) {
 		sLog().Info("terminating all sessions")
 		count := EndAllSessions()
 		sLog().Info("terminated all sessions", zap.Int("session count", count))
+		ably.Close()
 		return
 	}
 	sLog().Info("suspending all sessions")
@@ -84,6 +90,7 @@ func Shutdown(withoutSuspend bool) {
 	go ShutdownAllSessions(notify)
 	count := <-notify
 	sLog().Info("suspended all sessions", zap.Int("session count", count))
+	ably.Close()
 }
 
 func CreateEngine() (*gin.Engine, error) {
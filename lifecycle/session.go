@@ -9,9 +9,8 @@ package lifecycle
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
-	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,50 +27,138 @@ import (
 var (
 	ably                = pubsub.NewAblyManager()
 	mock                = speech.NewMockManager()
-	sessions            = make(map[string]*Session)
 	AlreadyPresentError = fmt.Errorf("already present")
 	NotPresentError     = fmt.Errorf("not present")
+	EndedError          = fmt.Errorf("session has ended")
 )
 
-// A Session is one continuous instance of a conversation with a single
-// Whisperer and multiple Listeners.
+// A Session is one continuous instance of a conversation with one or
+// more Whisperers and multiple Listeners.
 type Session struct {
-	Id           string // the conversation ID this is a session for
-	Pubsub       pubsub.Manager
-	speech       speech.Manager
-	state        *storage.SessionState
-	cr           protocol.ContentReceiver
-	sr           pubsub.StatusReceiver
-	cancel       context.CancelFunc
-	livePackets  []protocol.ContentPacket
-	liveText     string
-	overlap      []protocol.ContentChunk
-	shuttingDown bool
-	transcriptId string
+	Id             string // the conversation ID this is a session for
+	Pubsub         pubsub.Manager
+	speech         speech.Manager
+	state          *storage.SessionState
+	cr             protocol.ContentReceiver
+	sr             pubsub.StatusReceiver
+	cancel         context.CancelFunc
+	live           map[string]*liveTrack // each whisperer's live text, by client ID
+	overlap        []protocol.ContentChunk
+	sequences      map[string]int  // last content sequence number from each client
+	resyncing      map[string]bool // clients asked to resend their live text
+	clientRates    map[string]*clientRates
+	rates          *contentRates
+	shuttingDown   bool
+	encoding       protocol.Encoding // what participants send content in; empty means text
+	commands       chan func()       // run by the event loop
+	done           chan struct{}     // closed when the event loop stops
+	started        chan struct{}     // closed when the session has started, or failed to
+	startErr       error
+	attached       bool                  // whether pubsub content has started arriving
+	checkIds       map[string]bool       // packets that may have been processed by the prior server
+	checkCount     int                   // how many more packets to check against them
+	lastContent    time.Time             // when content was last received
+	whispererSeen  time.Time             // when a whisperer was last known to be online
+	warnedDeadline time.Time             // the idle deadline participants were last warned of
+	lease          *storage.SessionLease // this instance's ownership of the session, if leased
+	banned         map[string]bool       // profiles banned from the conversation
+	dirty          bool                  // whether the state has changed since the last snapshot
+	snapshots      snapshotWriter
+}
+
+func newSession(id string, ps pubsub.Manager, sm speech.Manager) *Session {
+	return &Session{
+		Id:            id,
+		Pubsub:        ps,
+		speech:        sm,
+		cr:            make(protocol.ContentReceiver, 1024), // never stall
+		sr:            make(pubsub.StatusReceiver, 1024),    // never stall
+		live:          make(map[string]*liveTrack),
+		sequences:     make(map[string]int),
+		resyncing:     make(map[string]bool),
+		clientRates:   make(map[string]*clientRates),
+		rates:         newContentRates(),
+		banned:        make(map[string]bool),
+		commands:      make(chan func()),
+		done:          make(chan struct{}),
+		started:       make(chan struct{}),
+		lastContent:   time.Now(),
+		whispererSeen: time.Now(),
+	}
 }
 
 // AuthenticateParticipant gets an appropriate pubsub token for a client.
 // If it returns a nil token then the client cannot authenticate against the session.
-func AuthenticateParticipant(conversationId, clientId string) (json.RawMessage, error) {
-	s, ok := sessions[conversationId]
+// If the session's content is encrypted, it also returns the content key.
+func AuthenticateParticipant(conversationId, clientId string) (json.RawMessage, []byte, error) {
+	s, err := FindSession(conversationId)
+	if s == nil {
+		return nil, nil, err
+	}
+	var tok json.RawMessage
+	var key []byte
+	ok := s.query(func() {
+		if tok, err = s.Pubsub.ClientToken(conversationId, clientId); err != nil {
+			sLog().Error("ably client token failure",
+				zap.String("sessionId", conversationId), zap.String("clientId", clientId),
+				zap.Error(err))
+			return
+		}
+		// waiting listeners get a token, but they don't get the key
+		if _, admitted := s.state.Participants[clientId]; tok != nil && admitted && s.state.Encrypted {
+			key = s.state.ContentKey
+		}
+	})
 	if !ok {
-		return nil, nil
+		return nil, nil, nil
 	}
-	tok, err := s.Pubsub.ClientToken(conversationId, clientId)
-	if err != nil {
-		sLog().Error("ably client token failure",
-			zap.String("sessionId", conversationId), zap.String("clientId", clientId),
-			zap.Error(err))
+	return tok, key, err
+}
+
+// FindSession returns the running session for the given conversation,
+// or nil if there isn't one. If the session is owned by another server
+// instance, it returns an OwnedElsewhereError.
+func FindSession(conversationId string) (*Session, error) {
+	if s := findSession(conversationId); s != nil {
+		return s, nil
+	}
+	l, err := SessionOwner(conversationId)
+	if err != nil || l == nil {
 		return nil, err
 	}
-	return tok, nil
+	return nil, OwnedElsewhereError{Lease: *l}
 }
 
 // GetSession finds or creates a Session for the given conversation.
+// If the session is being started by another request, it waits for
+// that start to finish. If the session is owned by another server
+// instance, it returns an OwnedElsewhereError.
 func GetSession(conversationId string) (*Session, error) {
-	if s, ok := sessions[conversationId]; ok {
+	s, found := registerSession(newSession(conversationId, ably, mock))
+	if found {
+		if !s.ready() {
+			return nil, s.startErr
+		}
 		return s, nil
 	}
+	s.startErr = s.start()
+	close(s.started)
+	if s.startErr != nil {
+		var owned OwnedElsewhereError
+		if errors.As(s.startErr, &owned) {
+			sLog().Info("session owned elsewhere",
+				zap.String("sessionId", conversationId), zap.String("owner", owned.Lease.Owner))
+		} else {
+			sLog().Error("session start failure",
+				zap.String("sessionId", conversationId), zap.Error(s.startErr))
+		}
+		unregisterSession(s)
+		return nil, s.startErr
+	}
+	return s, nil
+}
+
+func loadSessionState(conversationId string) (*storage.SessionState, error) {
 	state, err := storage.SuspendedSessionState(conversationId)
 	if err != nil {
 		sLog().Error("session get suspended state failure",
@@ -79,83 +166,67 @@ func GetSession(conversationId string) (*Session, error) {
 		return nil, err
 	}
 	if state == nil {
-		state = storage.NewSessionState(conversationId)
-	}
-	s := &Session{
-		Id:     conversationId,
-		Pubsub: ably,
-		speech: mock,
-		state:  state,
-		cr:     make(protocol.ContentReceiver, 1024), // never stall
-		sr:     make(pubsub.StatusReceiver, 1024),    // never stall
-	}
-	if err = s.start(); err != nil {
-		sLog().Error("session start failure",
-			zap.String("sessionId", conversationId), zap.Error(err))
+		return newSessionState(conversationId)
+	}
+	return state, nil
+}
+
+func newSessionState(conversationId string) (*storage.SessionState, error) {
+	state := storage.NewSessionState(conversationId)
+	conversation, err := storage.GetConversation(conversationId)
+	if err != nil {
 		return nil, err
 	}
-	sessions[conversationId] = s
-	return s, nil
+	if conversation != nil && conversation.Encrypted {
+		if state.ContentKey, err = protocol.NewContentKey(); err != nil {
+			sLog().Error("session content key failure",
+				zap.String("sessionId", conversationId), zap.Error(err))
+			return nil, err
+		}
+		state.Encrypted = true
+	}
+	if conversation != nil && conversation.Transcribed && !state.Encrypted {
+		startTranscript(state)
+	}
+	return state, nil
 }
 
 // EndAllSessions force terminates all current conversation sessions.
 func EndAllSessions() int {
-	count := len(sessions)
-	for _, s := range sessions {
+	running := runningSessions()
+	for _, s := range running {
 		s.End()
 	}
-	return count
+	return len(running)
 }
 
 // ShutdownAllSessions gets all running sessions ready for handoff to a new server instance.
 // It's meant to be invoked as a goroutine.
 // When it's finished it notifies with the number of sessions that were shut down.
 func ShutdownAllSessions(notify chan int) {
-	count := len(sessions)
+	running := runningSessions()
+	count := len(running)
 	if count == 0 {
 		notify <- 0
 		return
 	}
 	completed := make(chan string, count)
-	for _, s := range sessions {
+	for _, s := range running {
 		s.Shutdown(completed)
 	}
+	suspended := 0
 	for done := 0; done < count; done++ {
 		id := <-completed
-		if err := storage.SuspendSession(id); err != nil {
-			sLog().Error("suspend session failure", zap.String("sessionId", id), zap.Error(err))
-		}
-	}
-	notify <- count
-}
-
-// StartAllSuspendedSessions gets all suspended sessions running in this server instance.
-// It's meant to be invoked as a goroutine, and stops when there are no more suspended sessions.
-func StartAllSuspendedSessions() {
-	timeout := 30 * time.Second
-	for {
-		id, err := storage.WaitForSuspendedSession(timeout)
-		if err != nil {
-			sLog().Error("retrieve suspended session failure", zap.Error(err))
-			return
-		}
 		if id == "" {
-			// timeout
-			return
-		}
-		if _, err = GetSession(id); err != nil {
-			sLog().Error("resume session first failure", zap.String("sessionId", id), zap.Error(err))
+			// the session ended before it could be shut down
+			continue
 		}
-		if _, err = GetSession(id); err != nil {
-			sLog().Error("resume session second failure", zap.String("sessionId", id), zap.Error(err))
-			sLog().Info("giving up on starting suspended sessions")
-		}
-		err = storage.RemoveSuspendedSession(id)
-		if err != nil {
-			sLog().Error("remove suspended session failure", zap.String("sessionId", id), zap.Error(err))
-			sLog().Info("giving up on starting suspended sessions")
+		if err := storage.SuspendSession(id); err != nil {
+			sLog().Error("suspend session failure", zap.String("sessionId", id), zap.Error(err))
 		}
+		suspended++
 	}
+	notify <- suspended
 }
 
 // Shutdown gets a session ready for handoff to a new server instance
@@ -165,29 +236,47 @@ func StartAllSuspendedSessions() {
 // listening and saving content packets for 10 seconds to give the next
 // server time to start up and resume the session. It notifies the session ID
 // on the argument channel when the 10 seconds have passed and the server
-// can finish shutting down.
+// can finish shutting down, or notifies an empty ID if the session has ended.
 func (s *Session) Shutdown(notify chan string) {
-	s.shuttingDown = true
-	delete(sessions, s.Id)
+	unregisterSession(s)
+	if !s.do(func() { s.shuttingDown = true }) {
+		notify <- ""
+		return
+	}
 	go func() {
-		time.Sleep(10 * time.Second)
+		time.Sleep(shutdownHandoffDelay)
 		s.cancel()
+		<-s.done
 		if err := s.Pubsub.EndSession(s.Id); err != nil {
 			sLog().Error("ably session end failure", zap.String("sessionId", s.Id), zap.Error(err))
 		}
 		if err := storage.SuspendSessionState(s.state); err != nil {
 			sLog().Error("session suspend failure", zap.String("sessionId", s.Id), zap.Error(err))
+		} else {
+			s.dropSnapshot()
 		}
+		s.releaseLease()
+		s.observe(Event{Kind: EventSessionSuspended})
 		notify <- s.Id
 	}()
 }
 
+// shutdownHandoffDelay is how long a shutting down session keeps saving
+// content packets for the server that will resume it.
+var shutdownHandoffDelay = 10 * time.Second
+
 // End terminates a session at the request of the Whisperer. All
 // participants are notified that the session is ending, and then the
 // session is destroyed. If the session is being transcribed, then
 // the transcript is finalized and saved and its ID is returned.
 func (s *Session) End() string {
-	delete(sessions, s.Id)
+	unregisterSession(s)
+	var transcriptId string
+	s.do(func() { transcriptId = s.end() })
+	return transcriptId
+}
+
+func (s *Session) end() string {
 	s.state.EndedAt = time.Now().UnixMilli()
 	if err := s.Pubsub.Broadcast(s.Id, protocol.EndPacket()); err != nil {
 		sLog().Error("ably broadcast failure on end of session",
@@ -198,71 +287,198 @@ func (s *Session) End() string {
 		sLog().Error("ably session end failure",
 			zap.String("sessionId", s.Id), zap.Error(err))
 	}
-	if err := s.saveTranscript(); err != nil {
-		sLog().Error("session save transcript failure",
-			zap.String("sessionId", s.Id), zap.Error(err))
+	transcriptId := s.state.TranscriptId
+	if transcriptId != "" {
+		if !s.holdsLease() {
+			sLog().Warn("session lease lost, not saving transcript", zap.String("sessionId", s.Id))
+			transcriptId = ""
+		} else if err := s.saveTranscript(); err != nil {
+			sLog().Error("session save transcript failure",
+				zap.String("sessionId", s.Id), zap.Error(err))
+			transcriptId = ""
+		}
 	}
-	return s.transcriptId
+	s.dropSnapshot()
+	s.releaseLease()
+	s.observe(Event{Kind: EventSessionEnded, TranscriptId: transcriptId})
+	return transcriptId
 }
 
 // AddWhisperer adds the client to the session as a Whisperer.
 func (s *Session) AddWhisperer(clientId string, profileId string, name string) error {
-	defer s.notifyNeedsAuth()
-	return s.newParticipant(clientId, profileId, name, true)
+	err := EndedError
+	s.do(func() {
+		defer s.notifyNeedsAuth()
+		err = s.newParticipant(clientId, profileId, name, true)
+	})
+	return err
+}
+
+// NegotiateOffsetUnit records the unit a participant counts content offsets in,
+// and returns the unit that will be used. Participants who ask for a unit the
+// server doesn't know get the default unit.
+func (s *Session) NegotiateOffsetUnit(clientId, requested string) protocol.OffsetUnit {
+	unit, known := protocol.ParseOffsetUnit(requested)
+	if !known && requested != "" {
+		sLog().Info("unknown offset unit requested",
+			zap.String("sessionId", s.Id), zap.String("clientId", clientId),
+			zap.String("requested", requested))
+	}
+	s.do(func() {
+		if p, ok := s.state.Participants[clientId]; ok {
+			p.OffsetUnit = unit
+		}
+	})
+	return unit
+}
+
+// offsetUnit is the unit that the given client counts content offsets in.
+func (s *Session) offsetUnit(clientId string) protocol.OffsetUnit {
+	if p, ok := s.state.Participants[clientId]; ok && p.OffsetUnit != "" {
+		return p.OffsetUnit
+	}
+	return protocol.DefaultOffsetUnit
 }
 
 // AddListener adds the client to the session as a Listener
 func (s *Session) AddListener(clientId, profileId, name string) error {
-	// if this client was waiting, they are now approved
-	for i, p := range s.state.Waitlist {
-		if p.ClientId == clientId {
-			s.state.Waitlist = append(s.state.Waitlist[:i], s.state.Waitlist[i+1:]...)
-			break
+	err := EndedError
+	s.do(func() {
+		if s.banned[profileId] {
+			err = BannedError
+			return
 		}
-	}
-	return s.newParticipant(clientId, profileId, name, false)
+		// if this client was waiting, they are now approved
+		s.takeWaiting(clientId)
+		err = s.newParticipant(clientId, profileId, name, false)
+	})
+	return err
 }
 
 // AddListenerRequest asks the Whisperer to admit a Listener
 func (s *Session) AddListenerRequest(clientId, profileId, name string) error {
-	for _, p := range s.state.Waitlist {
+	err := EndedError
+	s.do(func() {
+		if s.banned[profileId] {
+			err = BannedError
+			return
+		}
+		for _, p := range s.state.Waitlist {
+			if p.ClientId == clientId {
+				err = AlreadyPresentError
+				return
+			}
+		}
+		// waiting listeners can hear control packets, so they can be told when they're admitted
+		if _, err = s.Pubsub.AddWaitLister(s.Id, clientId); err != nil {
+			sLog().Error("ably add wait lister failure",
+				zap.String("sessionId", s.Id), zap.String("clientId", clientId), zap.Error(err))
+			return
+		}
+		w := storage.NewParticipant(clientId, profileId, name, false)
+		s.state.Waitlist = append(s.state.Waitlist, w)
+		s.updateEncoding()
+		s.observeParticipant(EventWaitlistRequest, w)
+		s.notifyNeedsAuth()
+	})
+	return err
+}
+
+// ApproveListener admits a waiting listener to the session, and tells them so.
+// It returns the admitted listener.
+func (s *Session) ApproveListener(clientId string) (storage.Participant, error) {
+	var approved storage.Participant
+	err := EndedError
+	s.do(func() {
+		w := s.takeWaiting(clientId)
+		if w == nil {
+			err = NotPresentError
+			return
+		}
+		if err = s.newParticipant(w.ClientId, w.ProfileId, w.Name, false); err != nil {
+			return
+		}
+		approved = *s.state.Participants[clientId]
+		s.sendControl(clientId, protocol.ListenApprovedPacket())
+		s.broadcastControl(protocol.ParticipantsChangedPacket())
+	})
+	return approved, err
+}
+
+// DenyListener turns away a waiting listener, and tells them so.
+func (s *Session) DenyListener(clientId string) error {
+	err := EndedError
+	s.do(func() {
+		if s.takeWaiting(clientId) == nil {
+			err = NotPresentError
+			return
+		}
+		s.sendControl(clientId, protocol.ListenDeniedPacket())
+		err = s.Pubsub.RemoveClient(s.Id, clientId)
+		if err != nil {
+			sLog().Error("ably remove client failure",
+				zap.String("sessionId", s.Id), zap.String("clientId", clientId), zap.Error(err))
+		}
+	})
+	return err
+}
+
+// takeWaiting removes a client from the waitlist, and returns it
+// if it was there.
+func (s *Session) takeWaiting(clientId string) *storage.Participant {
+	for i, p := range s.state.Waitlist {
 		if p.ClientId == clientId {
-			return AlreadyPresentError
+			s.state.Waitlist = append(s.state.Waitlist[:i], s.state.Waitlist[i+1:]...)
+			s.updateEncoding()
+			return p
 		}
 	}
-	s.state.Waitlist = append(s.state.Waitlist, storage.NewParticipant(clientId, profileId, name, false))
-	s.notifyNeedsAuth()
 	return nil
 }
 
 // Participants returns the list of current participants
 func (s *Session) Participants() []storage.Participant {
-	participants := make([]storage.Participant, 0, len(s.state.Participants))
-	for _, p := range s.state.Participants {
-		participants = append(participants, *p)
-	}
+	var participants []storage.Participant
+	s.query(func() {
+		participants = make([]storage.Participant, 0, len(s.state.Participants))
+		for _, p := range s.state.Participants {
+			participants = append(participants, *p)
+		}
+	})
 	return participants
 }
 
 // Requesters return the list of those who have asked to be allowed to join
 func (s *Session) Requesters() []storage.Participant {
-	requestors := make([]storage.Participant, 0, len(s.state.Waitlist))
-	for _, p := range s.state.Waitlist {
-		requestors = append(requestors, *p)
-	}
+	var requestors []storage.Participant
+	s.query(func() {
+		requestors = make([]storage.Participant, 0, len(s.state.Waitlist))
+		for _, p := range s.state.Waitlist {
+			requestors = append(requestors, *p)
+		}
+	})
 	return requestors
 }
 
 // RemoveClient removes the client from the session.
 func (s *Session) RemoveClient(clientId string) error {
-	if _, ok := s.state.Participants[clientId]; !ok {
-		for i, p := range s.state.Waitlist {
-			if p.ClientId == clientId {
-				s.state.Waitlist = append(s.state.Waitlist[:i], s.state.Waitlist[i+1:]...)
-				return nil
-			}
+	err := EndedError
+	s.do(func() { err = s.removeClient(clientId) })
+	return err
+}
+
+func (s *Session) removeClient(clientId string) error {
+	p, ok := s.state.Participants[clientId]
+	if !ok {
+		if s.takeWaiting(clientId) == nil {
+			return NotPresentError
 		}
-		return NotPresentError
+		if err := s.Pubsub.RemoveClient(s.Id, clientId); err != nil {
+			sLog().Error("ably remove client failure",
+				zap.String("sessionId", s.Id), zap.String("clientId", clientId),
+				zap.Error(err))
+		}
+		return nil
 	}
 	if err := s.Pubsub.RemoveClient(s.Id, clientId); err != nil {
 		sLog().Error("ably remove client failure",
@@ -271,26 +487,60 @@ func (s *Session) RemoveClient(clientId string) error {
 		return err
 	}
 	delete(s.state.Participants, clientId)
+	s.observeParticipant(EventParticipantLeft, p)
+	s.updateEncoding()
 	return nil
 }
 
-// Transcribe marks a session for transcription, and returns the ID
-// of the transcription.
-func (s *Session) Transcribe() string {
-	s.transcriptId = uuid.NewString()
-	return s.transcriptId
-}
-
-func (s *Session) start() error {
+// start takes ownership of the session, loads its state, starts its
+// pubsub session, and then starts its event loop.
+func (s *Session) start() (err error) {
+	if err = s.acquireLease(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			s.releaseLease()
+		}
+	}()
+	state, err := loadSessionState(s.Id)
+	if err != nil {
+		return err
+	}
+	s.state = state
+	if err = s.loadBans(); err != nil {
+		return err
+	}
 	if err := s.Pubsub.StartSession(s.Id, s.cr, s.sr); err != nil {
 		sLog().Error("ably start session failure",
 			zap.String("sessionId", s.Id), zap.Error(err))
 		return err
 	}
+	if err := s.addStateParticipants(); err != nil {
+		if err := s.Pubsub.EndSession(s.Id); err != nil {
+			sLog().Error("ably session end failure",
+				zap.String("sessionId", s.Id), zap.Error(err))
+		}
+		return err
+	}
+	s.notifyNeedsAuth()
+	if s.state.Encrypted {
+		s.broadcastControl(protocol.ContentEncryptedPacket())
+	}
+	s.startLoop()
+	s.observe(Event{Kind: EventSessionStarted})
+	return nil
+}
+
+func (s *Session) startLoop() {
 	ctx, cancel := context.WithCancel(context.Background())
 	s.cancel = cancel
-	go s.monitorParticipants(ctx)
-	go s.transcribeContent(ctx)
+	go s.run(ctx)
+}
+
+// addStateParticipants adds the participants in the session's
+// state (if it was resumed) to its pubsub session.
+func (s *Session) addStateParticipants() error {
 	for _, p := range s.state.Participants {
 		var err error
 		if p.IsWhisperer {
@@ -299,7 +549,6 @@ func (s *Session) start() error {
 				sLog().Error("ably add whisperer failure",
 					zap.String("sessionId", s.Id), zap.String("clientId", p.ClientId),
 					zap.Error(err))
-				cancel()
 				return err
 			}
 		} else {
@@ -308,12 +557,10 @@ func (s *Session) start() error {
 				sLog().Error("ably add listener failure",
 					zap.String("sessionId", s.Id), zap.String("clientId", p.ClientId),
 					zap.Error(err))
-				cancel()
 				return err
 			}
 		}
 	}
-	s.notifyNeedsAuth()
 	return nil
 }
 
@@ -323,6 +570,8 @@ func (s *Session) newParticipant(clientId, profileId, name string, isWhisperer b
 	}
 	p := storage.NewParticipant(clientId, profileId, name, isWhisperer)
 	s.state.Participants[clientId] = p
+	// until the new participant negotiates binary, broadcasts must be in text
+	s.updateEncoding()
 	var err error
 	var msg string
 	if isWhisperer {
@@ -338,6 +587,7 @@ func (s *Session) newParticipant(clientId, profileId, name string, isWhisperer b
 			zap.Error(err))
 		return err
 	}
+	s.observeParticipant(EventParticipantJoined, p)
 	return nil
 }
 
@@ -345,88 +595,103 @@ func (s *Session) notifyNeedsAuth() {
 	if len(s.state.Waitlist) > 0 {
 		for _, p := range s.state.Participants {
 			if p.IsWhisperer && p.IsOnline {
-				packet := protocol.RequestsPendingPacket()
-				if err := s.Pubsub.Send(s.Id, "whisperer", packet); err != nil {
-					sLog().Error("ably send failure to Whisperer",
-						zap.String("sessionId", s.Id), zap.String("clientId", "whisperer"),
-						zap.String("packet", packet), zap.Error(err))
-				}
-				break
+				s.sendControl(p.ClientId, protocol.RequestsPendingPacket())
 			}
 		}
 	}
 }
 
-func (s *Session) monitorParticipants(ctx context.Context) {
-	slog.Info("monitoring participants started", zap.String("sessionId", s.Id))
-	for {
-		select {
-		case <-ctx.Done():
-			slog.Info("monitoring participants stopped", zap.String("sessionId", s.Id))
-			return
-		case status := <-s.sr:
-			p, ok := s.state.Participants[status.ClientId]
-			if !ok {
-				continue
-			}
-			p.IsOnline = status.IsOnline
-			if p.IsWhisperer && status.IsOnline {
-				s.notifyNeedsAuth()
-			}
-			packet := protocol.ParticipantsChangedPacket()
-			if err := s.Pubsub.Broadcast(s.Id, packet); err != nil {
-				sLog().Error("ably broadcast failure",
-					zap.String("sessionId", s.Id),
-					zap.String("packet", packet), zap.Error(err))
-			}
+// applyStatus updates a participant from its pubsub status,
+// and acts on any control packet it announced.
+func (s *Session) applyStatus(status pubsub.ClientStatus) {
+	p, ok := s.state.Participants[status.ClientId]
+	if !ok {
+		return
+	}
+	wasOnline := p.IsOnline
+	p.IsOnline = status.IsOnline
+	if status.IsOnline && !wasOnline {
+		// a client that reconnects, or restarts, numbers its chunks from 1 again
+		delete(s.sequences, p.ClientId)
+	}
+	if wasOnline != p.IsOnline {
+		s.observeParticipant(EventParticipantOnline, p)
+	}
+	admitted := true
+	if isHello, _ := protocol.IsHelloPacket(status.Control); isHello {
+		admitted = s.handshake(p, status.Control)
+	} else if status.IsOnline && !wasOnline && p.Version == 0 {
+		// clients announce themselves as they come online, so one
+		// that doesn't speaks the legacy protocol, with no features
+		admitted = s.admit(p, protocol.LegacyCapabilities)
+	}
+	if admitted {
+		if p.IsWhisperer && status.IsOnline {
+			s.notifyNeedsAuth()
+		}
+		if s.state.Encrypted && status.IsOnline {
+			s.sendControl(p.ClientId, protocol.ContentEncryptedPacket())
+		}
+		if s.state.TranscriptId != "" && status.IsOnline && !wasOnline {
+			s.sendControl(p.ClientId, protocol.RecordingPacket(true))
+		}
+		// listeners are caught up when they join, or when they ask
+		if !p.IsWhisperer && status.IsOnline &&
+			(!wasOnline || protocol.IsRequestCatchUpPacket(status.Control)) {
+			s.sendCatchUp(p.ClientId)
 		}
 	}
+	s.updateEncoding()
+	s.broadcastControl(protocol.ParticipantsChangedPacket())
 }
 
-func (s *Session) transcribeContent(ctx context.Context) {
-	slog.Info("transcribing content started", zap.String("sessionId", s.Id))
-	// wait for the first packet, which always comes as soon as pubsub is online
-	<-s.cr
-	// process the packets received by the prior server before our time of attach
-	processedIds := s.processSuspendedPackets()
-	packetsToCheck := len(processedIds)
-	for {
-		select {
-		case <-ctx.Done():
-			if s.shuttingDown {
-				slog.Info("saving live packets at shutdown", zap.String("sessionId", s.Id))
-				if len(s.livePackets) > 0 {
-					if err := storage.SuspendSessionPackets(s.Id, s.livePackets...); err != nil {
-						sLog().Error("error saving suspended packets",
-							zap.String("sessionId", s.Id), zap.Error(err))
-					}
-				}
+// receiveContent handles a content packet from pubsub. The first packet
+// is a marker that comes as soon as pubsub is attached, and is the signal
+// to process the packets received by the prior server before our time of attach.
+func (s *Session) receiveContent(packet protocol.ContentPacket) {
+	if !s.attached {
+		s.attached = true
+		s.checkIds = s.processSuspendedPackets()
+		s.checkCount = len(s.checkIds)
+		return
+	}
+	if s.shuttingDown {
+		// if we're shutting down, leave all packets for the next server
+		track := s.liveOf(packet.ClientId)
+		track.packets = append(track.packets, packet)
+		if err := storage.SuspendSessionPackets(s.Id, s.livePackets()...); err != nil {
+			sLog().Error("error saving suspended packets",
+				zap.String("sessionId", s.Id), zap.Error(err))
+		} else {
+			for _, track := range s.live {
+				track.packets = nil
 			}
-			slog.Info("transcribing content stopped", zap.String("sessionId", s.Id))
+		}
+		return
+	}
+	if s.checkCount > 0 {
+		// if we've just started up, make sure we don't process a packet
+		// that may also have been received and saved by the prior server
+		s.checkCount--
+		if s.checkIds[packet.PacketId] {
 			return
-		case packet := <-s.cr:
-			if s.shuttingDown {
-				// if we're shutting down, leave all packets for the next server
-				s.livePackets = append(s.livePackets, packet)
-				if err := storage.SuspendSessionPackets(s.Id, s.livePackets...); err != nil {
-					sLog().Error("error saving suspended packets",
-						zap.String("sessionId", s.Id), zap.Error(err))
-				} else {
-					s.livePackets = nil
-				}
-				continue
-			}
-			if packetsToCheck > 0 {
-				// if we've just started up, make sure we don't process a packet
-				// that may also have been received and saved by the prior server
-				packetsToCheck--
-				if processedIds[packet.PacketId] {
-					continue
-				}
-			}
-			s.transcribeOnePacket(packet)
 		}
 	}
+	if p, ok := s.state.Participants[packet.ClientId]; !ok || !p.IsWhisperer {
+		// a demoted whisperer can publish until its token is revoked
+		sLog().Info("dropping content from a participant who isn't a whisperer",
+			zap.String("sessionId", s.Id), zap.String("clientId", packet.ClientId))
+		return
+	}
+	if !s.admitContent(packet) {
+		return
+	}
+	s.lastContent = time.Now()
+	if s.state.Encrypted {
+		s.holdEncryptedPacket(packet)
+		return
+	}
+	s.transcribeOnePacket(packet)
 }
 
 func (s *Session) processSuspendedPackets() (packetIds map[string]bool) {
@@ -444,50 +709,174 @@ func (s *Session) processSuspendedPackets() (packetIds map[string]bool) {
 }
 
 func (s *Session) transcribeOnePacket(packet protocol.ContentPacket) {
-	live, past := protocol.ProcessLiveChunk(s.liveText, protocol.ParseContentChunk(packet.Data))
+	chunk := protocol.ParseContentChunk(packet.Data)
+	if !s.isInSync(packet.ClientId, chunk) {
+		chunk = protocol.ContentChunk{Offset: protocol.CoIgnore, Text: chunk.Text}
+	}
+	if chunk.IsRich() && !s.supports(packet.ClientId, protocol.FeatureRichContent) {
+		sLog().Info("ignoring rich content from client without the feature",
+			zap.String("sessionId", s.Id), zap.String("clientId", packet.ClientId),
+			zap.String("chunk", chunk.DebugString()))
+		return
+	}
+	switch chunk.Offset {
+	case protocol.CoReplacePast:
+		s.correctPastText(packet, chunk)
+		return
+	case protocol.CoTypingPaused, protocol.CoReaction:
+		// these are momentary, so they aren't part of the live text
+		return
+	}
+	track := s.liveOf(packet.ClientId)
+	live, past := protocol.ProcessLiveChunk(track.text, chunk, s.offsetUnit(packet.ClientId))
 	if len(past) > 0 {
-		now := time.Now().UnixMilli()
 		for i, p := range past {
-			s.state.PastText = append(s.state.PastText, storage.PastTextLine{now, p})
-			if id, err := s.speech.GenerateSpeech(p); err != nil {
-				sLog().Error("speech generation failure on past text line",
-					zap.String("sessionId", s.Id), zap.String("packetId", packet.PacketId),
-					zap.String("clientId", packet.ClientId), zap.String("text", p), zap.Error(err))
-			} else {
-				packet := protocol.PastTextSpeechIdPacket(packet.PacketId, strconv.Itoa(i), id)
-				if err := s.Pubsub.Broadcast(s.Id, packet); err != nil {
-					sLog().Error("ably broadcast failure or past text speech id",
-						zap.String("sessionId", s.Id),
-						zap.String("packet", packet), zap.Error(err))
-				}
-			}
+			s.addPastLine(s.pastLine(packet.ClientId, p))
+			s.speakPastText(packet, i, p)
 		}
 		if live == "" {
-			s.livePackets = nil
+			track.packets = nil
 		} else {
 			chunk := protocol.ContentChunk{Offset: 0, Text: live}
-			s.livePackets = []protocol.ContentPacket{
-				{uuid.NewString(), packet.ClientId, chunk.String()},
+			track.packets = []protocol.ContentPacket{
+				{PacketId: uuid.NewString(), ClientId: packet.ClientId, Data: chunk.String()},
 			}
 		}
 	} else {
-		s.livePackets = append(s.livePackets, packet)
+		track.packets = append(track.packets, packet)
+	}
+	if live != track.text {
+		s.observe(Event{Kind: EventLiveTextChanged, ClientId: packet.ClientId, Text: live})
 	}
-	s.liveText = live
+	track.text = live
+	track.updated = time.Now()
 }
 
-func (s *Session) saveTranscript() error {
-	lines := s.state.PastText
-	if s.liveText != "" {
-		lines = append(lines, storage.PastTextLine{time.Now().UnixMilli(), s.liveText})
+// pastLine makes a line of past text written by the given whisperer.
+func (s *Session) pastLine(clientId, text string) storage.PastTextLine {
+	line := storage.PastTextLine{Time: time.Now().UnixMilli(), Text: text, AuthorId: clientId}
+	if p, ok := s.state.Participants[clientId]; ok {
+		line.AuthorName = p.Name
 	}
-	t := storage.NewTranscript(s.transcriptId, s.state)
-	if err := storage.StoreTranscript(t); err != nil {
-		sLog().Error("transcript save failure",
-			zap.String("sessionId", s.Id), zap.String("transcriptId", s.transcriptId),
-			zap.Error(err))
-		return err
+	return line
+}
+
+// pastLineOf finds the line of past text that is linesBack lines from
+// the end of the given whisperer's past text, or -1 if there isn't one.
+// Lines with no author are counted as everyone's.
+func (s *Session) pastLineOf(clientId string, linesBack int) int {
+	for i := len(s.state.PastText) - 1; i >= 0; i-- {
+		if author := s.state.PastText[i].AuthorId; author == clientId || author == "" {
+			if linesBack--; linesBack == 0 {
+				return i
+			}
+		}
 	}
-	s.transcriptId = ""
-	return nil
+	return -1
+}
+
+// correctPastText applies a correction to a line of past text,
+// and generates the speech for the corrected line.
+func (s *Session) correctPastText(packet protocol.ContentPacket, chunk protocol.ContentChunk) {
+	linesBack, text, ok := chunk.Correction()
+	index := -1
+	if ok {
+		index = s.pastLineOf(packet.ClientId, linesBack)
+	}
+	if index < 0 {
+		sLog().Info("ignoring invalid past text correction",
+			zap.String("sessionId", s.Id), zap.String("clientId", packet.ClientId),
+			zap.String("chunk", chunk.DebugString()), zap.Int("pastLines", len(s.state.PastText)))
+		return
+	}
+	s.state.PastText[index].Text = text
+	s.checkpointLine(index)
+	s.observePastLine(index)
+	s.speakPastText(packet, 0, text)
+}
+
+// speakPastText generates speech for a line of past text produced by a packet,
+// and tells the participants its speech ID.
+func (s *Session) speakPastText(packet protocol.ContentPacket, line int, text string) {
+	id, err := s.speech.GenerateSpeech(text)
+	if err != nil {
+		sLog().Error("speech generation failure on past text line",
+			zap.String("sessionId", s.Id), zap.String("packetId", packet.PacketId),
+			zap.String("clientId", packet.ClientId), zap.String("text", text), zap.Error(err))
+		return
+	}
+	s.broadcastControl(protocol.PastTextSpeechIdPacket(packet.PacketId, line, id))
+}
+
+// holdEncryptedPacket keeps the most recent encrypted packets, so they
+// can be handed off with the session. Since the server can't read them,
+// it can't tell which packets make up the live text.
+func (s *Session) holdEncryptedPacket(packet protocol.ContentPacket) {
+	if !protocol.IsEncryptedContent(packet.Data) {
+		sLog().Warn("dropping unencrypted content in encrypted session",
+			zap.String("sessionId", s.Id), zap.String("clientId", packet.ClientId),
+			zap.String("packetId", packet.PacketId))
+		return
+	}
+	track := s.liveOf(packet.ClientId)
+	track.packets = append(track.packets, packet)
+	if excess := len(track.packets) - maxEncryptedPackets; excess > 0 {
+		track.packets = track.packets[excess:]
+	}
+	track.updated = time.Now()
+}
+
+// maxEncryptedPackets is how many encrypted packets are held for each whisperer.
+const maxEncryptedPackets = 500
+
+// isInSync checks whether a chunk from the given client can be applied
+// to the live text. If chunks from the client have been lost, it asks
+// the client to resend its live text, and no chunks are in sync until
+// the resent text (a chunk at offset 0) arrives.
+func (s *Session) isInSync(clientId string, chunk protocol.ContentChunk) bool {
+	if chunk.Seq > 0 {
+		last, known := s.sequences[clientId]
+		if known && chunk.Seq <= last {
+			sLog().Info("ignoring repeated content chunk",
+				zap.String("sessionId", s.Id), zap.String("clientId", clientId),
+				zap.Int("seq", chunk.Seq), zap.Int("lastSeq", last))
+			return false
+		}
+		s.sequences[clientId] = chunk.Seq
+		if known && chunk.Seq > last+1 {
+			sLog().Warn("gap in content sequence",
+				zap.String("sessionId", s.Id), zap.String("clientId", clientId),
+				zap.Int("seq", chunk.Seq), zap.Int("lastSeq", last))
+			s.requestResync(clientId)
+		}
+	}
+	if length := s.offsetUnit(clientId).Length(s.liveOf(clientId).text); chunk.Offset > length {
+		sLog().Warn("content offset beyond live text",
+			zap.String("sessionId", s.Id), zap.String("clientId", clientId),
+			zap.Int("offset", chunk.Offset), zap.Int("length", length))
+		s.requestResync(clientId)
+	}
+	if !s.resyncing[clientId] {
+		return true
+	}
+	if chunk.Offset == 0 {
+		// this is the resent live text
+		delete(s.resyncing, clientId)
+		s.broadcastControl(protocol.LiveResyncedPacket(clientId))
+		return true
+	}
+	// edits and newlines can't be applied to live text we don't have
+	return chunk.Offset < protocol.CoNewline
+}
+
+func (s *Session) requestResync(clientId string) {
+	if s.resyncing[clientId] {
+		return
+	}
+	s.resyncing[clientId] = true
+	if !s.supports(clientId, protocol.FeatureResync) {
+		// legacy clients can't resend, so wait for them to start a new line
+		return
+	}
+	s.sendControl(clientId, protocol.ResendLivePacket())
 }
@@ -5,3 +5,339 @@
  */
 
 package lifecycle
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/pubsub"
+	"github.com/whisper-project/server.golang/speech"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+func TestMain(m *testing.M) {
+	storage.ServerLogger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// testPubsub is a pubsub.Manager that records what's sent through it.
+type testPubsub struct {
+	mutex      sync.Mutex
+	sent       map[string][]string
+	broadcasts []string
+	revoked    []string
+	canWhisper map[string]bool // the pubsub roles set by the session
+}
+
+func newTestPubsub() *testPubsub {
+	return &testPubsub{sent: make(map[string][]string), canWhisper: make(map[string]bool)}
+}
+
+func (t *testPubsub) StartSession(string, protocol.ContentReceiver, pubsub.StatusReceiver) error {
+	return nil
+}
+
+func (t *testPubsub) EndSession(string) error {
+	return nil
+}
+
+func (t *testPubsub) AddWhisperer(string, string) (bool, error) {
+	return true, nil
+}
+
+func (t *testPubsub) AddListener(string, string) (bool, error) {
+	return true, nil
+}
+
+func (t *testPubsub) AddWaitLister(string, string) (bool, error) {
+	return true, nil
+}
+
+func (t *testPubsub) ClientToken(string, string) ([]byte, error) {
+	return []byte("{}"), nil
+}
+
+func (t *testPubsub) RemoveClient(string, string) error {
+	return nil
+}
+
+func (t *testPubsub) RevokeClient(_, clientId string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.revoked = append(t.revoked, clientId)
+	return nil
+}
+
+func (t *testPubsub) SetWhisperer(_, clientId string, canWhisper bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.canWhisper[clientId] = canWhisper
+	return nil
+}
+
+func (t *testPubsub) Send(_, clientId, packet string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.sent[clientId] = append(t.sent[clientId], packet)
+	return nil
+}
+
+func (t *testPubsub) Broadcast(_, packet string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.broadcasts = append(t.broadcasts, packet)
+	return nil
+}
+
+// newTestSession starts a session that's already attached to its pubsub
+// session. Tests can call the session's internal methods directly as long
+// as they do it while the session's event loop is idle.
+func newTestSession(t *testing.T, id string) (*Session, *testPubsub) {
+	ps := newTestPubsub()
+	s := newSession(id, ps, speech.NewMockManager())
+	s.state = storage.NewSessionState(id)
+	s.attached = true
+	close(s.started)
+	s.startLoop()
+	t.Cleanup(s.cancel)
+	return s, ps
+}
+
+// addTestParticipant adds a participant that announced the given features.
+func addTestParticipant(s *Session, clientId string, isWhisperer bool, features ...string) *storage.Participant {
+	p := storage.NewParticipant(clientId, "profile-"+clientId, clientId, isWhisperer)
+	p.Version, p.Features = protocol.ProtocolVersion, features
+	s.state.Participants[clientId] = p
+	return p
+}
+
+func sendChunks(s *Session, clientId string, chunks ...protocol.ContentChunk) {
+	for _, c := range chunks {
+		s.transcribeOnePacket(protocol.ContentPacket{PacketId: "p", ClientId: clientId, Data: c.String()})
+	}
+}
+
+func TestTranscribeSequenceGap(t *testing.T) {
+	s, ps := newTestSession(t, "test-gap")
+	addTestParticipant(s, "w", true, protocol.FeatureSequenced, protocol.FeatureResync)
+	sendChunks(s, "w",
+		protocol.ContentChunk{Seq: 1, Offset: 0, Text: "hel"},
+		protocol.ContentChunk{Seq: 2, Offset: 3, Text: "lo"},
+		// chunk 3 is lost
+		protocol.ContentChunk{Seq: 4, Offset: 7, Text: "ld"},
+	)
+	if s.liveOf("w").text != "hello" {
+		t.Errorf("live text after gap is %q, want %q", s.liveOf("w").text, "hello")
+	}
+	if len(ps.sent["w"]) != 1 || !protocol.IsResendLivePacket(ps.sent["w"][0]) {
+		t.Fatalf("expected one resend request, got %v", ps.sent["w"])
+	}
+	sendChunks(s, "w",
+		protocol.ContentChunk{Seq: 5, Offset: protocol.CoNewline, Text: ""},
+		protocol.ContentChunk{Seq: 6, Offset: 0, Text: "hello world"},
+	)
+	if s.liveOf("w").text != "hello world" {
+		t.Errorf("live text after resync is %q, want %q", s.liveOf("w").text, "hello world")
+	}
+	if len(s.state.PastText) != 0 {
+		t.Errorf("a newline was applied while out of sync: %v", s.state.PastText)
+	}
+	if len(ps.broadcasts) != 1 {
+		t.Fatalf("expected one resync broadcast, got %v", ps.broadcasts)
+	}
+	if ok, clientId := protocol.IsLiveResyncedPacket(ps.broadcasts[0]); !ok || clientId != "w" {
+		t.Errorf("expected a resync notice for w, got %q", ps.broadcasts[0])
+	}
+}
+
+func TestTranscribeSequenceRestart(t *testing.T) {
+	s, _ := newTestSession(t, "test-seq-restart")
+	addTestParticipant(s, "w", true, protocol.FeatureSequenced).IsOnline = true
+	sendChunks(s, "w",
+		protocol.ContentChunk{Seq: 1, Offset: 0, Text: "before"},
+		protocol.ContentChunk{Seq: 2, Offset: 6, Text: " restart"},
+	)
+	// the whisperer reconnects, and starts numbering again
+	s.applyStatus(pubsub.ClientStatus{ClientId: "w", IsOnline: false})
+	s.applyStatus(pubsub.ClientStatus{ClientId: "w", IsOnline: true})
+	sendChunks(s, "w", protocol.ContentChunk{Seq: 1, Offset: 0, Text: "after"})
+	if s.liveOf("w").text != "after" {
+		t.Errorf("live text after reconnect is %q, want %q", s.liveOf("w").text, "after")
+	}
+	// the whisperer restarts without going offline, and says hello
+	hello := protocol.HelloPacket(protocol.Capabilities{Version: protocol.ProtocolVersion, Features: []string{protocol.FeatureSequenced}})
+	s.applyStatus(pubsub.ClientStatus{ClientId: "w", IsOnline: true, Control: hello})
+	sendChunks(s, "w", protocol.ContentChunk{Seq: 1, Offset: 0, Text: "again"})
+	if s.liveOf("w").text != "again" {
+		t.Errorf("live text after restart is %q, want %q", s.liveOf("w").text, "again")
+	}
+}
+
+func TestTranscribeOffsetUnits(t *testing.T) {
+	s, _ := newTestSession(t, "test-units")
+	s.state.Participants["utf16"] = storage.NewParticipant("utf16", "p1", "Swift", true)
+	s.state.Participants["bytes"] = storage.NewParticipant("bytes", "p2", "Go", true)
+	if unit := s.NegotiateOffsetUnit("bytes", "bytes"); unit != protocol.OffsetBytes {
+		t.Errorf("negotiated unit is %q, want %q", unit, protocol.OffsetBytes)
+	}
+	if unit := s.NegotiateOffsetUnit("utf16", "graphemes"); unit != protocol.DefaultOffsetUnit {
+		t.Errorf("negotiated unknown unit is %q, want %q", unit, protocol.DefaultOffsetUnit)
+	}
+	sendChunks(s, "utf16",
+		protocol.ContentChunk{Offset: 0, Text: "🎉 café"},
+		protocol.ContentChunk{Offset: 7, Text: " au lait"},
+	)
+	if s.liveOf("utf16").text != "🎉 café au lait" {
+		t.Errorf("live text from utf16 client is %q, want %q", s.liveOf("utf16").text, "🎉 café au lait")
+	}
+	sendChunks(s, "bytes",
+		protocol.ContentChunk{Offset: 0, Text: "🎉 café"},
+		protocol.ContentChunk{Offset: 10, Text: "!"},
+	)
+	if s.liveOf("bytes").text != "🎉 café!" {
+		t.Errorf("live text from bytes client is %q, want %q", s.liveOf("bytes").text, "🎉 café!")
+	}
+}
+
+func TestTranscribeGapFromLegacyClient(t *testing.T) {
+	s, ps := newTestSession(t, "test-legacy-gap")
+	sendChunks(s, "w",
+		protocol.ContentChunk{Offset: 0, Text: "hel"},
+		protocol.ContentChunk{Offset: 7, Text: "ld"},
+		protocol.ContentChunk{Offset: 9, Text: "!"},
+	)
+	if len(ps.sent["w"]) != 0 {
+		t.Errorf("legacy client was asked to resend: %v", ps.sent["w"])
+	}
+	sendChunks(s, "w",
+		protocol.ContentChunk{Offset: protocol.CoNewline},
+		protocol.ContentChunk{Offset: 0, Text: "next"},
+	)
+	if s.liveOf("w").text != "next" {
+		t.Errorf("live text after legacy resync is %q, want %q", s.liveOf("w").text, "next")
+	}
+}
+
+func TestTranscribeRepeatedAndUnsequenced(t *testing.T) {
+	s, ps := newTestSession(t, "test-repeat")
+	sendChunks(s, "w",
+		protocol.ContentChunk{Seq: 1, Offset: 0, Text: "ab"},
+		protocol.ContentChunk{Seq: 1, Offset: 2, Text: "XX"},
+		protocol.ContentChunk{Offset: 2, Text: "c"},
+		protocol.ContentChunk{Seq: 2, Offset: 3, Text: "d"},
+	)
+	if s.liveOf("w").text != "abcd" {
+		t.Errorf("live text is %q, want %q", s.liveOf("w").text, "abcd")
+	}
+	if len(ps.sent["w"]) != 0 {
+		t.Errorf("unexpected resend requests: %v", ps.sent["w"])
+	}
+}
+
+func TestHoldEncryptedPacket(t *testing.T) {
+	s, _ := newTestSession(t, "test-encrypted")
+	key, _ := protocol.NewContentKey()
+	s.state.Encrypted, s.state.ContentKey = true, key
+	if id, err := s.StartTranscription(); !errors.Is(err, EncryptedError) {
+		t.Errorf("encrypted session accepted transcription %q", id)
+	}
+	data, err := protocol.EncryptContentChunk(key, protocol.ContentChunk{Offset: 0, Text: "secret"})
+	if err != nil {
+		t.Fatalf("encryption failed: %v", err)
+	}
+	s.holdEncryptedPacket(protocol.ContentPacket{PacketId: "p1", ClientId: "w", Data: data})
+	s.holdEncryptedPacket(protocol.ContentPacket{PacketId: "p2", ClientId: "w", Data: "0|plain"})
+	if len(s.liveOf("w").packets) != 1 || s.liveOf("w").packets[0].PacketId != "p1" {
+		t.Errorf("expected only the encrypted packet to be held, got %v", s.liveOf("w").packets)
+	}
+	if s.liveOf("w").text != "" || len(s.state.PastText) != 0 {
+		t.Errorf("encrypted content was transcribed")
+	}
+}
+
+func TestTranscribeRichContent(t *testing.T) {
+	s, ps := newTestSession(t, "test-rich")
+	addTestParticipant(s, "w", true, protocol.FeatureRichContent)
+	sendChunks(s, "w",
+		protocol.ContentChunk{Offset: 0, Text: "first lien"},
+		protocol.ContentChunk{Offset: protocol.CoNewline},
+		protocol.ContentChunk{Offset: 0, Text: "second"},
+		protocol.EmphasisChunk(0, 6),
+		protocol.TypingPausedChunk(),
+		protocol.ReactionChunk("🎉"),
+		protocol.ReplacePastChunk(1, "first line"),
+		protocol.ReplacePastChunk(2, "no such line"),
+	)
+	if len(s.state.PastText) != 1 || s.state.PastText[0].Text != "first line" {
+		t.Errorf("past text after correction is %v", s.state.PastText)
+	}
+	if s.liveOf("w").text != "second" {
+		t.Errorf("live text is %q, want %q", s.liveOf("w").text, "second")
+	}
+	if len(s.liveOf("w").packets) != 2 {
+		t.Errorf("expected the live text and its emphasis in live packets, got %v", s.liveOf("w").packets)
+	}
+	// one speech ID for the new line, and one for its correction
+	if len(ps.broadcasts) != 2 {
+		t.Errorf("expected two speech IDs, got %v", ps.broadcasts)
+	}
+}
+
+func TestTranscribeRichContentFromLegacyClient(t *testing.T) {
+	s, _ := newTestSession(t, "test-rich-legacy")
+	sendChunks(s, "w",
+		protocol.ContentChunk{Offset: 0, Text: "hello"},
+		protocol.ContentChunk{Offset: protocol.CoNewline},
+		protocol.ReplacePastChunk(1, "goodbye"),
+		protocol.HighlightChunk(0, 1),
+	)
+	if s.state.PastText[0].Text != "hello" {
+		t.Errorf("legacy client corrected past text to %q", s.state.PastText[0].Text)
+	}
+	if len(s.liveOf("w").packets) != 0 {
+		t.Errorf("legacy client's rich content went into live packets: %v", s.liveOf("w").packets)
+	}
+}
+
+func TestApproveAndDenyListeners(t *testing.T) {
+	s, ps := newTestSession(t, "test-waitlist")
+	if err := s.AddWhisperer("w", "profile-w", "Whisperer"); err != nil {
+		t.Fatalf("AddWhisperer() failed: %v", err)
+	}
+	for _, c := range []string{"l1", "l2"} {
+		if err := s.AddListenerRequest(c, "profile-"+c, c); err != nil {
+			t.Fatalf("AddListenerRequest(%q) failed: %v", c, err)
+		}
+	}
+	if requesters := s.Requesters(); len(requesters) != 2 {
+		t.Fatalf("Requesters() failed, got %v, want 2", requesters)
+	}
+	listener, err := s.ApproveListener("l1")
+	if err != nil || listener.ClientId != "l1" || listener.ProfileId != "profile-l1" {
+		t.Errorf("ApproveListener() failed, got %v, %v, want l1", listener, err)
+	}
+	if err = s.DenyListener("l2"); err != nil {
+		t.Errorf("DenyListener() failed: %v", err)
+	}
+	if !slices.ContainsFunc(ps.sent["l1"], protocol.IsListenApprovedPacket) {
+		t.Errorf("approved listener was sent %v", ps.sent["l1"])
+	}
+	if !slices.ContainsFunc(ps.sent["l2"], protocol.IsListenDeniedPacket) {
+		t.Errorf("denied listener was sent %v", ps.sent["l2"])
+	}
+	if requesters := s.Requesters(); len(requesters) != 0 {
+		t.Errorf("Requesters() failed, got %v, want none", requesters)
+	}
+	if participants := s.Participants(); len(participants) != 2 {
+		t.Errorf("Participants() failed, got %v, want whisperer and l1", participants)
+	}
+	if _, err = s.ApproveListener("l2"); !errors.Is(err, NotPresentError) {
+		t.Errorf("ApproveListener() of denied listener failed, got %v, want %v", err, NotPresentError)
+	}
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+var (
+	snapshotInterval      = 2 * time.Second  // how often changed sessions are snapshotted
+	heartbeatInterval     = 10 * time.Second // how often this server shows it's alive
+	heartbeatTTL          = 30 * time.Second // how long a server is alive without a heartbeat
+	orphanCheckInterval   = 30 * time.Second // how often to look for sessions of dead servers
+	serverRecoveryTimeout = time.Minute      // how long one server has to resume a dead server's sessions
+)
+
+// snapshotWriter saves a session's snapshots off its event loop, one at
+// a time, so the loop never waits for storage.
+type snapshotWriter struct {
+	sync.Mutex             // held while a snapshot is saved or deleted
+	busy       atomic.Bool // whether a snapshot is being saved
+	failed     atomic.Bool // whether the last snapshot failed to save
+	dropped    bool        // whether the snapshot has been deleted for good
+}
+
+// snapshot saves the session's state and live packets, if they have
+// changed, so the session can be resumed if this server dies without
+// suspending it. The state is copied on the event loop and saved on
+// another goroutine; if the last snapshot is still being saved, this
+// one waits for the next tick. Sessions that have stopped, or are being
+// suspended, aren't snapshotted. Nor are sessions without a lease,
+// because a session is only resumed once the lease of the server that
+// died has lapsed.
+func (s *Session) snapshot(ctx context.Context) {
+	if ctx.Err() != nil || s.shuttingDown || s.lease == nil {
+		return
+	}
+	if !s.dirty && !s.snapshots.failed.Load() {
+		return
+	}
+	if !s.snapshots.busy.CompareAndSwap(false, true) {
+		return
+	}
+	s.dirty = false
+	state, packets := s.state.Clone(), s.livePackets()
+	go func() {
+		defer s.snapshots.busy.Store(false)
+		s.snapshots.Lock()
+		defer s.snapshots.Unlock()
+		if s.snapshots.dropped {
+			return
+		}
+		err := storage.SaveSessionSnapshot(state, packets)
+		s.snapshots.failed.Store(err != nil)
+		if err != nil {
+			sLog().Error("session snapshot failure", zap.String("sessionId", s.Id), zap.Error(err))
+		}
+	}()
+}
+
+// dropSnapshot deletes the session's snapshot, once the session
+// has ended or been suspended. A snapshot that's being saved is
+// deleted once it's saved, and no more are saved.
+func (s *Session) dropSnapshot() {
+	if s.lease == nil {
+		return
+	}
+	s.snapshots.Lock()
+	defer s.snapshots.Unlock()
+	s.snapshots.dropped = true
+	if err := storage.DeleteSessionSnapshot(s.Id); err != nil {
+		sLog().Error("session snapshot delete failure", zap.String("sessionId", s.Id), zap.Error(err))
+	}
+}
+
+// KeepAlive maintains this server's heartbeat, which tells other servers
+// that its sessions don't need to be resumed. It's meant to be invoked
+// as a goroutine, and runs until the context is cancelled.
+func KeepAlive(ctx context.Context) {
+	var heartbeat *storage.ServerHeartbeat
+	for {
+		if heartbeat != nil {
+			if ok, err := storage.RenewServerHeartbeat(*heartbeat, heartbeatTTL); err != nil {
+				sLog().Error("server heartbeat renew failure", zap.Error(err))
+			} else if !ok {
+				sLog().Warn("server heartbeat lapsed")
+				heartbeat = nil
+			}
+		}
+		if heartbeat == nil {
+			if h, err := storage.StartServerHeartbeat(heartbeatTTL); err != nil {
+				sLog().Error("server heartbeat start failure", zap.Error(err))
+			} else {
+				heartbeat = &h
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(heartbeatInterval):
+		}
+	}
+}
+
+// ResumeOrphanedSessions resumes the sessions of servers that died without
+// suspending them. It's meant to be invoked as a goroutine, and keeps
+// looking for dead servers until the context is cancelled.
+func ResumeOrphanedSessions(ctx context.Context) {
+	for {
+		resumeOrphans()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(orphanCheckInterval):
+		}
+	}
+}
+
+// resumeOrphans hands off the sessions of every dead server, and returns
+// how many sessions it handed off.
+func resumeOrphans() int {
+	servers, err := orphanStore.KnownServerIds()
+	if err != nil {
+		sLog().Error("known servers fetch failure", zap.Error(err))
+		return 0
+	}
+	count := 0
+	for _, serverId := range servers {
+		if serverId == storage.ServerId {
+			continue
+		}
+		if alive, err := orphanStore.IsServerAlive(serverId); err != nil || alive {
+			continue
+		}
+		if ok, err := orphanStore.ClaimServerRecovery(serverId, serverRecoveryTimeout); err != nil || !ok {
+			continue
+		}
+		count += resumeServerOrphans(serverId)
+	}
+	return count
+}
+
+// resumeServerOrphans hands off the sessions of a dead server through the
+// handoff queue, just as if the server had suspended them, and returns how
+// many it handed off. Once none of its sessions are left, the server is forgotten.
+func resumeServerOrphans(serverId string) int {
+	ids, err := orphanStore.ServerSessions(serverId)
+	if err != nil {
+		sLog().Error("server sessions fetch failure", zap.String("serverId", serverId), zap.Error(err))
+		return 0
+	}
+	count, waiting := 0, 0
+	for _, id := range ids {
+		resumed, wait := resumeOrphan(serverId, id)
+		if resumed {
+			count++
+		}
+		if wait {
+			waiting++
+		} else if err := orphanStore.ForgetServerSession(serverId, id); err != nil {
+			sLog().Error("server session forget failure",
+				zap.String("serverId", serverId), zap.String("sessionId", id), zap.Error(err))
+			waiting++
+		}
+	}
+	if waiting == 0 {
+		if err := orphanStore.ForgetServer(serverId); err != nil {
+			sLog().Error("server forget failure", zap.String("serverId", serverId), zap.Error(err))
+		}
+	}
+	sLog().Info("resumed sessions of dead server", zap.String("serverId", serverId),
+		zap.Int("resumed", count), zap.Int("waiting", waiting))
+	return count
+}
+
+// resumeOrphan hands off one session of a dead server, if it still needs
+// to be. It returns whether the session was handed off, and whether it
+// should be tried again later.
+func resumeOrphan(serverId, id string) (resumed bool, wait bool) {
+	snapshot, err := orphanStore.GetSessionSnapshot(id)
+	if err != nil {
+		sLog().Error("session snapshot fetch failure", zap.String("sessionId", id), zap.Error(err))
+		return false, true
+	}
+	if snapshot == nil || snapshot.Owner != serverId {
+		// the session ended, or another server has taken it over
+		return false, false
+	}
+	l, err := orphanStore.SessionOwner(id)
+	if err != nil {
+		return false, true
+	}
+	if l != nil {
+		// until the dead server's lease lapses, the session can't be resumed
+		return false, l.Owner == serverId
+	}
+	if suspended, err := orphanStore.HasSuspendedSessionState(id); err != nil || suspended {
+		// the session is already waiting to be resumed
+		return false, err != nil
+	}
+	if err := orphanStore.SuspendSessionState(snapshot.State); err != nil {
+		sLog().Error("orphan suspend failure", zap.String("sessionId", id), zap.Error(err))
+		return false, true
+	}
+	if err := orphanStore.SuspendSessionPackets(id, snapshot.LivePackets...); err != nil {
+		sLog().Error("orphan suspend packets failure", zap.String("sessionId", id), zap.Error(err))
+	}
+	if err := orphanStore.SuspendSession(id); err != nil {
+		sLog().Error("orphan handoff failure", zap.String("sessionId", id), zap.Error(err))
+		return false, true
+	}
+	sLog().Info("handing off session of dead server",
+		zap.String("serverId", serverId), zap.String("sessionId", id),
+		zap.Int64("snapshotAt", snapshot.TakenAt))
+	return true, false
+}
+
+// orphanStorage is the storage used to resume the sessions of dead servers.
+// It's an interface so the resumption logic can be tested without a database.
+type orphanStorage interface {
+	KnownServerIds() ([]string, error)
+	IsServerAlive(serverId string) (bool, error)
+	ClaimServerRecovery(serverId string, ttl time.Duration) (bool, error)
+	ServerSessions(serverId string) ([]string, error)
+	ForgetServerSession(serverId, id string) error
+	ForgetServer(serverId string) error
+	GetSessionSnapshot(id string) (*storage.SessionSnapshot, error)
+	SessionOwner(id string) (*storage.SessionLease, error)
+	HasSuspendedSessionState(id string) (bool, error)
+	SuspendSessionState(state *storage.SessionState) error
+	SuspendSessionPackets(id string, packets ...protocol.ContentPacket) error
+	SuspendSession(id string) error
+}
+
+var orphanStore orphanStorage = databaseOrphanStorage{}
+
+// databaseOrphanStorage is the orphanStorage that servers use.
+type databaseOrphanStorage struct{}
+
+func (databaseOrphanStorage) KnownServerIds() ([]string, error) {
+	return storage.KnownServerIds()
+}
+
+func (databaseOrphanStorage) IsServerAlive(serverId string) (bool, error) {
+	return storage.IsServerAlive(serverId)
+}
+
+func (databaseOrphanStorage) ClaimServerRecovery(serverId string, ttl time.Duration) (bool, error) {
+	return storage.ClaimServerRecovery(serverId, ttl)
+}
+
+func (databaseOrphanStorage) ServerSessions(serverId string) ([]string, error) {
+	return storage.ServerSessions(serverId)
+}
+
+func (databaseOrphanStorage) ForgetServerSession(serverId, id string) error {
+	return storage.ForgetServerSession(serverId, id)
+}
+
+func (databaseOrphanStorage) ForgetServer(serverId string) error {
+	return storage.ForgetServer(serverId)
+}
+
+func (databaseOrphanStorage) GetSessionSnapshot(id string) (*storage.SessionSnapshot, error) {
+	return storage.GetSessionSnapshot(id)
+}
+
+func (databaseOrphanStorage) SessionOwner(id string) (*storage.SessionLease, error) {
+	return SessionOwner(id)
+}
+
+func (databaseOrphanStorage) HasSuspendedSessionState(id string) (bool, error) {
+	return storage.HasSuspendedSessionState(id)
+}
+
+func (databaseOrphanStorage) SuspendSessionState(state *storage.SessionState) error {
+	return storage.SuspendSessionState(state)
+}
+
+func (databaseOrphanStorage) SuspendSessionPackets(id string, packets ...protocol.ContentPacket) error {
+	return storage.SuspendSessionPackets(id, packets...)
+}
+
+func (databaseOrphanStorage) SuspendSession(id string) error {
+	return storage.SuspendSession(id)
+}
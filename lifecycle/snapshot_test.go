@@ -0,0 +1,196 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+// testOrphanStorage keeps what orphan resumption uses in memory.
+type testOrphanStorage struct {
+	alive     map[string]bool
+	claimed   map[string]bool
+	sessions  map[string][]string // server ID to session IDs
+	snapshots map[string]*storage.SessionSnapshot
+	leases    map[string]*storage.SessionLease
+	suspended map[string]*storage.SessionState
+	packets   map[string][]protocol.ContentPacket
+	handoffs  []string
+	forgotten []string
+}
+
+func newTestOrphanStorage(t *testing.T) *testOrphanStorage {
+	o := &testOrphanStorage{
+		alive:     make(map[string]bool),
+		claimed:   make(map[string]bool),
+		sessions:  make(map[string][]string),
+		snapshots: make(map[string]*storage.SessionSnapshot),
+		leases:    make(map[string]*storage.SessionLease),
+		suspended: make(map[string]*storage.SessionState),
+		packets:   make(map[string][]protocol.ContentPacket),
+	}
+	saved := orphanStore
+	orphanStore = o
+	t.Cleanup(func() { orphanStore = saved })
+	return o
+}
+
+// addSession records a session snapshotted by the given server.
+func (o *testOrphanStorage) addSession(serverId, id string, packets ...protocol.ContentPacket) {
+	o.sessions[serverId] = append(o.sessions[serverId], id)
+	o.snapshots[id] = &storage.SessionSnapshot{
+		State: storage.NewSessionState(id), LivePackets: packets, Owner: serverId, TakenAt: time.Now().UnixMilli(),
+	}
+}
+
+func (o *testOrphanStorage) KnownServerIds() ([]string, error) {
+	var ids []string
+	for id := range o.sessions {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (o *testOrphanStorage) IsServerAlive(serverId string) (bool, error) {
+	return o.alive[serverId], nil
+}
+
+func (o *testOrphanStorage) ClaimServerRecovery(serverId string, _ time.Duration) (bool, error) {
+	if o.claimed[serverId] {
+		return false, nil
+	}
+	o.claimed[serverId] = true
+	return true, nil
+}
+
+func (o *testOrphanStorage) ServerSessions(serverId string) ([]string, error) {
+	return slices.Clone(o.sessions[serverId]), nil
+}
+
+func (o *testOrphanStorage) ForgetServerSession(serverId, id string) error {
+	o.sessions[serverId] = slices.DeleteFunc(o.sessions[serverId], func(s string) bool { return s == id })
+	return nil
+}
+
+func (o *testOrphanStorage) ForgetServer(serverId string) error {
+	delete(o.sessions, serverId)
+	o.forgotten = append(o.forgotten, serverId)
+	return nil
+}
+
+func (o *testOrphanStorage) GetSessionSnapshot(id string) (*storage.SessionSnapshot, error) {
+	return o.snapshots[id], nil
+}
+
+func (o *testOrphanStorage) SessionOwner(id string) (*storage.SessionLease, error) {
+	return o.leases[id], nil
+}
+
+func (o *testOrphanStorage) HasSuspendedSessionState(id string) (bool, error) {
+	return o.suspended[id] != nil, nil
+}
+
+func (o *testOrphanStorage) SuspendSessionState(state *storage.SessionState) error {
+	o.suspended[state.Id] = state
+	return nil
+}
+
+func (o *testOrphanStorage) SuspendSessionPackets(id string, packets ...protocol.ContentPacket) error {
+	o.packets[id] = append(o.packets[id], packets...)
+	return nil
+}
+
+func (o *testOrphanStorage) SuspendSession(id string) error {
+	o.handoffs = append(o.handoffs, id)
+	return nil
+}
+
+func TestResumeOrphanOfDeadServer(t *testing.T) {
+	o := newTestOrphanStorage(t)
+	packet := protocol.ContentPacket{PacketId: "p", ClientId: "w", Data: "0|live"}
+	o.addSession("dead", "orphan", packet)
+	o.addSession("dead", "leased")
+	o.leases["leased"] = &storage.SessionLease{SessionId: "leased", Owner: "dead"}
+
+	// the session whose lease has lapsed is resumed, the other has to wait
+	if count := resumeOrphans(); count != 1 {
+		t.Errorf("resumeOrphans() failed, got %d, want 1", count)
+	}
+	if !slices.Equal(o.handoffs, []string{"orphan"}) {
+		t.Errorf("handed off sessions are %v, want [orphan]", o.handoffs)
+	}
+	if o.suspended["orphan"] == nil || !slices.Equal(o.packets["orphan"], []protocol.ContentPacket{packet}) {
+		t.Errorf("orphan wasn't suspended with its live packets: %v, %v", o.suspended["orphan"], o.packets["orphan"])
+	}
+	if !slices.Equal(o.sessions["dead"], []string{"leased"}) || len(o.forgotten) != 0 {
+		t.Errorf("dead server's sessions are %v, forgotten servers %v", o.sessions["dead"], o.forgotten)
+	}
+
+	// once its lease lapses, the other is resumed by whoever claims the server next
+	delete(o.leases, "leased")
+	delete(o.claimed, "dead")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ResumeOrphanedSessions(ctx)
+	if !slices.Equal(o.handoffs, []string{"orphan", "leased"}) {
+		t.Errorf("handed off sessions are %v, want [orphan leased]", o.handoffs)
+	}
+	if !slices.Equal(o.forgotten, []string{"dead"}) {
+		t.Errorf("forgotten servers are %v, want [dead]", o.forgotten)
+	}
+}
+
+func TestSkipOrphansOfLiveServer(t *testing.T) {
+	o := newTestOrphanStorage(t)
+	o.addSession("alive", "running")
+	o.alive["alive"] = true
+	o.addSession(storage.ServerId, "local")
+	// a dead server's session that another server has since taken over
+	o.addSession("dead", "taken")
+	o.snapshots["taken"].Owner = "other"
+
+	if count := resumeOrphans(); count != 0 {
+		t.Errorf("resumeOrphans() failed, got %d, want 0", count)
+	}
+	if len(o.handoffs) != 0 || len(o.suspended) != 0 {
+		t.Errorf("sessions were handed off: %v, %v", o.handoffs, o.suspended)
+	}
+	if o.claimed["alive"] || o.claimed[storage.ServerId] {
+		t.Errorf("live servers were claimed for recovery: %v", o.claimed)
+	}
+	if len(o.sessions["alive"]) != 1 || len(o.sessions[storage.ServerId]) != 1 {
+		t.Errorf("live servers' sessions were forgotten: %v", o.sessions)
+	}
+	if !slices.Equal(o.forgotten, []string{"dead"}) {
+		t.Errorf("forgotten servers are %v, want [dead]", o.forgotten)
+	}
+}
+
+func TestOnlyChangesNeedSnapshots(t *testing.T) {
+	s, _ := newTestSession(t, "test-snapshot-changes")
+	addTestParticipant(s, "w", true)
+	dirty := func() (d bool) {
+		s.query(func() { d = s.dirty })
+		return
+	}
+	s.query(func() { s.dirty = false })
+	s.Participants()
+	if _, err := s.TranscriptionStatus(); err != nil || dirty() {
+		t.Errorf("read-only commands marked the session as changed")
+	}
+	s.UnbanProfile("nobody")
+	if !dirty() {
+		t.Errorf("a command didn't mark the session as changed")
+	}
+}
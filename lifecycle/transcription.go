@@ -0,0 +1,197 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+var (
+	EncryptedError       = fmt.Errorf("encrypted sessions can't be transcribed")
+	NotTranscribingError = fmt.Errorf("session is not being transcribed")
+	TranscriptLeaseError = fmt.Errorf("session is no longer owned here")
+)
+
+// StartTranscription starts recording a transcript of the session, and
+// returns the transcript's ID. The transcript starts with the next line
+// of past text. If the session is already being transcribed, it returns
+// the ID of the transcript being recorded. Sessions with encrypted
+// content can't be transcribed.
+func (s *Session) StartTranscription() (string, error) {
+	var transcriptId string
+	err := EndedError
+	s.do(func() {
+		if s.state.Encrypted {
+			err = EncryptedError
+			return
+		}
+		err = nil
+		if transcriptId = s.state.TranscriptId; transcriptId != "" {
+			return
+		}
+		transcriptId = startTranscript(s.state)
+		sLog().Info("started transcription",
+			zap.String("sessionId", s.Id), zap.String("transcriptId", transcriptId))
+		s.broadcastControl(protocol.RecordingPacket(true))
+	})
+	return transcriptId, err
+}
+
+// StopTranscription stops recording the session's transcript, saves it,
+// and returns its ID. Any live text is saved as the last lines of the transcript.
+func (s *Session) StopTranscription() (string, error) {
+	var transcriptId string
+	err := EndedError
+	s.do(func() {
+		if transcriptId = s.state.TranscriptId; transcriptId == "" {
+			err = NotTranscribingError
+			return
+		}
+		if !s.holdsLease() {
+			err = TranscriptLeaseError
+			return
+		}
+		if err = s.saveTranscript(); err != nil {
+			return
+		}
+		sLog().Info("stopped transcription",
+			zap.String("sessionId", s.Id), zap.String("transcriptId", transcriptId))
+		s.broadcastControl(protocol.RecordingPacket(false))
+	})
+	return transcriptId, err
+}
+
+// TranscriptionStatus returns the ID of the transcript being recorded,
+// or an empty string if the session isn't being transcribed.
+func (s *Session) TranscriptionStatus() (string, error) {
+	var transcriptId string
+	err := EndedError
+	s.query(func() { transcriptId, err = s.state.TranscriptId, nil })
+	return transcriptId, err
+}
+
+// startTranscript starts a new transcript of a session's state,
+// from its next line of past text, and returns the transcript's ID.
+// Its lines are checkpointed to a draft as they are committed, so
+// they aren't lost if the server crashes.
+func startTranscript(state *storage.SessionState) string {
+	state.TranscriptId = uuid.NewString()
+	state.TranscriptFrom = len(state.PastText)
+	state.TranscriptAt = time.Now().UnixMilli()
+	// if the draft can't be saved, the transcript is still saved when it's finished
+	_ = storage.StartTranscriptDraft(storage.NewTranscript(state.TranscriptId, state))
+	return state.TranscriptId
+}
+
+// addPastLine commits a line of past text, and checkpoints it
+// if the session is being transcribed.
+func (s *Session) addPastLine(line storage.PastTextLine) {
+	s.state.PastText = append(s.state.PastText, line)
+	s.checkpointLine(len(s.state.PastText) - 1)
+	s.observePastLine(len(s.state.PastText) - 1)
+}
+
+// checkpointLine saves the line of past text at the given index
+// to the draft of the transcript being recorded, if it's part of it.
+func (s *Session) checkpointLine(index int) {
+	if s.state.TranscriptId == "" || index < s.state.TranscriptFrom {
+		return
+	}
+	// if the checkpoint fails, the line is still saved when the transcript is finished
+	_ = storage.CheckpointTranscriptLine(s.state.TranscriptId, index-s.state.TranscriptFrom, s.state.PastText[index])
+}
+
+// saveTranscript saves the transcript being recorded, with any live
+// text as its last lines, and stops recording it.
+func (s *Session) saveTranscript() error {
+	t := storage.NewTranscript(s.state.TranscriptId, s.state)
+	t.EndTime = time.Now().UnixMilli()
+	t.PastText = slices.Clip(t.PastText)
+	for _, clientId := range s.liveClients() {
+		if text := s.live[clientId].text; text != "" {
+			t.PastText = append(t.PastText, s.pastLine(clientId, text))
+		}
+	}
+	if err := storage.FinishTranscriptDraft(t); err != nil {
+		sLog().Error("transcript save failure",
+			zap.String("sessionId", s.Id), zap.String("transcriptId", t.Id),
+			zap.Error(err))
+		return err
+	}
+	s.state.TranscriptId = ""
+	return nil
+}
+
+// RecoverTranscripts finishes the drafts of transcripts that were being
+// recorded by server instances that crashed. Drafts of sessions that are
+// still running, that are waiting to be resumed, or that have a snapshot
+// and so may yet be resumed, are left alone.
+// It returns how many transcripts were recovered.
+func RecoverTranscripts() int {
+	ids, err := storage.TranscriptDraftIds()
+	if err != nil {
+		sLog().Error("transcript draft list failure", zap.Error(err))
+		return 0
+	}
+	recovered := 0
+	for _, id := range ids {
+		if recoverTranscript(id) {
+			recovered++
+		}
+	}
+	if recovered > 0 {
+		sLog().Info("recovered transcripts", zap.Int("count", recovered))
+	}
+	return recovered
+}
+
+func recoverTranscript(id string) bool {
+	t, err := storage.TranscriptDraft(id)
+	if err != nil {
+		sLog().Error("transcript draft fetch failure", zap.String("transcriptId", id), zap.Error(err))
+		return false
+	}
+	if t == nil {
+		// the draft was finished after we listed it, or is only partly deleted
+		_ = storage.DeleteTranscriptDraft(id)
+		return false
+	}
+	if findSession(t.ConversationId) != nil {
+		return false
+	}
+	if l, err := SessionOwner(t.ConversationId); err != nil || l != nil {
+		return false
+	}
+	if suspended, err := storage.HasSuspendedSessionState(t.ConversationId); err != nil || suspended {
+		return false
+	}
+	// a session with a snapshot may be an orphan that's about to be resumed
+	if snapshot, err := orphanStore.GetSessionSnapshot(t.ConversationId); err != nil || snapshot != nil {
+		return false
+	}
+	t.Recovered = true
+	t.EndTime = t.StartTime
+	if len(t.PastText) > 0 {
+		t.EndTime = t.PastText[len(t.PastText)-1].Time
+	}
+	if err := storage.FinishTranscriptDraft(t); err != nil {
+		sLog().Error("recovered transcript save failure", zap.String("transcriptId", id), zap.Error(err))
+		return false
+	}
+	sLog().Info("recovered transcript",
+		zap.String("sessionId", t.ConversationId), zap.String("transcriptId", id),
+		zap.Int("lines", len(t.PastText)))
+	return true
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/pubsub"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+func TestStartTranscription(t *testing.T) {
+	s, ps := newTestSession(t, "test-transcription")
+	addTestParticipant(s, "w", true)
+	addTestParticipant(s, "l", false)
+	if _, err := s.StopTranscription(); !errors.Is(err, NotTranscribingError) {
+		t.Errorf("StopTranscription() of untranscribed session failed, got %v, want %v", err, NotTranscribingError)
+	}
+	sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "before"}, protocol.ContentChunk{Offset: protocol.CoNewline})
+	id, err := s.StartTranscription()
+	if err != nil || id == "" {
+		t.Fatalf("StartTranscription() failed, got %q, %v", id, err)
+	}
+	if again, err := s.StartTranscription(); err != nil || again != id {
+		t.Errorf("StartTranscription() again failed, got %q, %v, want %q", again, err, id)
+	}
+	if status, err := s.TranscriptionStatus(); err != nil || status != id {
+		t.Errorf("TranscriptionStatus() failed, got %q, %v, want %q", status, err, id)
+	}
+	notices := slices.DeleteFunc(slices.Clone(ps.broadcasts), func(p string) bool {
+		ok, _ := protocol.IsRecordingPacket(p)
+		return !ok
+	})
+	if len(notices) != 1 || notices[0] != protocol.RecordingPacket(true) {
+		t.Errorf("expected one recording notice, got %v", ps.broadcasts)
+	}
+	sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "after"}, protocol.ContentChunk{Offset: protocol.CoNewline})
+	if transcript := storage.NewTranscript(id, s.state); len(transcript.PastText) != 1 || transcript.PastText[0].Text != "after" {
+		t.Errorf("transcript includes text from before it started: %v", transcript.PastText)
+	}
+
+	// late joiners are told the session is being recorded
+	s.applyStatus(pubsub.ClientStatus{ClientId: "l", IsOnline: true})
+	if len(ps.sent["l"]) != 1 {
+		t.Fatalf("expected a recording notice for the late joiner, got %v", ps.sent["l"])
+	}
+	if ok, on := protocol.IsRecordingPacket(ps.sent["l"][0]); !ok || !on {
+		t.Errorf("late joiner's recording notice was %q", ps.sent["l"][0])
+	}
+}
@@ -0,0 +1,24 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"github.com/whisper-project/server.golang/pubsub"
+)
+
+// UseWebhookPresence switches session presence tracking from realtime
+// presence subscriptions to Ably webhooks. It only affects sessions
+// started after the call.
+func UseWebhookPresence(on bool) {
+	ably.UseWebhookPresence(on)
+}
+
+// ApplyPubsubWebhook applies a verified webhook batch to the running
+// sessions, returning how many events were applied.
+func ApplyPubsubWebhook(batch *pubsub.WebhookBatch) int {
+	return ably.ApplyWebhookBatch(batch)
+}
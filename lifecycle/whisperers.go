@@ -0,0 +1,168 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+var (
+	LastWhispererError = fmt.Errorf("the session must have a whisperer")
+	NotWhispererError  = fmt.Errorf("not a whisperer")
+)
+
+// liveTrack is one whisperer's live text, and the packets that make it up.
+// In encrypted sessions the server can't read the text, so only the
+// packets are kept.
+type liveTrack struct {
+	text    string
+	packets []protocol.ContentPacket
+	updated time.Time // when content from the whisperer last arrived
+}
+
+// liveOf returns the live text of the given whisperer, creating it if necessary.
+func (s *Session) liveOf(clientId string) *liveTrack {
+	track, ok := s.live[clientId]
+	if !ok {
+		track = &liveTrack{}
+		s.live[clientId] = track
+	}
+	return track
+}
+
+// liveClients returns the whisperers who have live text, in a stable order.
+func (s *Session) liveClients() []string {
+	clientIds := make([]string, 0, len(s.live))
+	for clientId := range s.live {
+		clientIds = append(clientIds, clientId)
+	}
+	slices.Sort(clientIds)
+	return clientIds
+}
+
+// livePackets returns the packets that make up every whisperer's live text.
+func (s *Session) livePackets() []protocol.ContentPacket {
+	var packets []protocol.ContentPacket
+	for _, clientId := range s.liveClients() {
+		packets = append(packets, s.live[clientId].packets...)
+	}
+	return packets
+}
+
+// latestLive returns the live text of the whisperer who most recently
+// sent content. It's what clients that only know of one whisperer see.
+func (s *Session) latestLive() string {
+	var latest *liveTrack
+	for _, clientId := range s.liveClients() {
+		if track := s.live[clientId]; latest == nil || track.updated.After(latest.updated) {
+			latest = track
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return latest.text
+}
+
+// retireLive ends a whisperer's live text, which becomes a line of
+// past text so it isn't lost from the transcript.
+func (s *Session) retireLive(clientId string) {
+	track, ok := s.live[clientId]
+	if !ok {
+		return
+	}
+	if track.text != "" {
+		s.addPastLine(s.pastLine(clientId, track.text))
+		s.observe(Event{Kind: EventLiveTextChanged, ClientId: clientId})
+	}
+	delete(s.live, clientId)
+	delete(s.resyncing, clientId)
+}
+
+// SetRole makes a participant a whisperer or a listener.
+// The last whisperer in a session can't become a listener.
+func (s *Session) SetRole(clientId string, whisperer bool) error {
+	err := EndedError
+	s.do(func() {
+		if err = s.setRole(clientId, whisperer); err == nil {
+			s.broadcastControl(protocol.ParticipantsChangedPacket())
+		}
+	})
+	return err
+}
+
+// HandOff passes the whisperer role from one participant to another.
+func (s *Session) HandOff(fromClientId, toClientId string) error {
+	err := EndedError
+	s.do(func() {
+		from, ok := s.state.Participants[fromClientId]
+		if !ok {
+			err = NotPresentError
+			return
+		}
+		if !from.IsWhisperer {
+			err = NotWhispererError
+			return
+		}
+		// the new whisperer goes first, so the session always has one
+		if err = s.setRole(toClientId, true); err != nil {
+			return
+		}
+		if err = s.setRole(fromClientId, false); err != nil {
+			return
+		}
+		s.broadcastControl(protocol.ParticipantsChangedPacket())
+	})
+	return err
+}
+
+func (s *Session) setRole(clientId string, whisperer bool) error {
+	p, ok := s.state.Participants[clientId]
+	if !ok {
+		return NotPresentError
+	}
+	if p.IsWhisperer == whisperer {
+		return nil
+	}
+	if !whisperer && s.whispererCount() == 1 {
+		return LastWhispererError
+	}
+	if err := s.Pubsub.SetWhisperer(s.Id, clientId, whisperer); err != nil {
+		// a demoted whisperer still won't be issued a token that can publish
+		sLog().Error("ably set whisperer failure",
+			zap.String("sessionId", s.Id), zap.String("clientId", clientId), zap.Error(err))
+	}
+	p.IsWhisperer = whisperer
+	role := protocol.RoleWhisperer
+	if !whisperer {
+		role = protocol.RoleListener
+		s.retireLive(clientId)
+	}
+	sLog().Info("participant role changed", zap.String("sessionId", s.Id),
+		zap.String("clientId", clientId), zap.String("role", role))
+	s.broadcastControl(protocol.RoleChangedPacket(clientId, role))
+	if whisperer && p.IsOnline {
+		s.notifyNeedsAuth()
+	}
+	return nil
+}
+
+func (s *Session) whispererCount() int {
+	count := 0
+	for _, p := range s.state.Participants {
+		if p.IsWhisperer {
+			count++
+		}
+	}
+	return count
+}
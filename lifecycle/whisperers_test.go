@@ -0,0 +1,154 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package lifecycle
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/pubsub"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+func TestCoWhispererTranscription(t *testing.T) {
+	s, _ := newTestSession(t, "test-co-whisperers")
+	addTestParticipant(s, "w1", true, protocol.FeatureRichContent)
+	addTestParticipant(s, "w2", true, protocol.FeatureRichContent)
+	sendChunks(s, "w1", protocol.ContentChunk{Offset: 0, Text: "one"})
+	sendChunks(s, "w2", protocol.ContentChunk{Offset: 0, Text: "two"})
+	sendChunks(s, "w1", protocol.ContentChunk{Offset: 3, Text: " more"}, protocol.ContentChunk{Offset: protocol.CoNewline})
+	sendChunks(s, "w2", protocol.ContentChunk{Offset: protocol.CoNewline})
+	sendChunks(s, "w1", protocol.ContentChunk{Offset: 0, Text: "three"})
+	// a correction one line back is to the whisperer's own last line
+	sendChunks(s, "w2", protocol.ReplacePastChunk(1, "TWO"))
+	expected := []storage.PastTextLine{
+		{Text: "one more", AuthorId: "w1", AuthorName: "w1"},
+		{Text: "TWO", AuthorId: "w2", AuthorName: "w2"},
+	}
+	for i := range s.state.PastText {
+		s.state.PastText[i].Time = 0
+	}
+	if !slices.Equal(s.state.PastText, expected) {
+		t.Errorf("past text is %v, want %v", s.state.PastText, expected)
+	}
+	if live := s.liveOf("w1").text; live != "three" {
+		t.Errorf("live text of w1 is %q, want %q", live, "three")
+	}
+	if live := s.liveOf("w2").text; live != "" {
+		t.Errorf("live text of w2 is %q, want empty", live)
+	}
+	transcript := storage.NewTranscript("t", s.state)
+	if !slices.Equal(transcript.Whisperers, []string{"w1", "w2"}) || transcript.WhispererName != "w1" {
+		t.Errorf("transcript whisperers are %v (%q)", transcript.Whisperers, transcript.WhispererName)
+	}
+}
+
+func TestCoWhispererCatchUp(t *testing.T) {
+	s, ps := newTestSession(t, "test-co-whisperer-catch-up")
+	addTestParticipant(s, "w1", true)
+	addTestParticipant(s, "w2", true)
+	addTestParticipant(s, "l", false, protocol.FeatureCatchUp, protocol.FeatureCoWhisperers)
+	addTestParticipant(s, "old", false, protocol.FeatureCatchUp)
+	sendChunks(s, "w1", protocol.ContentChunk{Offset: 0, Text: "first"})
+	sendChunks(s, "w2", protocol.ContentChunk{Offset: 0, Text: "second"})
+
+	s.applyStatus(pubsub.ClientStatus{ClientId: "l", IsOnline: true})
+	if _, live := receivedCatchUp(t, ps.sent["l"]); live != "" {
+		t.Errorf("co-whisperer client caught up with live text %q", live)
+	}
+	lives := make(map[string]string)
+	for _, packet := range ps.sent["l"] {
+		if ok, clientId, text := protocol.IsWhispererLivePacket(packet); ok {
+			lives[clientId] = text
+		}
+	}
+	if len(lives) != 2 || lives["w1"] != "first" || lives["w2"] != "second" {
+		t.Errorf("co-whisperer client was sent live texts %v", lives)
+	}
+
+	s.applyStatus(pubsub.ClientStatus{ClientId: "old", IsOnline: true})
+	if _, live := receivedCatchUp(t, ps.sent["old"]); live != "second" {
+		t.Errorf("single-whisperer client caught up with live text %q, want %q", live, "second")
+	}
+}
+
+func TestCoWhispererCatchUpSplitsLiveText(t *testing.T) {
+	s, ps := newTestSession(t, "test-co-whisperer-catch-up-split")
+	addTestParticipant(s, "w1", true)
+	addTestParticipant(s, "w2", true)
+	addTestParticipant(s, "l", false, protocol.FeatureCatchUp, protocol.FeatureCoWhisperers)
+	long := strings.Repeat("long live text ", catchUpPartBytes/10)
+	sendChunks(s, "w1", protocol.ContentChunk{Offset: 0, Text: long})
+	sendChunks(s, "w2", protocol.ContentChunk{Offset: 0, Text: "short"})
+
+	s.applyStatus(pubsub.ClientStatus{ClientId: "l", IsOnline: true})
+	var parts []protocol.WhispererLivePart
+	for _, packet := range ps.sent["l"] {
+		if m, err := protocol.ParseControl(packet); err == nil {
+			if part, ok := m.(protocol.WhispererLivePart); ok {
+				if len(part.Text) > catchUpPartBytes {
+					t.Errorf("live text part has %d bytes", len(part.Text))
+				}
+				parts = append(parts, part)
+			}
+		}
+		if ok, clientId, text := protocol.IsWhispererLivePacket(packet); ok && (clientId != "w2" || text != "short") {
+			t.Errorf("co-whisperer client was sent live text %q of %s", text, clientId)
+		}
+	}
+	if len(parts) < 2 {
+		t.Errorf("long live text was sent in %d packets, want several", len(parts))
+	}
+	if clientId, text, err := protocol.AssembleWhispererLive(parts); err != nil || clientId != "w1" || text != long {
+		t.Errorf("long live text didn't assemble (%v), got %d bytes of %s, want %d of w1", err, len(text), clientId, len(long))
+	}
+}
+
+func TestSetRoleAndHandOff(t *testing.T) {
+	s, ps := newTestSession(t, "test-roles")
+	addTestParticipant(s, "w", true)
+	addTestParticipant(s, "l", false)
+	if err := s.SetRole("w", false); !errors.Is(err, LastWhispererError) {
+		t.Errorf("SetRole() of last whisperer failed, got %v, want %v", err, LastWhispererError)
+	}
+	if err := s.SetRole("missing", true); !errors.Is(err, NotPresentError) {
+		t.Errorf("SetRole() of missing client failed, got %v, want %v", err, NotPresentError)
+	}
+	if err := s.HandOff("l", "w"); !errors.Is(err, NotWhispererError) {
+		t.Errorf("HandOff() from listener failed, got %v, want %v", err, NotWhispererError)
+	}
+	sendChunks(s, "w", protocol.ContentChunk{Offset: 0, Text: "unfinished"})
+	if err := s.HandOff("w", "l"); err != nil {
+		t.Fatalf("HandOff() failed: %v", err)
+	}
+	s.do(func() {})
+	if s.state.Participants["w"].IsWhisperer || !s.state.Participants["l"].IsWhisperer {
+		t.Errorf("HandOff() didn't swap roles")
+	}
+	if !ps.canWhisper["l"] || ps.canWhisper["w"] {
+		t.Errorf("HandOff() set pubsub roles %v", ps.canWhisper)
+	}
+	// the old whisperer's live text is kept as past text
+	if len(s.state.PastText) != 1 || s.state.PastText[0].Text != "unfinished" || len(s.live) != 0 {
+		t.Errorf("old whisperer's live text wasn't retired: %v, %v", s.state.PastText, s.live)
+	}
+	var changes []string
+	for _, packet := range ps.broadcasts {
+		if ok, clientId, role := protocol.IsRoleChangedPacket(packet); ok {
+			changes = append(changes, clientId+":"+role)
+		}
+	}
+	if !slices.Equal(changes, []string{"l:whisperer", "w:listener"}) {
+		t.Errorf("role changes announced were %v", changes)
+	}
+	if !protocol.IsParticipantsChangedPacket(ps.broadcasts[len(ps.broadcasts)-1]) {
+		t.Errorf("participants change wasn't announced after handoff")
+	}
+}
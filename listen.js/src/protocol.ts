@@ -4,6 +4,13 @@
  * GNU Affero General Public License v3, reproduced in the LICENSE file.
  */
 
+import { contentOffset, isBinary, parseContentChunk as parseWireChunk } from './protocol.gen.js'
+
+// The wire format of chunks is parsed by the bindings in protocol.gen.ts,
+// which are generated from the server's protocol package by the server's
+// protocol command. What's here are the legacy protocol's control offsets
+// and presence chunks, which the listen page still speaks.
+
 interface PresenceInfo {
     offset: string,
     conversationId: string,
@@ -105,20 +112,20 @@ interface ContentChunk {
 }
 
 export function parseContentChunk(chunk: string) {
-    const parts = chunk.match(/^(-?[0-9]+)\|(.*)$/)
-    if (parts === null || parts.length != 3) {
-        console.warn(`Can't parse content chunk: ${chunk}`)
+    if (isBinary(chunk)) {
+        console.warn(`Can't parse binary content chunk`)
         return undefined
     }
-    const offsetNum = parseInt(parts[1])
-    if (isNaN(offsetNum)) {
-        console.warn(`Can't parse chunk offset: ${chunk}`)
+    const { offset, text } = parseWireChunk(chunk)
+    // chunks that can't be parsed come back whole, with the ignore offset
+    if (offset === contentOffset.ignore && text === chunk) {
+        console.warn(`Can't parse content chunk: ${chunk}`)
         return undefined
     }
     const parsed: ContentChunk = {
-        isDiff: offsetNum >= -1,
-        offset: parseContentOffset(offsetNum) || offsetNum,
-        text: parts[2] || '',
+        isDiff: offset >= -1,
+        offset: parseContentOffset(offset) || offset,
+        text,
     }
     return parsed
 }
@@ -0,0 +1,34 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+import assert from 'node:assert'
+import { readFileSync } from 'node:fs'
+import { checkVectors } from './protocol.gen.js'
+import { parseContentChunk } from './protocol.js'
+
+function testProtocol() {
+    const vectors = JSON.parse(readFileSync('../protocol/testdata/vectors.json', 'utf8'))
+    const failures = checkVectors(vectors)
+    assert(failures.length == 0, `Protocol conformance failures:\n${failures.join('\n')}`)
+}
+
+function testContentChunks() {
+    assert.deepStrictEqual(parseContentChunk('5|text|with|pipes'), { isDiff: true, offset: 5, text: 'text|with|pipes' })
+    assert.deepStrictEqual(parseContentChunk('3:-1|'), { isDiff: true, offset: 'newline', text: '' })
+    assert.deepStrictEqual(parseContentChunk('-7|bell'), { isDiff: false, offset: 'playSound', text: 'bell' })
+    assert.deepStrictEqual(parseContentChunk('-1000|junk'), { isDiff: false, offset: -1000, text: 'junk' })
+    assert.strictEqual(parseContentChunk('no pipe'), undefined)
+    assert.strictEqual(parseContentChunk('\x01binary'), undefined)
+}
+
+try {
+    testProtocol()
+    testContentChunks()
+    console.log('Tests completed with no errors')
+} catch (e) {
+    console.error(`Tests failed: ${e}`)
+    process.exit(1)
+}
@@ -24,6 +24,8 @@ type Environment struct {
 	ApnsTeamId       string
 	DbUrl            string
 	DbKeyPrefix      string
+	AdminToken       string
+	ContentKeySecret string // wraps session content keys before they are stored
 }
 
 //goland:noinspection SpellCheckingInspection
@@ -38,6 +40,8 @@ var (
 		ApnsTeamId:       "8CD8989AB9",
 		DbUrl:            "redis://",
 		DbKeyPrefix:      "c:",
+		AdminToken:       "ci-admin-token",
+		ContentKeySecret: "ci-content-key-secret",
 	}
 	loadedConfig = ciConfig
 	configStack  []Environment
@@ -117,6 +121,8 @@ func pushEnvConfig(filename string) error {
 		ApnsTeamId:       os.Getenv("APNS_TEAM_ID"),
 		DbUrl:            os.Getenv("REDIS_URL"),
 		DbKeyPrefix:      os.Getenv("DB_KEY_PREFIX"),
+		AdminToken:       os.Getenv("ADMIN_TOKEN"),
+		ContentKeySecret: os.Getenv("CONTENT_KEY_SECRET"),
 	}
 	return nil
 }
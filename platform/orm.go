@@ -8,11 +8,14 @@ package platform
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -521,3 +524,373 @@ func MapRemove[T Map](ctx context.Context, obj T, k string) error {
 	}
 	return nil
 }
+
+type Lease interface {
+	Storable
+	~string
+}
+
+type StorableLease string
+
+func (s StorableLease) StoragePrefix() string {
+	return "lease:"
+}
+
+func (s StorableLease) StorageId() string {
+	return string(s)
+}
+
+// A LeaseHolder describes who holds a lease. The token increases every time
+// the lease is acquired, so a holder whose lease has lapsed can be fenced out.
+type LeaseHolder struct {
+	Owner string
+	Data  string
+	Token int64
+}
+
+// The fence counter outlives the lease, so tokens are never reused.
+var acquireLeaseScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[1], 'owner')
+if owner then
+	return {0, owner, redis.call('HGET', KEYS[1], 'data'), tonumber(redis.call('HGET', KEYS[1], 'token'))}
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('HSET', KEYS[1], 'owner', ARGV[1], 'data', ARGV[2], 'token', token)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, ARGV[1], ARGV[2], token}
+`)
+
+var renewLeaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'owner') == ARGV[1] and redis.call('HGET', KEYS[1], 'token') == ARGV[2] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 0
+`)
+
+var releaseLeaseScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'owner') == ARGV[1] and redis.call('HGET', KEYS[1], 'token') == ARGV[2] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// AcquireLease takes the lease for the owner, if no one holds it (not even
+// the same owner), and returns whether it was acquired. Either way it
+// returns the holder.
+func AcquireLease[T Lease](ctx context.Context, obj T, owner, data string, ttl time.Duration) (LeaseHolder, bool, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := acquireLeaseScript.Run(ctx, db, []string{key, key + ":fence"}, owner, data, ttl.Milliseconds())
+	if err := res.Err(); err != nil {
+		return LeaseHolder{}, false, err
+	}
+	vals, ok := res.Val().([]any)
+	if !ok || len(vals) != 4 {
+		return LeaseHolder{}, false, fmt.Errorf("unexpected lease result: %v", res.Val())
+	}
+	acquired, _ := vals[0].(int64)
+	holder := LeaseHolder{}
+	holder.Owner, _ = vals[1].(string)
+	holder.Data, _ = vals[2].(string)
+	holder.Token, _ = vals[3].(int64)
+	return holder, acquired == 1, nil
+}
+
+// RenewLease extends the holder's lease, and returns whether it still holds it.
+func RenewLease[T Lease](ctx context.Context, obj T, holder LeaseHolder, ttl time.Duration) (bool, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := renewLeaseScript.Run(ctx, db, []string{key}, holder.Owner, holder.Token, ttl.Milliseconds())
+	if err := res.Err(); err != nil {
+		return false, err
+	}
+	return res.Val() == int64(1), nil
+}
+
+// ReleaseLease gives up the holder's lease, if it still holds it.
+func ReleaseLease[T Lease](ctx context.Context, obj T, holder LeaseHolder) error {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := releaseLeaseScript.Run(ctx, db, []string{key}, holder.Owner, holder.Token)
+	if err := res.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// FetchLease returns the current holder of the lease, and whether there is one.
+func FetchLease[T Lease](ctx context.Context, obj T) (LeaseHolder, bool, error) {
+	db, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	res := db.HGetAll(ctx, key)
+	if err := res.Err(); err != nil {
+		return LeaseHolder{}, false, err
+	}
+	vals := res.Val()
+	if vals["owner"] == "" {
+		return LeaseHolder{}, false, nil
+	}
+	token, err := strconv.ParseInt(vals["token"], 10, 64)
+	if err != nil {
+		return LeaseHolder{}, false, err
+	}
+	return LeaseHolder{Owner: vals["owner"], Data: vals["data"], Token: token}, true, nil
+}
+
+type Queue interface {
+	Storable
+	~string
+}
+
+// A StorableQueue is a work queue whose elements are claimed by a consumer
+// until they are acknowledged. Claims that aren't acknowledged by their
+// deadline can be requeued, and elements that fail too often are moved
+// to a dead letter list.
+type StorableQueue string
+
+func (s StorableQueue) StoragePrefix() string {
+	return "queue:"
+}
+
+func (s StorableQueue) StorageId() string {
+	return string(s)
+}
+
+// A QueueClaim is a consumer's claim on a queue element. Attempts counts
+// the claims on the element since it was enqueued, including this one.
+type QueueClaim struct {
+	Element  string `json:"element"`
+	Owner    string `json:"owner"`
+	Deadline int64  `json:"deadline"` // epoch millis
+	Attempts int64  `json:"attempts"`
+}
+
+// QueueContents is everything in a queue.
+type QueueContents struct {
+	Pending []string     `json:"pending"`
+	Claimed []QueueClaim `json:"claimed"`
+	Dead    []string     `json:"dead"`
+}
+
+// queueKeys returns the keys of a queue's pending list, claim map, attempt map, and dead letter list.
+func queueKeys[T Queue](obj T) []string {
+	_, prefix := GetDb()
+	key := prefix + obj.StoragePrefix() + obj.StorageId()
+	return []string{key, key + ":claims", key + ":attempts", key + ":dead"}
+}
+
+// claims are stored as deadline|attempts|owner
+func encodeQueueClaim(c QueueClaim) string {
+	return fmt.Sprintf("%d|%d|%s", c.Deadline, c.Attempts, c.Owner)
+}
+
+func decodeQueueClaim(element, val string) (QueueClaim, error) {
+	parts := strings.SplitN(val, "|", 3)
+	if len(parts) != 3 {
+		return QueueClaim{}, fmt.Errorf("invalid queue claim: %q", val)
+	}
+	deadline, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return QueueClaim{}, err
+	}
+	attempts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return QueueClaim{}, err
+	}
+	return QueueClaim{Element: element, Owner: parts[2], Deadline: deadline, Attempts: attempts}, nil
+}
+
+var claimQueueScript = redis.NewScript(`
+local element = redis.call('RPOP', KEYS[1])
+if not element then
+	return false
+end
+local attempts = redis.call('HINCRBY', KEYS[3], element, 1)
+redis.call('HSET', KEYS[2], element, ARGV[2] .. '|' .. attempts .. '|' .. ARGV[1])
+return {element, attempts}
+`)
+
+var ackQueueScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('HDEL', KEYS[3], ARGV[1])
+return 1
+`)
+
+// failing a claim requeues its element at the head of the queue, or moves
+// it to the dead letter list if it has been attempted too often
+var failQueueScript = redis.NewScript(`
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[1])
+if tonumber(redis.call('HGET', KEYS[3], ARGV[1]) or '0') >= tonumber(ARGV[3]) then
+	redis.call('HDEL', KEYS[3], ARGV[1])
+	redis.call('LPUSH', KEYS[4], ARGV[1])
+	return 2
+end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+return 1
+`)
+
+var requeueQueueScript = redis.NewScript(`
+local claims = redis.call('HGETALL', KEYS[2])
+local requeued, dead = 0, 0
+for i = 1, #claims, 2 do
+	local element, claim = claims[i], claims[i + 1]
+	local deadline = tonumber(string.match(claim, '^(%d+)|'))
+	if deadline and deadline < tonumber(ARGV[1]) then
+		redis.call('HDEL', KEYS[2], element)
+		if tonumber(redis.call('HGET', KEYS[3], element) or '0') >= tonumber(ARGV[2]) then
+			redis.call('HDEL', KEYS[3], element)
+			redis.call('LPUSH', KEYS[4], element)
+			dead = dead + 1
+		else
+			redis.call('RPUSH', KEYS[1], element)
+			requeued = requeued + 1
+		end
+	end
+end
+return {requeued, dead}
+`)
+
+// Enqueue adds an element to the tail of the queue, with no prior attempts.
+func Enqueue[T Queue](ctx context.Context, obj T, element string) error {
+	db, _ := GetDb()
+	keys := queueKeys(obj)
+	_, err := db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, keys[2], element)
+		pipe.LPush(ctx, keys[0], element)
+		return nil
+	})
+	return err
+}
+
+var enqueueListScript = redis.NewScript(`
+local pop = 'RPOP'
+if ARGV[1] == '1' then
+	pop = 'LPOP'
+end
+local moved = 0
+while true do
+	local element = redis.call(pop, KEYS[1])
+	if not element then
+		return moved
+	end
+	redis.call('HDEL', KEYS[3], element)
+	redis.call('LPUSH', KEYS[2], element)
+	moved = moved + 1
+end
+`)
+
+// EnqueueList moves all the elements of a list to the tail of the queue,
+// taking them from the given end of the list, and returns how many it moved.
+func EnqueueList[L List, Q Queue](ctx context.Context, list L, fromLeft bool, obj Q) (int64, error) {
+	db, prefix := GetDb()
+	listKey := prefix + list.StoragePrefix() + list.StorageId()
+	keys := queueKeys(obj)
+	from := "0"
+	if fromLeft {
+		from = "1"
+	}
+	return enqueueListScript.Run(ctx, db, []string{listKey, keys[0], keys[2]}, from).Int64()
+}
+
+// ClaimFromQueue claims the element at the head of the queue for the owner
+// until the deadline, and returns whether there was one to claim.
+func ClaimFromQueue[T Queue](ctx context.Context, obj T, owner string, deadline time.Time) (QueueClaim, bool, error) {
+	db, _ := GetDb()
+	res := claimQueueScript.Run(ctx, db, queueKeys(obj), owner, deadline.UnixMilli())
+	if err := res.Err(); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return QueueClaim{}, false, nil
+		}
+		return QueueClaim{}, false, err
+	}
+	vals, ok := res.Val().([]any)
+	if !ok || len(vals) != 2 {
+		return QueueClaim{}, false, fmt.Errorf("unexpected queue claim result: %v", res.Val())
+	}
+	claim := QueueClaim{Owner: owner, Deadline: deadline.UnixMilli()}
+	claim.Element, _ = vals[0].(string)
+	claim.Attempts, _ = vals[1].(int64)
+	return claim, true, nil
+}
+
+// AckQueueClaim finishes with a claimed element, and returns whether the
+// claim was still held. Claims that have been requeued can't be acknowledged.
+func AckQueueClaim[T Queue](ctx context.Context, obj T, claim QueueClaim) (bool, error) {
+	db, _ := GetDb()
+	res := ackQueueScript.Run(ctx, db, queueKeys(obj), claim.Element, encodeQueueClaim(claim))
+	if err := res.Err(); err != nil {
+		return false, err
+	}
+	return res.Val() == int64(1), nil
+}
+
+// FailQueueClaim gives up a claimed element so it can be tried again, unless
+// it has already been attempted maxAttempts times, in which case it's dead lettered.
+// It returns whether the element was dead lettered.
+func FailQueueClaim[T Queue](ctx context.Context, obj T, claim QueueClaim, maxAttempts int64) (bool, error) {
+	db, _ := GetDb()
+	res := failQueueScript.Run(ctx, db, queueKeys(obj), claim.Element, encodeQueueClaim(claim), maxAttempts)
+	if err := res.Err(); err != nil {
+		return false, err
+	}
+	return res.Val() == int64(2), nil
+}
+
+// RequeueExpiredClaims gives up all claims whose deadline is before now,
+// as if they had failed, and returns how many were requeued and dead lettered.
+func RequeueExpiredClaims[T Queue](ctx context.Context, obj T, now time.Time, maxAttempts int64) (int64, int64, error) {
+	db, _ := GetDb()
+	res := requeueQueueScript.Run(ctx, db, queueKeys(obj), now.UnixMilli(), maxAttempts)
+	if err := res.Err(); err != nil {
+		return 0, 0, err
+	}
+	vals, ok := res.Val().([]any)
+	if !ok || len(vals) != 2 {
+		return 0, 0, fmt.Errorf("unexpected queue requeue result: %v", res.Val())
+	}
+	requeued, _ := vals[0].(int64)
+	dead, _ := vals[1].(int64)
+	return requeued, dead, nil
+}
+
+// FetchQueueContents returns the pending, claimed, and dead lettered
+// elements of the queue. Pending elements are listed head first.
+func FetchQueueContents[T Queue](ctx context.Context, obj T) (*QueueContents, error) {
+	db, _ := GetDb()
+	keys := queueKeys(obj)
+	pending, err := db.LRange(ctx, keys[0], 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(pending)
+	claims, err := db.HGetAll(ctx, keys[1]).Result()
+	if err != nil {
+		return nil, err
+	}
+	dead, err := db.LRange(ctx, keys[3], 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	contents := &QueueContents{Pending: pending, Claimed: make([]QueueClaim, 0, len(claims)), Dead: dead}
+	for element, val := range claims {
+		claim, err := decodeQueueClaim(element, val)
+		if err != nil {
+			return nil, err
+		}
+		contents.Claimed = append(contents.Claimed, claim)
+	}
+	slices.SortFunc(contents.Claimed, func(a, b QueueClaim) int { return cmp.Compare(a.Deadline, b.Deadline) })
+	return contents, nil
+}
+
+// DeleteQueue removes the queue and all its claims and dead letters.
+func DeleteQueue[T Queue](ctx context.Context, obj T) error {
+	db, _ := GetDb()
+	return db.Del(ctx, queueKeys(obj)...).Err()
+}
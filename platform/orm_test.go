@@ -470,3 +470,148 @@ func TestOrmTestMap(t *testing.T) {
 		t.Errorf("Failed to delete stored map for %q: %v", ormTestMap, err)
 	}
 }
+
+var ormTestLease StorableLease = "ormTestLease"
+
+func TestStorableLeaseInterfaceDefinition(t *testing.T) {
+	StorableInterfaceTester(t, ormTestLease, "lease:", "ormTestLease")
+}
+
+func TestAcquireRenewReleaseLease(t *testing.T) {
+	ctx := context.Background()
+	defer func() {
+		if err := DeleteStorage(ctx, ormTestLease); err != nil {
+			t.Errorf("Failed to delete stored data for %q: %v", ormTestLease, err)
+		}
+	}()
+	first, ok, err := AcquireLease(ctx, ormTestLease, "first", "data1", time.Minute)
+	if err != nil || !ok || first.Owner != "first" || first.Data != "data1" {
+		t.Fatalf("AcquireLease() failed, got %v, %v, %v, want first holder", first, ok, err)
+	}
+	holder, ok, err := AcquireLease(ctx, ormTestLease, "second", "data2", time.Minute)
+	if err != nil || ok || holder != first {
+		t.Errorf("AcquireLease() failed, got %v, %v, %v, want %v not acquired", holder, ok, err, first)
+	}
+	if found, ok, err := FetchLease(ctx, ormTestLease); err != nil || !ok || found != first {
+		t.Errorf("FetchLease() failed, got %v, %v, %v, want %v", found, ok, err, first)
+	}
+	if ok, err := RenewLease(ctx, ormTestLease, first, time.Minute); err != nil || !ok {
+		t.Errorf("RenewLease() failed, got %v, %v, want true", ok, err)
+	}
+	stale := LeaseHolder{Owner: first.Owner, Data: first.Data, Token: first.Token - 1}
+	if ok, err := RenewLease(ctx, ormTestLease, stale, time.Minute); err != nil || ok {
+		t.Errorf("RenewLease() of stale token failed, got %v, %v, want false", ok, err)
+	}
+	if err := ReleaseLease(ctx, ormTestLease, first); err != nil {
+		t.Errorf("ReleaseLease() failed: %v", err)
+	}
+	if found, ok, err := FetchLease(ctx, ormTestLease); err != nil || ok {
+		t.Errorf("FetchLease() after release failed, got %v, %v, %v, want none", found, ok, err)
+	}
+	second, ok, err := AcquireLease(ctx, ormTestLease, "second", "data2", time.Minute)
+	if err != nil || !ok || second.Token <= first.Token {
+		t.Errorf("AcquireLease() after release failed, got %v, %v, %v, want token above %d",
+			second, ok, err, first.Token)
+	}
+	if ok, err := RenewLease(ctx, ormTestLease, first, time.Minute); err != nil || ok {
+		t.Errorf("RenewLease() of released lease failed, got %v, %v, want false", ok, err)
+	}
+	db, prefix := GetDb()
+	db.Del(ctx, prefix+ormTestLease.StoragePrefix()+ormTestLease.StorageId()+":fence")
+}
+
+var ormTestQueue StorableQueue = "ormTestQueue"
+
+func TestStorableQueueInterfaceDefinition(t *testing.T) {
+	StorableInterfaceTester(t, ormTestQueue, "queue:", "ormTestQueue")
+}
+
+func TestClaimAckFailQueue(t *testing.T) {
+	ctx := context.Background()
+	defer func() {
+		if err := DeleteQueue(ctx, ormTestQueue); err != nil {
+			t.Errorf("Failed to delete queue %q: %v", ormTestQueue, err)
+		}
+	}()
+	if _, ok, err := ClaimFromQueue(ctx, ormTestQueue, "owner", time.Now()); err != nil || ok {
+		t.Fatalf("ClaimFromQueue() of empty queue failed, got %v, %v, want nothing", ok, err)
+	}
+	for _, e := range []string{"a", "b", "c"} {
+		if err := Enqueue(ctx, ormTestQueue, e); err != nil {
+			t.Fatalf("Enqueue(%q) failed: %v", e, err)
+		}
+	}
+	deadline := time.Now().Add(time.Minute)
+	a, ok, err := ClaimFromQueue(ctx, ormTestQueue, "owner", deadline)
+	if err != nil || !ok || a.Element != "a" || a.Attempts != 1 {
+		t.Fatalf("ClaimFromQueue() failed, got %v, %v, %v, want first attempt at a", a, ok, err)
+	}
+	if dead, err := FailQueueClaim(ctx, ormTestQueue, a, 2); err != nil || dead {
+		t.Errorf("FailQueueClaim() failed, got %v, %v, want requeued", dead, err)
+	}
+	a, _, _ = ClaimFromQueue(ctx, ormTestQueue, "owner", deadline)
+	if a.Element != "a" || a.Attempts != 2 {
+		t.Errorf("ClaimFromQueue() after failure failed, got %v, want second attempt at a", a)
+	}
+	if dead, err := FailQueueClaim(ctx, ormTestQueue, a, 2); err != nil || !dead {
+		t.Errorf("FailQueueClaim() failed, got %v, %v, want dead lettered", dead, err)
+	}
+	b, _, _ := ClaimFromQueue(ctx, ormTestQueue, "owner", deadline)
+	if ok, err := AckQueueClaim(ctx, ormTestQueue, b); err != nil || !ok {
+		t.Errorf("AckQueueClaim() failed, got %v, %v, want true", ok, err)
+	}
+	if ok, err := AckQueueClaim(ctx, ormTestQueue, b); err != nil || ok {
+		t.Errorf("AckQueueClaim() repeated failed, got %v, %v, want false", ok, err)
+	}
+	c, _, _ := ClaimFromQueue(ctx, ormTestQueue, "owner", deadline)
+	contents, err := FetchQueueContents(ctx, ormTestQueue)
+	if err != nil {
+		t.Fatalf("FetchQueueContents() failed: %v", err)
+	}
+	want := &QueueContents{Pending: []string{}, Claimed: []QueueClaim{c}, Dead: []string{"a"}}
+	if diff := deep.Equal(contents, want); diff != nil {
+		t.Errorf("FetchQueueContents() failed, differences are:\n%v", diff)
+	}
+	requeued, dead, err := RequeueExpiredClaims(ctx, ormTestQueue, deadline.Add(time.Second), 2)
+	if err != nil || requeued != 1 || dead != 0 {
+		t.Errorf("RequeueExpiredClaims() failed, got %d, %d, %v, want 1 requeued", requeued, dead, err)
+	}
+	if ok, err := AckQueueClaim(ctx, ormTestQueue, c); err != nil || ok {
+		t.Errorf("AckQueueClaim() of expired claim failed, got %v, %v, want false", ok, err)
+	}
+	if c, ok, err = ClaimFromQueue(ctx, ormTestQueue, "other", deadline); err != nil || !ok || c.Element != "c" {
+		t.Errorf("ClaimFromQueue() after requeue failed, got %v, %v, %v, want c", c, ok, err)
+	}
+}
+
+func TestEnqueueList(t *testing.T) {
+	ctx := context.Background()
+	defer func() {
+		if err := DeleteQueue(ctx, ormTestQueue); err != nil {
+			t.Errorf("Failed to delete queue %q: %v", ormTestQueue, err)
+		}
+		if err := DeleteStorage(ctx, ormTestList); err != nil {
+			t.Errorf("Failed to delete stored data for %q: %v", ormTestList, err)
+		}
+	}()
+	if moved, err := EnqueueList(ctx, ormTestList, false, ormTestQueue); err != nil || moved != 0 {
+		t.Errorf("EnqueueList() of empty list failed, got %d, %v, want 0", moved, err)
+	}
+	if err := Enqueue(ctx, ormTestQueue, "a"); err != nil {
+		t.Fatalf("Enqueue() failed: %v", err)
+	}
+	if err := PushRange(ctx, ormTestList, true, "b", "c"); err != nil {
+		t.Fatalf("Failed to push left: %v", err)
+	}
+	if moved, err := EnqueueList(ctx, ormTestList, false, ormTestQueue); err != nil || moved != 2 {
+		t.Errorf("EnqueueList() failed, got %d, %v, want 2", moved, err)
+	}
+	if remaining, err := FetchRange(ctx, ormTestList, 0, -1); err != nil || len(remaining) != 0 {
+		t.Errorf("EnqueueList() left %v, %v in the list", remaining, err)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		if claim, ok, err := ClaimFromQueue(ctx, ormTestQueue, "owner", time.Now()); err != nil || !ok || claim.Element != want {
+			t.Errorf("ClaimFromQueue() after EnqueueList() failed, got %v, %v, %v, want %s", claim, ok, err, want)
+		}
+	}
+}
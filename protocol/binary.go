@@ -0,0 +1,272 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// An Encoding is a wire format for packets. Every session starts out using
+// the text encoding, and uses the binary encoding only while all of its
+// online participants have negotiated FeatureBinary. The parsers accept
+// both encodings, so receivers never need to know which one was used.
+type Encoding string
+
+const (
+	EncodingText   Encoding = "text"
+	EncodingBinary Encoding = "binary"
+)
+
+// In the binary encoding, a packet starts with a tag byte that no text packet
+// can start with: text chunks start with a number, and the first field of
+// other text packets is escaped, which escapes any tag byte. Numbers are varints, and fields other than the last are
+// preceded by a header that gives their length. IDs that are UUIDs are sent
+// as their 16 bytes, and control actions known to the server as a single byte.
+const (
+	tagChunk          = 0x01 // unsequenced content chunk: offset, text
+	tagSequencedChunk = 0x02 // sequenced content chunk: seq, offset, text
+	tagPacket         = 0x03 // content packet: packetId, clientId, data
+	tagControl        = 0x04 // control chunk: action, arg count, args
+)
+
+// binaryActions gives each known control action its binary code, which is
+// its index plus one. The list can be added to, but never reordered.
+var binaryActions = []string{
+	"approve-requests", "participants-changed", "past-text-speech-id", "end",
+	"resend-live", "live-resynced", "rate-warning", "muted", "content-encrypted",
+	"hello", "welcome", "incompatible", "encoding", "catch-up", "request-catch-up",
+	"idle-warning", "listen-approved", "listen-denied", "removed",
+	"role-changed", "whisperer-live", "recording", "whisperer-live-part",
+}
+
+var binaryActionCodes = func() map[string]int {
+	codes := make(map[string]int, len(binaryActions))
+	for i, action := range binaryActions {
+		codes[action] = i + 1
+	}
+	return codes
+}()
+
+var errTruncated = errors.New("truncated binary packet")
+
+// IsBinary tells whether a packet uses the binary encoding.
+func IsBinary(packet string) bool {
+	return len(packet) > 0 && packet[0] >= tagChunk && packet[0] <= tagControl
+}
+
+func (e Encoding) Chunk(c ContentChunk) string {
+	if e == EncodingBinary {
+		return string(c.AppendBinary(nil))
+	}
+	return c.String()
+}
+
+func (e Encoding) Packet(p ContentPacket) string {
+	if e == EncodingBinary {
+		return string(p.AppendBinary(nil))
+	}
+	return p.String()
+}
+
+func (e Encoding) Control(m ControlMessage) string {
+	c := ControlChunk{Action: m.Action(), Args: m.Args()}
+	if e == EncodingBinary {
+		return string(c.AppendBinary(nil))
+	}
+	return c.String()
+}
+
+// Recode converts a control packet in either encoding to this encoding.
+func (e Encoding) Recode(packet string) string {
+	if IsBinary(packet) == (e == EncodingBinary) {
+		return packet
+	}
+	c := ParseControlChunk(packet)
+	if e == EncodingBinary {
+		return string(c.AppendBinary(nil))
+	}
+	return c.String()
+}
+
+// AppendBinary appends the binary encoding of the chunk to b.
+func (c ContentChunk) AppendBinary(b []byte) []byte {
+	if c.Seq > 0 {
+		b = append(b, tagSequencedChunk)
+		b = binary.AppendUvarint(b, uint64(c.Seq))
+	} else {
+		b = append(b, tagChunk)
+	}
+	b = binary.AppendVarint(b, int64(c.Offset))
+	return append(b, c.Text...)
+}
+
+func parseBinaryContentChunk(s string) ContentChunk {
+	if s[0] != tagChunk && s[0] != tagSequencedChunk {
+		return ContentChunk{Offset: CoIgnore, Text: s}
+	}
+	r := binaryReader{s: s, i: 1}
+	seq := uint64(0)
+	if s[0] == tagSequencedChunk {
+		seq = r.uvarint()
+	}
+	offset := r.varint()
+	if r.err != nil || (s[0] == tagSequencedChunk && seq == 0) {
+		return ContentChunk{Offset: CoIgnore, Text: s}
+	}
+	return ContentChunk{Seq: int(seq), Offset: int(offset), Text: s[r.i:]}
+}
+
+// AppendBinary appends the binary encoding of the packet to b.
+func (c ContentPacket) AppendBinary(b []byte) []byte {
+	b = append(b, tagPacket)
+	b = appendId(b, c.PacketId)
+	b = appendId(b, c.ClientId)
+	return append(b, c.Data...)
+}
+
+func parseBinaryContentPacket(s string) ContentPacket {
+	if s[0] != tagPacket {
+		return ContentPacket{}
+	}
+	r := binaryReader{s: s, i: 1}
+	packetId := r.id()
+	clientId := r.id()
+	if r.err != nil {
+		return ContentPacket{}
+	}
+	return ContentPacket{PacketId: packetId, ClientId: clientId, Data: s[r.i:]}
+}
+
+// AppendBinary appends the binary encoding of the control chunk to b.
+func (c ControlChunk) AppendBinary(b []byte) []byte {
+	b = append(b, tagControl)
+	if code, ok := binaryActionCodes[c.Action]; ok {
+		b = binary.AppendUvarint(b, uint64(code))
+	} else {
+		b = binary.AppendUvarint(b, 0)
+		b = appendField(b, c.Action)
+	}
+	b = binary.AppendUvarint(b, uint64(len(c.Args)))
+	for _, arg := range c.Args {
+		b = appendField(b, arg)
+	}
+	return b
+}
+
+func parseBinaryControlChunk(s string) ControlChunk {
+	if s[0] != tagControl {
+		return ControlChunk{}
+	}
+	r := binaryReader{s: s, i: 1}
+	var action string
+	switch code := r.uvarint(); {
+	case code == 0:
+		action = r.field()
+	case code <= uint64(len(binaryActions)):
+		action = binaryActions[code-1]
+	default:
+		return ControlChunk{}
+	}
+	count := r.uvarint()
+	if r.err != nil || count > uint64(len(s)) {
+		return ControlChunk{}
+	}
+	var args []string
+	if count > 0 {
+		args = make([]string, 0, count)
+	}
+	for range count {
+		args = append(args, r.field())
+	}
+	if r.err != nil || r.i != len(s) {
+		return ControlChunk{}
+	}
+	return ControlChunk{Action: action, Args: args}
+}
+
+// appendId appends an ID, which is sent as its bytes if it's a UUID. The
+// header is odd for a UUID, and otherwise twice the length of the ID.
+func appendId(b []byte, id string) []byte {
+	if len(id) == 36 {
+		if u, err := uuid.Parse(id); err == nil && u.String() == id {
+			b = append(b, 1)
+			return append(b, u[:]...)
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(id))<<1)
+	return append(b, id...)
+}
+
+func appendField(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+type binaryReader struct {
+	s   string
+	i   int
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint([]byte(r.s[r.i:min(len(r.s), r.i+binary.MaxVarintLen64)]))
+	if size <= 0 {
+		r.err = errTruncated
+		return 0
+	}
+	r.i += size
+	return n
+}
+
+func (r *binaryReader) varint() int64 {
+	u := r.uvarint()
+	// zig-zag decoding, as in binary.Varint
+	n := int64(u >> 1)
+	if u&1 != 0 {
+		n = ^n
+	}
+	return n
+}
+
+func (r *binaryReader) bytes(n uint64) string {
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.s)-r.i) {
+		r.err = errTruncated
+		return ""
+	}
+	s := r.s[r.i : r.i+int(n)]
+	r.i += int(n)
+	return s
+}
+
+func (r *binaryReader) field() string {
+	return r.bytes(r.uvarint())
+}
+
+func (r *binaryReader) id() string {
+	header := r.uvarint()
+	if header == 1 {
+		raw := r.bytes(16)
+		if r.err != nil {
+			return ""
+		}
+		return uuid.UUID([]byte(raw)).String()
+	}
+	if header&1 != 0 {
+		r.err = errTruncated
+		return ""
+	}
+	return r.bytes(header >> 1)
+}
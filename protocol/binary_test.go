@@ -0,0 +1,202 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var (
+	sampleChunk   = ContentChunk{Seq: 1234, Offset: 567, Text: "a"}
+	samplePacket  = ContentPacket{PacketId: "hG3rEuJCrJ:0:0", ClientId: "6f9619ff-8b86-4d01-b42d-00cf4fc964ff", Data: "1234:567|a"}
+	sampleControl = PastTextSpeechId{PacketId: "hG3rEuJCrJ:0:0", Line: 2, SpeechId: "0b8f6c8e-2d3b-4a7e-9a51-1c0d7e2a9f44"}
+)
+
+func TestBinaryActionsComplete(t *testing.T) {
+	for _, action := range ControlActions() {
+		if _, ok := binaryActionCodes[action]; !ok {
+			t.Errorf("control action %q has no binary code", action)
+		}
+	}
+}
+
+func TestBinaryContentChunk(t *testing.T) {
+	chunks := []ContentChunk{
+		sampleChunk,
+		{Offset: 0, Text: "hello|world"},
+		{Seq: 1, Offset: CoNewline},
+		{Offset: CoIgnore, Text: "\x01\x02"},
+		ReplacePastChunk(2, "fixed"),
+	}
+	for _, c := range chunks {
+		if parsed := ParseContentChunk(EncodingBinary.Chunk(c)); parsed != c {
+			t.Errorf("binary chunk %s didn't round trip, got %+v", c.DebugString(), parsed)
+		}
+	}
+	for _, bad := range []string{"\x01", "\x02\x00\x00x", "\x02\x80", "\x03abc"} {
+		if parsed := ParseContentChunk(bad); parsed.Offset != CoIgnore {
+			t.Errorf("malformed binary chunk %q parsed as %+v", bad, parsed)
+		}
+	}
+}
+
+func TestBinaryContentPacket(t *testing.T) {
+	packets := []ContentPacket{
+		samplePacket,
+		{PacketId: "p|1", ClientId: "6F9619FF-8B86-4D01-B42D-00CF4FC964FF", Data: EncodingBinary.Chunk(sampleChunk)},
+		{},
+	}
+	for _, p := range packets {
+		if parsed := ParseContentPacket(EncodingBinary.Packet(p)); parsed != p {
+			t.Errorf("binary packet %+v didn't round trip, got %+v", p, parsed)
+		}
+	}
+	for _, bad := range []string{"\x03", "\x03\x01abc", "\x03\x03ab", "\x03\x10ab"} {
+		if parsed := ParseContentPacket(bad); parsed != (ContentPacket{}) {
+			t.Errorf("malformed binary packet %q parsed as %+v", bad, parsed)
+		}
+	}
+}
+
+func TestBinaryControlChunk(t *testing.T) {
+	chunks := []ControlChunk{
+		{Action: "dance", Args: []string{"a|b", ""}},
+		{Action: "end"},
+	}
+	for _, c := range chunks {
+		if diff := deep.Equal(ParseControlChunk(string(c.AppendBinary(nil))), c); diff != nil {
+			t.Errorf("binary control %+v didn't round trip: %v", c, diff)
+		}
+	}
+	for _, bad := range []string{"\x04", "\x04\x7f\x00", "\x04\x04\x01", "\x04\x04\x00extra"} {
+		if parsed := ParseControlChunk(bad); parsed.Action != "" {
+			t.Errorf("malformed binary control %q parsed as %+v", bad, parsed)
+		}
+	}
+	text := ParticipantsChangedPacket()
+	binaryPacket := EncodingBinary.Recode(text)
+	if !IsBinary(binaryPacket) || !IsParticipantsChangedPacket(binaryPacket) {
+		t.Errorf("Recode() to binary failed, got %q", binaryPacket)
+	}
+	if EncodingText.Recode(binaryPacket) != text {
+		t.Errorf("Recode() to text failed, got %q", EncodingText.Recode(binaryPacket))
+	}
+}
+
+func TestBinaryIsSmaller(t *testing.T) {
+	sizes := []struct {
+		name         string
+		text, binary string
+	}{
+		{"chunk", EncodingText.Chunk(sampleChunk), EncodingBinary.Chunk(sampleChunk)},
+		{"keystroke", EncodingText.Chunk(ContentChunk{Offset: 12, Text: "a"}), EncodingBinary.Chunk(ContentChunk{Offset: 12, Text: "a"})},
+		{"packet", EncodingText.Packet(samplePacket), EncodingBinary.Packet(samplePacket)},
+		{"control", EncodingText.Control(sampleControl), EncodingBinary.Control(sampleControl)},
+	}
+	for _, s := range sizes {
+		if len(s.binary) >= len(s.text) {
+			t.Errorf("binary %s is %d bytes, text is %d", s.name, len(s.binary), len(s.text))
+		}
+	}
+}
+
+func FuzzBinaryContentPacket(f *testing.F) {
+	f.Add("packet", "6f9619ff-8b86-4d01-b42d-00cf4fc964ff", "0|x", 3, -1)
+	f.Fuzz(func(t *testing.T, packetId, clientId, text string, seq, offset int) {
+		if seq < 0 {
+			seq = 0
+		}
+		chunk := ContentChunk{Seq: seq, Offset: offset, Text: text}
+		packet := ContentPacket{PacketId: packetId, ClientId: clientId, Data: EncodingBinary.Chunk(chunk)}
+		parsed := ParseContentPacket(EncodingBinary.Packet(packet))
+		if parsed != packet {
+			t.Fatalf("binary packet didn't round trip, got %+v", parsed)
+		}
+		if parsedChunk := ParseContentChunk(parsed.Data); parsedChunk != chunk {
+			t.Errorf("binary chunk didn't round trip, got %+v", parsedChunk)
+		}
+	})
+}
+
+func BenchmarkEncodeChunk(b *testing.B) {
+	b.Run("text", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			_ = sampleChunk.String()
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, 64)
+		for range b.N {
+			buf = sampleChunk.AppendBinary(buf[:0])
+		}
+	})
+}
+
+func BenchmarkParseChunk(b *testing.B) {
+	text, binaryChunk := EncodingText.Chunk(sampleChunk), EncodingBinary.Chunk(sampleChunk)
+	b.Run("text", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			_ = ParseContentChunk(text)
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			_ = ParseContentChunk(binaryChunk)
+		}
+	})
+}
+
+func BenchmarkEncodePacket(b *testing.B) {
+	b.Run("text", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(samplePacket.String())))
+		for range b.N {
+			_ = samplePacket.String()
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, 128)
+		b.SetBytes(int64(len(samplePacket.AppendBinary(nil))))
+		for range b.N {
+			buf = samplePacket.AppendBinary(buf[:0])
+		}
+	})
+}
+
+func BenchmarkParsePacket(b *testing.B) {
+	text, binaryPacket := EncodingText.Packet(samplePacket), EncodingBinary.Packet(samplePacket)
+	b.Run("text", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			_ = ParseContentPacket(text)
+		}
+	})
+	b.Run("binary", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			_ = ParseContentPacket(binaryPacket)
+		}
+	})
+}
+
+func BenchmarkControl(b *testing.B) {
+	for _, e := range []Encoding{EncodingText, EncodingBinary} {
+		b.Run(string(e), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				_, _ = ParseControl(e.Control(sampleControl))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	registerControl("catch-up", func(args []string) (ControlMessage, error) {
+		m := CatchUp{Id: args[0], Part: int(parseInt(args[1])), Parts: int(parseInt(args[2])), Text: args[3]}
+		if m.Part >= m.Parts {
+			return nil, fmt.Errorf("part %d of %d doesn't exist", m.Part, m.Parts)
+		}
+		return m, nil
+	},
+		ArgSpec{Name: "id", Kind: ArgId},
+		ArgSpec{Name: "part", Kind: ArgInt},
+		ArgSpec{Name: "parts", Kind: ArgInt},
+		ArgSpec{Name: "text", Kind: ArgString},
+	)
+	registerControl("request-catch-up", func([]string) (ControlMessage, error) {
+		return RequestCatchUp{}, nil
+	})
+}
+
+// CatchUp is one part of the text a listener missed before it joined:
+// recent lines of past text, each followed by a newline, and then the
+// live text. The text is split into parts to fit in a message, so the
+// parts have to be put back together before use.
+type CatchUp struct {
+	Id    string // the same for all parts of one catch-up
+	Part  int    // numbered from 0
+	Parts int
+	Text  string
+}
+
+func (CatchUp) Action() string { return "catch-up" }
+func (m CatchUp) Args() []string {
+	return []string{m.Id, fmt.Sprint(m.Part), fmt.Sprint(m.Parts), m.Text}
+}
+
+// RequestCatchUp is how a client asks to be caught up again,
+// for example because it lost track of the live text.
+// Clients send it as their presence data.
+type RequestCatchUp struct{}
+
+func (RequestCatchUp) Action() string { return "request-catch-up" }
+func (RequestCatchUp) Args() []string { return nil }
+
+func RequestCatchUpPacket() string {
+	return EncodeControl(RequestCatchUp{})
+}
+
+func IsRequestCatchUpPacket(packet string) bool {
+	_, ok := parseAs[RequestCatchUp](packet)
+	return ok
+}
+
+// CatchUpPackets makes the packets that catch a client up with the given
+// past and live text, with no more than maxBytes of text in each packet.
+func CatchUpPackets(id string, past []string, live string, maxBytes int) []string {
+	var b strings.Builder
+	for _, line := range past {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteString(live)
+	parts := splitText(b.String(), maxBytes)
+	packets := make([]string, len(parts))
+	for i, part := range parts {
+		packets[i] = EncodeControl(CatchUp{Id: id, Part: i, Parts: len(parts), Text: part})
+	}
+	return packets
+}
+
+// splitText splits text into parts of no more than maxBytes each,
+// without splitting any characters. There is always at least one part.
+func splitText(text string, maxBytes int) []string {
+	var parts []string
+	for len(text) > maxBytes {
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			// maxBytes is smaller than a character
+			_, cut = utf8.DecodeRuneInString(text)
+		}
+		parts = append(parts, text[:cut])
+		text = text[cut:]
+	}
+	return append(parts, text)
+}
+
+// AssembleCatchUp puts the parts of a catch-up back together,
+// in whatever order they were received.
+func AssembleCatchUp(parts []CatchUp) (past []string, live string, err error) {
+	if len(parts) == 0 {
+		return nil, "", fmt.Errorf("no catch-up parts")
+	}
+	sorted := slices.Clone(parts)
+	slices.SortFunc(sorted, func(a, b CatchUp) int { return a.Part - b.Part })
+	var b strings.Builder
+	for i, part := range sorted {
+		if part.Id != sorted[0].Id || part.Parts != len(sorted) || part.Part != i {
+			return nil, "", fmt.Errorf("catch-up part %d of %d (id %s) doesn't belong", part.Part, part.Parts, part.Id)
+		}
+		b.WriteString(part.Text)
+	}
+	lines := strings.Split(b.String(), "\n")
+	return lines[:len(lines)-1], lines[len(lines)-1], nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCatchUpPackets(t *testing.T) {
+	tests := []struct {
+		name     string
+		past     []string
+		live     string
+		maxBytes int
+		parts    int
+	}{
+		{"empty", nil, "", 100, 1},
+		{"live only", nil, "typing", 100, 1},
+		{"past only", []string{"one", "two"}, "", 100, 1},
+		{"pipes and newlines", []string{"a|b", `c\d`}, "e|", 100, 1},
+		{"split", []string{"first line", "second line"}, "live", 5, 6},
+		{"multi-byte", []string{"日本語"}, "🎉🎉", 4, 5},
+		{"tiny parts", []string{"日"}, "", 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets := CatchUpPackets("c1", tt.past, tt.live, tt.maxBytes)
+			if len(packets) != tt.parts {
+				t.Errorf("CatchUpPackets() made %d packets, want %d", len(packets), tt.parts)
+			}
+			var parts []CatchUp
+			for _, packet := range packets {
+				m, err := ParseControl(packet)
+				if err != nil {
+					t.Fatalf("ParseControl(%q) failed: %v", packet, err)
+				}
+				part := m.(CatchUp)
+				if len(part.Text) > max(tt.maxBytes, 4) {
+					t.Errorf("part %d has %d bytes, limit %d", part.Part, len(part.Text), tt.maxBytes)
+				}
+				parts = append(parts, part)
+			}
+			// parts may arrive in any order
+			slices.Reverse(parts)
+			past, live, err := AssembleCatchUp(parts)
+			if err != nil {
+				t.Fatalf("AssembleCatchUp() failed: %v", err)
+			}
+			if !slices.Equal(past, tt.past) {
+				t.Errorf("AssembleCatchUp() failed, got past %q, want %q", past, tt.past)
+			}
+			if live != tt.live {
+				t.Errorf("AssembleCatchUp() failed, got live %q, want %q", live, tt.live)
+			}
+		})
+	}
+}
+
+func TestAssembleCatchUpErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []CatchUp
+	}{
+		{"no parts", nil},
+		{"missing part", []CatchUp{{Id: "c", Part: 0, Parts: 2}}},
+		{"mixed ids", []CatchUp{{Id: "c", Part: 0, Parts: 2}, {Id: "d", Part: 1, Parts: 2}}},
+		{"duplicate part", []CatchUp{{Id: "c", Part: 0, Parts: 2}, {Id: "c", Part: 0, Parts: 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := AssembleCatchUp(tt.parts); err == nil {
+				t.Errorf("AssembleCatchUp() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -17,19 +17,54 @@ type ControlChunk struct {
 	Args   []string
 }
 
+// emptyArg is how a single empty argument is encoded, since `action|`
+// is how a chunk without arguments has always been encoded. It's a lone
+// escape character, which no escaped argument can be.
+const emptyArg = `\`
+
+// String encodes the chunk as `action|arg|...`, escaping any
+// pipes in the action and the arguments.
 func (c ControlChunk) String() string {
-	return fmt.Sprintf("%s|%s", c.Action, strings.Join(c.Args, "|"))
+	fields := make([]string, 0, len(c.Args)+1)
+	fields = append(fields, EscapeField(c.Action))
+	for _, arg := range c.Args {
+		fields = append(fields, EscapeField(arg))
+	}
+	switch {
+	case len(c.Args) == 0:
+		fields = append(fields, "")
+	case len(c.Args) == 1 && c.Args[0] == "":
+		fields[1] = emptyArg
+	}
+	return strings.Join(fields, "|")
 }
 
 func ParseControlChunk(s string) ControlChunk {
-	left, right, found := strings.Cut(s, "|")
-	if !found || right == "" {
-		return ControlChunk{Action: left, Args: nil}
+	if IsBinary(s) {
+		return parseBinaryControlChunk(s)
+	}
+	fields := splitFields(s, -1)
+	action := UnescapeField(fields[0])
+	if len(fields) == 1 || (len(fields) == 2 && fields[1] == "") {
+		return ControlChunk{Action: action, Args: nil}
+	}
+	if len(fields) == 2 && fields[1] == emptyArg {
+		return ControlChunk{Action: action, Args: []string{""}}
+	}
+	args := make([]string, len(fields)-1)
+	for i, field := range fields[1:] {
+		args[i] = UnescapeField(field)
 	}
-	return ControlChunk{Action: left, Args: strings.Split(right, "|")}
+	return ControlChunk{Action: action, Args: args}
 }
 
+// A ContentChunk is one edit to a whisperer's live text.
+//
+// Chunks may carry a sequence number, which each client increases by one
+// for every chunk it sends, so that receivers can detect lost chunks.
+// A zero Seq means the chunk is unsequenced (as sent by older clients).
 type ContentChunk struct {
+	Seq    int
 	Offset int
 	Text   string
 }
@@ -46,34 +81,54 @@ var ccNames = map[int]string{
 	CoIgnore:    "ignore",
 }
 
+// String encodes the chunk as `offset|text`, or as `seq:offset|text`
+// if the chunk is sequenced. The text is the last field, so it isn't escaped.
 func (c ContentChunk) String() string {
+	if c.Seq > 0 {
+		return fmt.Sprintf("%d:%d|%s", c.Seq, c.Offset, c.Text)
+	}
 	return fmt.Sprintf("%d|%s", c.Offset, c.Text)
 }
 
 func (c ContentChunk) DebugString() string {
+	prefix := ""
+	if c.Seq > 0 {
+		prefix = fmt.Sprintf("#%d ", c.Seq)
+	}
 	if c.Offset >= 0 {
-		return fmt.Sprintf("%d|%s", c.Offset, c.Text)
+		return fmt.Sprintf("%s%d|%s", prefix, c.Offset, c.Text)
 	}
 	name := ccNames[c.Offset]
 	if name == "" {
-		return fmt.Sprintf("unknown offset %d: %s", c.Offset, c.Text)
+		return fmt.Sprintf("%sunknown offset %d: %s", prefix, c.Offset, c.Text)
 	}
 	if c.Text == "" {
-		return name
+		return prefix + name
 	}
-	return fmt.Sprintf("%s: %s", name, c.Text)
+	return fmt.Sprintf("%s%s: %s", prefix, name, c.Text)
 }
 
 func ParseContentChunk(s string) ContentChunk {
+	if IsBinary(s) {
+		return parseBinaryContentChunk(s)
+	}
 	left, right, found := strings.Cut(s, "|")
 	if !found {
 		return ContentChunk{Offset: CoIgnore, Text: s}
 	}
+	seq := 0
+	if seqStr, offsetStr, ok := strings.Cut(left, ":"); ok {
+		var err error
+		if seq, err = strconv.Atoi(seqStr); err != nil || seq <= 0 {
+			return ContentChunk{Offset: CoIgnore, Text: s}
+		}
+		left = offsetStr
+	}
 	offset, err := strconv.Atoi(left)
 	if err != nil {
 		return ContentChunk{Offset: CoIgnore, Text: s}
 	}
-	return ContentChunk{Offset: offset, Text: right}
+	return ContentChunk{Seq: seq, Offset: offset, Text: right}
 }
 
 type ContentPacket struct {
@@ -84,18 +139,23 @@ type ContentPacket struct {
 
 type ContentReceiver chan ContentPacket
 
+// String encodes the packet as `packetId|clientId|data`. The IDs are
+// escaped, but the data is the last field, so it isn't.
 func (c ContentPacket) String() string {
-	return fmt.Sprintf("%s|%s|%s", c.PacketId, c.ClientId, c.Data)
+	return fmt.Sprintf("%s|%s|%s", EscapeField(c.PacketId), EscapeField(c.ClientId), c.Data)
 }
 
 func ParseContentPacket(s string) ContentPacket {
-	packetId, right, found := strings.Cut(s, "|")
-	if !found {
-		return ContentPacket{PacketId: packetId, ClientId: "", Data: ""}
+	if IsBinary(s) {
+		return parseBinaryContentPacket(s)
 	}
-	clientId, data, found := strings.Cut(right, "|")
-	if !found {
-		return ContentPacket{PacketId: packetId, ClientId: clientId, Data: ""}
+	fields := splitFields(s, 3)
+	p := ContentPacket{PacketId: UnescapeField(fields[0])}
+	if len(fields) > 1 {
+		p.ClientId = UnescapeField(fields[1])
+	}
+	if len(fields) > 2 {
+		p.Data = fields[2]
 	}
-	return ContentPacket{PacketId: packetId, ClientId: clientId, Data: data}
+	return p
 }
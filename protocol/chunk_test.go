@@ -19,7 +19,7 @@ func TestControlChunk_String(t *testing.T) {
 		{
 			name:     "Single action with single empty arg",
 			chunk:    ControlChunk{Action: "quit", Args: []string{""}},
-			expected: "quit|",
+			expected: `quit|\`,
 		},
 		{
 			name:     "Action with multiple args",
@@ -59,6 +59,11 @@ func TestParseControlChunk(t *testing.T) {
 			input:    "quit|",
 			expected: ControlChunk{Action: "quit", Args: nil},
 		},
+		{
+			name:     "Parse with action and encoded empty single argument",
+			input:    `quit|\`,
+			expected: ControlChunk{Action: "quit", Args: []string{""}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -88,6 +93,16 @@ func TestContentChunk_String(t *testing.T) {
 			chunk:    ContentChunk{Offset: 0, Text: ""},
 			expected: "0|",
 		},
+		{
+			name:     "Sequenced chunk",
+			chunk:    ContentChunk{Seq: 12, Offset: 3, Text: "abc"},
+			expected: "12:3|abc",
+		},
+		{
+			name:     "Sequenced negative offset",
+			chunk:    ContentChunk{Seq: 13, Offset: CoNewline, Text: ""},
+			expected: "13:-1|",
+		},
 	}
 
 	for _, tt := range tests {
@@ -126,6 +141,16 @@ func TestContentChunk_DebugString(t *testing.T) {
 			chunk:    ContentChunk{Offset: -999, Text: "UnknownError"},
 			expected: "unknown offset -999: UnknownError",
 		},
+		{
+			name:     "Sequenced positive offset",
+			chunk:    ContentChunk{Seq: 4, Offset: 5, Text: "Positive"},
+			expected: "#4 5|Positive",
+		},
+		{
+			name:     "Sequenced known negative offset",
+			chunk:    ContentChunk{Seq: 5, Offset: CoNewline, Text: ""},
+			expected: "#5 newline",
+		},
 	}
 
 	for _, tt := range tests {
@@ -164,6 +189,31 @@ func TestParseContentChunk(t *testing.T) {
 			input:    "MalformedText",
 			expected: ContentChunk{Offset: CoIgnore, Text: "MalformedText"},
 		},
+		{
+			name:     "Sequenced input",
+			input:    "7:2|lo",
+			expected: ContentChunk{Seq: 7, Offset: 2, Text: "lo"},
+		},
+		{
+			name:     "Sequenced negative input",
+			input:    "8:-1|",
+			expected: ContentChunk{Seq: 8, Offset: CoNewline, Text: ""},
+		},
+		{
+			name:     "Non-numeric sequence",
+			input:    "x:2|lo",
+			expected: ContentChunk{Offset: CoIgnore, Text: "x:2|lo"},
+		},
+		{
+			name:     "Zero sequence",
+			input:    "0:2|lo",
+			expected: ContentChunk{Offset: CoIgnore, Text: "0:2|lo"},
+		},
+		{
+			name:     "Colon in text",
+			input:    "3|a:b",
+			expected: ContentChunk{Offset: 3, Text: "a:b"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -8,59 +8,69 @@ package protocol
 
 import "strings"
 
-// ProcessLiveChunk "plays" an incoming content chunk against the current live text.
+// ProcessLiveChunk "plays" an incoming content chunk against the current live text,
+// interpreting the chunk offset in the unit used by the client that sent it.
 //
 // It produces as outputs the new live text and any created lines of past text.
 //
 // Note that not all chunks actually change text. If you pass, for example, a chunk
-// that says to play a sound, it will have no effect.
+// that says to play a sound, or any of the rich content chunks, it will have no effect.
+// (Corrections to past text are applied by the caller, which holds the past text.)
 //
 // If the offset of the chunk is longer than the current live text, the missing
-// space is filled with '?' characters.
-func ProcessLiveChunk(oldLive string, chunk ContentChunk) (newLive string, newPast []string) {
+// space is filled with '?' characters. If the offset falls inside a grapheme
+// cluster (such as an emoji with a skin tone), the whole cluster is replaced,
+// so the live text never holds a fragment of a character.
+func ProcessLiveChunk(oldLive string, chunk ContentChunk, unit OffsetUnit) (newLive string, newPast []string) {
 	if chunk.Offset < CoNewline {
 		return oldLive, nil
 	}
 	if chunk.Offset == CoNewline {
 		return "", []string{oldLive}
 	}
-	if chunk.Offset > len(oldLive) {
-		oldLive += strings.Repeat("?", chunk.Offset-len(oldLive))
+	if length := unit.Length(oldLive); chunk.Offset > length {
+		return oldLive + strings.Repeat("?", chunk.Offset-length) + chunk.Text, nil
 	}
-	return oldLive[0:chunk.Offset] + chunk.Text, nil
+	start := graphemeStart(oldLive, unit.ByteIndex(oldLive, chunk.Offset))
+	return oldLive[0:start] + chunk.Text, nil
 }
 
 // DiffLines creates the chunks that are sent when a user, whose current live
 // Text is `old`, alters that live Text to be `new` (by typing, or by a cut/paste
-// that contains multiple lines).
+// that contains multiple lines). Offsets are counted in the given unit, and
+// always fall on grapheme cluster boundaries.
 //
 // If the old and new strings are identical, the returned slice will be empty.
 // If the new string has no newlines, the returned slice will have one chunk.
 // Otherwise, the returned slice will have multiple chunks, and they have
 // to be processed in order to get the correct live and past Text at the end.
-func DiffLines(oldLive, newLive string) []ContentChunk {
-	for i := 0; i < len(oldLive) && i < len(newLive); i++ {
-		if oldLive[i] != newLive[i] {
-			return suffixToChunks(newLive, i)
+func DiffLines(oldLive, newLive string, unit OffsetUnit) []ContentChunk {
+	i := 0
+	for i < len(oldLive) && i < len(newLive) {
+		oldEnd, newEnd := nextGraphemeBoundary(oldLive, i), nextGraphemeBoundary(newLive, i)
+		if oldLive[i:oldEnd] != newLive[i:newEnd] {
+			return suffixToChunks(newLive, i, unit)
 		}
+		i = oldEnd
 	}
-	// fell through: either one is a proper substring of the other or they are identical
+	// fell through: either one is a proper prefix of the other or they are identical
 	if len(oldLive) < len(newLive) {
-		return suffixToChunks(newLive, len(oldLive))
+		return suffixToChunks(newLive, len(oldLive), unit)
 	}
 	if len(oldLive) > len(newLive) {
-		return []ContentChunk{{Offset: len(newLive), Text: ""}}
+		return []ContentChunk{{Offset: unit.Length(newLive), Text: ""}}
 	}
 	return nil
 }
 
-func suffixToChunks(s string, start int) []ContentChunk {
+// suffixToChunks makes the chunks for the text of s from byte index start.
+func suffixToChunks(s string, start int, unit OffsetUnit) []ContentChunk {
 	if len(s) <= start {
 		return nil
 	}
 	lines := strings.Split(s[start:], "\n")
 	result := make([]ContentChunk, 1, len(lines)*2-1)
-	result[0] = ContentChunk{Offset: start, Text: lines[0]}
+	result[0] = ContentChunk{Offset: unit.Offset(s, start), Text: lines[0]}
 	for i := 1; i < len(lines); i++ {
 		result = append(result, ContentChunk{Offset: CoNewline, Text: ""})
 		result = append(result, ContentChunk{Offset: 0, Text: lines[i]})
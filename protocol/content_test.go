@@ -55,7 +55,7 @@ func TestProcessLiveChunk(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actualLive, actualPast := ProcessLiveChunk(tt.oldLive, tt.chunk)
+			actualLive, actualPast := ProcessLiveChunk(tt.oldLive, tt.chunk, OffsetBytes)
 			if actualLive != tt.expectedLive {
 				t.Errorf("Expected live: %q, got: %q", tt.expectedLive, actualLive)
 			}
@@ -110,7 +110,7 @@ func TestDiffLines(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := DiffLines(tt.old, tt.new)
+			actual := DiffLines(tt.old, tt.new, OffsetBytes)
 			if len(actual) != len(tt.expected) {
 				t.Fatalf("Expected %d chunks, got %d", len(tt.expected), len(actual))
 			}
@@ -162,7 +162,7 @@ func TestSuffixToChunks(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actual := suffixToChunks(tt.text, tt.start)
+			actual := suffixToChunks(tt.text, tt.start, OffsetBytes)
 			if len(actual) != len(tt.expected) {
 				t.Fatalf("Expected %d chunks, got %d", len(tt.expected), len(actual))
 			}
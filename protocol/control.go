@@ -6,27 +6,117 @@
 
 package protocol
 
+import (
+	"fmt"
+	"strconv"
+)
+
+func init() {
+	registerControl("approve-requests", func([]string) (ControlMessage, error) {
+		return RequestsPending{}, nil
+	})
+	registerControl("participants-changed", func([]string) (ControlMessage, error) {
+		return ParticipantsChanged{}, nil
+	})
+	registerControl("past-text-speech-id", func(args []string) (ControlMessage, error) {
+		return PastTextSpeechId{PacketId: args[0], Line: int(parseInt(args[1])), SpeechId: args[2]}, nil
+	},
+		ArgSpec{Name: "packetId", Kind: ArgId},
+		ArgSpec{Name: "line", Kind: ArgInt},
+		ArgSpec{Name: "speechId", Kind: ArgId},
+	)
+	registerControl("resend-live", func([]string) (ControlMessage, error) {
+		return ResendLive{}, nil
+	})
+	registerControl("live-resynced", func(args []string) (ControlMessage, error) {
+		return LiveResynced{ClientId: args[0]}, nil
+	}, ArgSpec{Name: "clientId", Kind: ArgId})
+	registerControl("rate-warning", func(args []string) (ControlMessage, error) {
+		return RateWarning{Limit: args[0]}, nil
+	}, ArgSpec{Name: "limit", Kind: ArgId})
+	registerControl("muted", func(args []string) (ControlMessage, error) {
+		return Muted{Until: parseInt(args[0])}, nil
+	}, ArgSpec{Name: "until", Kind: ArgInt})
+	registerControl("content-encrypted", func([]string) (ControlMessage, error) {
+		return ContentEncrypted{}, nil
+	})
+	registerControl("end", func([]string) (ControlMessage, error) {
+		return End{}, nil
+	})
+	registerControl("encoding", func(args []string) (ControlMessage, error) {
+		switch e := Encoding(args[0]); e {
+		case EncodingText, EncodingBinary:
+			return EncodingChanged{Encoding: e}, nil
+		}
+		return nil, fmt.Errorf("unknown encoding %q", args[0])
+	}, ArgSpec{Name: "encoding", Kind: ArgId})
+	registerControl("idle-warning", func(args []string) (ControlMessage, error) {
+		return IdleWarning{Reason: args[0], EndsAt: parseInt(args[1])}, nil
+	}, ArgSpec{Name: "reason", Kind: ArgId}, ArgSpec{Name: "endsAt", Kind: ArgInt})
+	registerControl("listen-approved", func([]string) (ControlMessage, error) {
+		return ListenApproved{}, nil
+	})
+	registerControl("listen-denied", func([]string) (ControlMessage, error) {
+		return ListenDenied{}, nil
+	})
+	registerControl("removed", func(args []string) (ControlMessage, error) {
+		return Removed{Reason: args[0]}, nil
+	}, ArgSpec{Name: "reason", Kind: ArgId})
+	registerControl("recording", func(args []string) (ControlMessage, error) {
+		switch args[0] {
+		case RecordingOn, RecordingOff:
+			return Recording{State: args[0]}, nil
+		}
+		return nil, fmt.Errorf("unknown recording state %q", args[0])
+	}, ArgSpec{Name: "state", Kind: ArgId})
+}
+
+// RequestsPending tells a whisperer that listeners are waiting to be admitted.
+type RequestsPending struct{}
+
+func (RequestsPending) Action() string { return "approve-requests" }
+func (RequestsPending) Args() []string { return nil }
+
 func RequestsPendingPacket() string {
-	return ControlChunk{Action: "approve-requests"}.String()
+	return EncodeControl(RequestsPending{})
 }
 
 func IsRequestsPendingPacket(packet string) bool {
-	return ParseControlChunk(packet).Action == "approve-requests"
+	_, ok := parseAs[RequestsPending](packet)
+	return ok
 }
 
+// ParticipantsChanged tells clients to fetch the session's participants again.
+type ParticipantsChanged struct{}
+
+func (ParticipantsChanged) Action() string { return "participants-changed" }
+func (ParticipantsChanged) Args() []string { return nil }
+
 func ParticipantsChangedPacket() string {
-	return ControlChunk{Action: "participants-changed"}.String()
+	return EncodeControl(ParticipantsChanged{})
 }
 
 func IsParticipantsChangedPacket(packet string) bool {
-	return ParseControlChunk(packet).Action == "participants-changed"
+	_, ok := parseAs[ParticipantsChanged](packet)
+	return ok
+}
+
+// PastTextSpeechId tells clients the ID of the speech generated for a
+// line of past text. The line is identified by the packet that produced
+// it and its index in the lines produced by that packet.
+type PastTextSpeechId struct {
+	PacketId string
+	Line     int
+	SpeechId string
 }
 
-func PastTextSpeechIdPacket(packetId, sequenceNum, speechId string) string {
-	return ControlChunk{
-		Action: "past-text-speech-id",
-		Args:   []string{packetId, sequenceNum, speechId},
-	}.String()
+func (PastTextSpeechId) Action() string { return "past-text-speech-id" }
+func (m PastTextSpeechId) Args() []string {
+	return []string{m.PacketId, strconv.Itoa(m.Line), m.SpeechId}
+}
+
+func PastTextSpeechIdPacket(packetId string, line int, speechId string) string {
+	return EncodeControl(PastTextSpeechId{PacketId: packetId, Line: line, SpeechId: speechId})
 }
 
 // IsPastTextSpeechIdPacket checks if the given packet has action "past-text-speech-id".
@@ -35,16 +125,242 @@ func PastTextSpeechIdPacket(packetId, sequenceNum, speechId string) string {
 // which line of past text this was in the lines produced by that packet,
 // and the speech ID to request from the server for the generated speech.
 func IsPastTextSpeechIdPacket(packet string) (bool, string, string, string) {
-	if chunk := ParseControlChunk(packet); chunk.Action == "past-text-speech-id" {
-		return true, chunk.Args[0], chunk.Args[1], chunk.Args[2]
+	if m, ok := parseAs[PastTextSpeechId](packet); ok {
+		return true, m.PacketId, strconv.Itoa(m.Line), m.SpeechId
 	}
 	return false, "", "", ""
 }
 
+// ResendLive asks a whisperer to resend their entire live text,
+// as a single chunk at offset 0, because the server missed some of their chunks.
+type ResendLive struct{}
+
+func (ResendLive) Action() string { return "resend-live" }
+func (ResendLive) Args() []string { return nil }
+
+func ResendLivePacket() string {
+	return EncodeControl(ResendLive{})
+}
+
+func IsResendLivePacket(packet string) bool {
+	_, ok := parseAs[ResendLive](packet)
+	return ok
+}
+
+// LiveResynced tells listeners that the live text of the given
+// whisperer had to be resynchronized, so any copy of it they have
+// built from the chunks they received may be wrong.
+type LiveResynced struct {
+	ClientId string
+}
+
+func (LiveResynced) Action() string   { return "live-resynced" }
+func (m LiveResynced) Args() []string { return []string{m.ClientId} }
+
+func LiveResyncedPacket(clientId string) string {
+	return EncodeControl(LiveResynced{ClientId: clientId})
+}
+
+// IsLiveResyncedPacket checks if the given packet has action "live-resynced".
+// If it does, it also returns the client ID of the resynced whisperer.
+func IsLiveResyncedPacket(packet string) (bool, string) {
+	m, ok := parseAs[LiveResynced](packet)
+	return ok, m.ClientId
+}
+
+// RateWarning warns a client that it is sending content faster than
+// the named limit allows, and that the excess content is being dropped.
+type RateWarning struct {
+	Limit string
+}
+
+func (RateWarning) Action() string   { return "rate-warning" }
+func (m RateWarning) Args() []string { return []string{m.Limit} }
+
+func RateWarningPacket(limit string) string {
+	return EncodeControl(RateWarning{Limit: limit})
+}
+
+// IsRateWarningPacket checks if the given packet has action "rate-warning".
+// If it does, it also returns the name of the exceeded limit.
+func IsRateWarningPacket(packet string) (bool, string) {
+	m, ok := parseAs[RateWarning](packet)
+	return ok, m.Limit
+}
+
+// Muted tells a client that all its content will be dropped until
+// the given time (in epoch milliseconds), because it exceeded content limits.
+type Muted struct {
+	Until int64
+}
+
+func (Muted) Action() string   { return "muted" }
+func (m Muted) Args() []string { return []string{strconv.FormatInt(m.Until, 10)} }
+
+func MutedPacket(until int64) string {
+	return EncodeControl(Muted{Until: until})
+}
+
+// IsMutedPacket checks if the given packet has action "muted".
+// If it does, it also returns the time the mute ends.
+func IsMutedPacket(packet string) (bool, int64) {
+	m, ok := parseAs[Muted](packet)
+	return ok, m.Until
+}
+
+// ContentEncrypted tells participants that the session's content
+// is end-to-end encrypted, so the server will not transcribe it or
+// generate speech for it.
+type ContentEncrypted struct{}
+
+func (ContentEncrypted) Action() string { return "content-encrypted" }
+func (ContentEncrypted) Args() []string { return nil }
+
+func ContentEncryptedPacket() string {
+	return EncodeControl(ContentEncrypted{})
+}
+
+func IsContentEncryptedPacket(packet string) bool {
+	_, ok := parseAs[ContentEncrypted](packet)
+	return ok
+}
+
+// End tells participants that the session is over.
+type End struct{}
+
+func (End) Action() string { return "end" }
+func (End) Args() []string { return nil }
+
 func EndPacket() string {
-	return ControlChunk{Action: "end"}.String()
+	return EncodeControl(End{})
 }
 
 func IsEndPacket(packet string) bool {
-	return ParseControlChunk(packet).Action == "end"
+	_, ok := parseAs[End](packet)
+	return ok
+}
+
+// EncodingChanged tells participants which encoding to send content in,
+// because the set of participants able to read the binary encoding changed.
+type EncodingChanged struct {
+	Encoding Encoding
+}
+
+func (EncodingChanged) Action() string   { return "encoding" }
+func (m EncodingChanged) Args() []string { return []string{string(m.Encoding)} }
+
+func EncodingPacket(e Encoding) string {
+	return EncodeControl(EncodingChanged{Encoding: e})
+}
+
+// IsEncodingPacket checks if the given packet has action "encoding".
+// If it does, it also returns the encoding to use.
+func IsEncodingPacket(packet string) (bool, Encoding) {
+	m, ok := parseAs[EncodingChanged](packet)
+	return ok, m.Encoding
+}
+
+// IdleWarning tells participants that the session will be ended at the
+// given time (in epoch milliseconds) for the given reason, unless
+// something happens to keep it going.
+type IdleWarning struct {
+	Reason string
+	EndsAt int64
+}
+
+func (IdleWarning) Action() string { return "idle-warning" }
+func (m IdleWarning) Args() []string {
+	return []string{m.Reason, strconv.FormatInt(m.EndsAt, 10)}
+}
+
+func IdleWarningPacket(reason string, endsAt int64) string {
+	return EncodeControl(IdleWarning{Reason: reason, EndsAt: endsAt})
+}
+
+// IsIdleWarningPacket checks if the given packet has action "idle-warning".
+// If it does, it also returns the reason and when the session will end.
+func IsIdleWarningPacket(packet string) (bool, string, int64) {
+	m, ok := parseAs[IdleWarning](packet)
+	return ok, m.Reason, m.EndsAt
+}
+
+// ListenApproved tells a waiting listener that the whisperer has admitted
+// them. Their next pubsub token, from the authenticate endpoint, lets them
+// listen. (The token isn't in the packet because the control channel is
+// shared by all participants.)
+type ListenApproved struct{}
+
+func (ListenApproved) Action() string { return "listen-approved" }
+func (ListenApproved) Args() []string { return nil }
+
+func ListenApprovedPacket() string {
+	return EncodeControl(ListenApproved{})
+}
+
+func IsListenApprovedPacket(packet string) bool {
+	_, ok := parseAs[ListenApproved](packet)
+	return ok
+}
+
+// ListenDenied tells a waiting listener that the whisperer has turned them away.
+type ListenDenied struct{}
+
+func (ListenDenied) Action() string { return "listen-denied" }
+func (ListenDenied) Args() []string { return nil }
+
+func ListenDeniedPacket() string {
+	return EncodeControl(ListenDenied{})
+}
+
+func IsListenDeniedPacket(packet string) bool {
+	_, ok := parseAs[ListenDenied](packet)
+	return ok
+}
+
+// Removed tells a participant that the whisperer has removed them from the
+// session for the given reason, and that their pubsub access is revoked.
+type Removed struct {
+	Reason string
+}
+
+func (Removed) Action() string   { return "removed" }
+func (m Removed) Args() []string { return []string{m.Reason} }
+
+func RemovedPacket(reason string) string {
+	return EncodeControl(Removed{Reason: reason})
+}
+
+// IsRemovedPacket checks if the given packet has action "removed".
+// If it does, it also returns the reason for the removal.
+func IsRemovedPacket(packet string) (bool, string) {
+	m, ok := parseAs[Removed](packet)
+	return ok, m.Reason
+}
+
+const (
+	RecordingOn  = "on"
+	RecordingOff = "off"
+)
+
+// Recording tells participants whether the session is being transcribed.
+// Participants are told when it changes, and when they come online.
+type Recording struct {
+	State string
+}
+
+func (Recording) Action() string   { return "recording" }
+func (m Recording) Args() []string { return []string{m.State} }
+
+func RecordingPacket(on bool) string {
+	if on {
+		return EncodeControl(Recording{State: RecordingOn})
+	}
+	return EncodeControl(Recording{State: RecordingOff})
+}
+
+// IsRecordingPacket checks if the given packet has action "recording".
+// If it does, it also returns whether the session is being recorded.
+func IsRecordingPacket(packet string) (bool, bool) {
+	m, ok := parseAs[Recording](packet)
+	return ok, m.State == RecordingOn
 }
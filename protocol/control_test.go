@@ -83,3 +83,68 @@ func TestIsParticipantsChangedPacket(t *testing.T) {
 		})
 	}
 }
+
+func TestResendLivePacket(t *testing.T) {
+	packet := ResendLivePacket()
+	if packet != "resend-live|" {
+		t.Errorf("ResendLivePacket() failed, got %q, want %q", packet, "resend-live|")
+	}
+	if !IsResendLivePacket(packet) {
+		t.Errorf("IsResendLivePacket(%q) failed, got false, want true", packet)
+	}
+	if IsResendLivePacket("end|") {
+		t.Errorf("IsResendLivePacket(%q) failed, got true, want false", "end|")
+	}
+}
+
+func TestLiveResyncedPacket(t *testing.T) {
+	packet := LiveResyncedPacket("client1")
+	if packet != "live-resynced|client1" {
+		t.Errorf("LiveResyncedPacket() failed, got %q, want %q", packet, "live-resynced|client1")
+	}
+	if ok, clientId := IsLiveResyncedPacket(packet); !ok || clientId != "client1" {
+		t.Errorf("IsLiveResyncedPacket(%q) failed, got %v, %q", packet, ok, clientId)
+	}
+	if ok, _ := IsLiveResyncedPacket("live-resynced|"); ok {
+		t.Errorf("IsLiveResyncedPacket accepted a packet with no client ID")
+	}
+}
+
+func TestRateWarningPacket(t *testing.T) {
+	packet := RateWarningPacket("bytes")
+	if packet != "rate-warning|bytes" {
+		t.Errorf("RateWarningPacket() failed, got %q, want %q", packet, "rate-warning|bytes")
+	}
+	if ok, limit := IsRateWarningPacket(packet); !ok || limit != "bytes" {
+		t.Errorf("IsRateWarningPacket(%q) failed, got %v, %q", packet, ok, limit)
+	}
+	if ok, _ := IsRateWarningPacket("muted|12"); ok {
+		t.Errorf("IsRateWarningPacket accepted a muted packet")
+	}
+}
+
+func TestMutedPacket(t *testing.T) {
+	packet := MutedPacket(1700000000000)
+	if packet != "muted|1700000000000" {
+		t.Errorf("MutedPacket() failed, got %q, want %q", packet, "muted|1700000000000")
+	}
+	if ok, until := IsMutedPacket(packet); !ok || until != 1700000000000 {
+		t.Errorf("IsMutedPacket(%q) failed, got %v, %d", packet, ok, until)
+	}
+}
+
+func TestRecordingPacket(t *testing.T) {
+	packet := RecordingPacket(true)
+	if packet != "recording|on" {
+		t.Errorf("RecordingPacket() failed, got %q, want %q", packet, "recording|on")
+	}
+	if ok, on := IsRecordingPacket(packet); !ok || !on {
+		t.Errorf("IsRecordingPacket(%q) failed, got %v, %v", packet, ok, on)
+	}
+	if ok, on := IsRecordingPacket(RecordingPacket(false)); !ok || on {
+		t.Errorf("IsRecordingPacket(%q) failed, got %v, %v", RecordingPacket(false), ok, on)
+	}
+	if ok, _ := IsRecordingPacket("recording|maybe"); ok {
+		t.Errorf("IsRecordingPacket accepted an unknown state")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// In an encrypted session, the whisperer encrypts each content chunk
+// with AES-256-GCM under the session's content key, and sends packet
+// data of the form `enc|<base64 of nonce followed by ciphertext>`.
+// Receivers that don't know the key parse this as an ignorable chunk.
+const encryptedPrefix = "enc|"
+
+// ContentKeySize is the size in bytes of a session content key.
+const ContentKeySize = 32
+
+// NewContentKey generates a random session content key.
+func NewContentKey() ([]byte, error) {
+	key := make([]byte, ContentKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// IsEncryptedContent checks whether content packet data is an encrypted chunk.
+func IsEncryptedContent(data string) bool {
+	return strings.HasPrefix(data, encryptedPrefix)
+}
+
+func EncryptContentChunk(key []byte, chunk ContentChunk) (string, error) {
+	aead, err := contentCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(chunk.String()), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func DecryptContentChunk(key []byte, data string) (ContentChunk, error) {
+	if !IsEncryptedContent(data) {
+		return ContentChunk{}, fmt.Errorf("content is not encrypted")
+	}
+	aead, err := contentCipher(key)
+	if err != nil {
+		return ContentChunk{}, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(data[len(encryptedPrefix):])
+	if err != nil {
+		return ContentChunk{}, fmt.Errorf("encrypted content is not base64: %v", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return ContentChunk{}, fmt.Errorf("encrypted content is too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return ContentChunk{}, err
+	}
+	return ParseContentChunk(string(plain)), nil
+}
+
+func contentCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != ContentKeySize {
+		return nil, fmt.Errorf("content key must be %d bytes, not %d", ContentKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import "testing"
+
+func TestEncryptDecryptContentChunk(t *testing.T) {
+	key, err := NewContentKey()
+	if err != nil {
+		t.Fatalf("NewContentKey() failed: %v", err)
+	}
+	chunk := ContentChunk{Seq: 3, Offset: 4, Text: "private"}
+	data, err := EncryptContentChunk(key, chunk)
+	if err != nil {
+		t.Fatalf("EncryptContentChunk() failed: %v", err)
+	}
+	if !IsEncryptedContent(data) {
+		t.Errorf("IsEncryptedContent(%q) is false", data)
+	}
+	if parsed := ParseContentChunk(data); parsed.Offset != CoIgnore {
+		t.Errorf("encrypted data parsed as a live chunk: %+v", parsed)
+	}
+	result, err := DecryptContentChunk(key, data)
+	if err != nil {
+		t.Fatalf("DecryptContentChunk() failed: %v", err)
+	}
+	if result != chunk {
+		t.Errorf("DecryptContentChunk() got %+v, want %+v", result, chunk)
+	}
+	other, _ := NewContentKey()
+	if _, err := DecryptContentChunk(other, data); err == nil {
+		t.Errorf("DecryptContentChunk() succeeded with the wrong key")
+	}
+	if _, err := DecryptContentChunk(key, chunk.String()); err == nil {
+		t.Errorf("DecryptContentChunk() succeeded on plain text")
+	}
+	if _, err := EncryptContentChunk(key[:16], chunk); err == nil {
+		t.Errorf("EncryptContentChunk() succeeded with a short key")
+	}
+}
+
+func TestContentEncryptedPacket(t *testing.T) {
+	packet := ContentEncryptedPacket()
+	if packet != "content-encrypted|" {
+		t.Errorf("ContentEncryptedPacket() failed, got %q, want %q", packet, "content-encrypted|")
+	}
+	if !IsContentEncryptedPacket(packet) {
+		t.Errorf("IsContentEncryptedPacket(%q) failed, got false, want true", packet)
+	}
+}
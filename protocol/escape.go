@@ -0,0 +1,66 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import "strings"
+
+// Packets are pipe-delimited, so fields that can contain a '|' are escaped
+// by putting a '\' before every '|' and '\' in them. The bytes that tag
+// binary packets are escaped the same way, so that no text packet can
+// start with one. The last field of a packet is never escaped, because
+// parsers split off the fields before it and take the rest of the packet as is.
+//
+// Unescaping is lenient: a '\' that isn't followed by one of the escaped
+// bytes is kept, so packets from clients that don't escape parse the same
+// as they always have, unless a field happened to contain an escape sequence.
+
+var fieldEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`,
+	"\x01", "\\\x01", "\x02", "\\\x02", "\x03", "\\\x03", "\x04", "\\\x04")
+
+// isEscaped tells whether a byte is one that EscapeField escapes.
+func isEscaped(b byte) bool {
+	return b == '\\' || b == '|' || (b >= tagChunk && b <= tagControl)
+}
+
+// EscapeField escapes a field so it can be put in a pipe-delimited packet.
+func EscapeField(s string) string {
+	return fieldEscaper.Replace(s)
+}
+
+// UnescapeField reverses EscapeField.
+func UnescapeField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isEscaped(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// splitFields splits a packet at its unescaped pipes, into at most n
+// fields (or all the fields, if n < 0). The fields are not unescaped,
+// and the last one is the rest of the packet.
+func splitFields(s string, n int) []string {
+	var fields []string
+	start := 0
+	for i := 0; i < len(s) && (n < 0 || len(fields) < n-1); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '|':
+			fields = append(fields, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, s[start:])
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestEscapeField(t *testing.T) {
+	tests := []struct {
+		field    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"a|b", `a\|b`},
+		{`C:\path`, `C:\\path`},
+		{`\|`, `\\\|`},
+		{"\x03tag", "\\\x03tag"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if actual := EscapeField(tt.field); actual != tt.expected {
+			t.Errorf("EscapeField(%q) failed, got %q, want %q", tt.field, actual, tt.expected)
+		}
+		if actual := UnescapeField(tt.expected); actual != tt.field {
+			t.Errorf("UnescapeField(%q) failed, got %q, want %q", tt.expected, actual, tt.field)
+		}
+	}
+}
+
+// TestUnescapedTraffic checks that packets from clients that don't escape
+// still parse as they always have.
+func TestUnescapedTraffic(t *testing.T) {
+	control := ParseControlChunk(`rate-warning|C:\path\file`)
+	if diff := deep.Equal(control, ControlChunk{Action: "rate-warning", Args: []string{`C:\path\file`}}); diff != nil {
+		t.Errorf("ParseControlChunk() of unescaped packet: %v", diff)
+	}
+	packet := ParseContentPacket(`id-1|client-1|0|a|b\c`)
+	if diff := deep.Equal(packet, ContentPacket{PacketId: "id-1", ClientId: "client-1", Data: `0|a|b\c`}); diff != nil {
+		t.Errorf("ParseContentPacket() of unescaped packet: %v", diff)
+	}
+	chunk := ParseContentChunk(`3|x|y\`)
+	if diff := deep.Equal(chunk, ContentChunk{Offset: 3, Text: `x|y\`}); diff != nil {
+		t.Errorf("ParseContentChunk() of unescaped chunk: %v", diff)
+	}
+}
+
+func FuzzControlChunk(f *testing.F) {
+	f.Add("live-resynced", "client|1", `back\slash`)
+	f.Add("a|b", "", "")
+	f.Add(`\`, `\|`, `|\`)
+	// fields that start with a binary tag byte
+	f.Add("\x03", "", "0")
+	f.Add("\x04", "\x01", "\x02")
+	f.Fuzz(func(t *testing.T, action, arg1, arg2 string) {
+		// also try fewer arguments, so no arguments and a single empty one are told apart
+		for _, args := range [][]string{nil, {arg1}, {arg1, arg2}} {
+			chunk := ControlChunk{Action: action, Args: args}
+			parsed := ParseControlChunk(chunk.String())
+			if diff := deep.Equal(parsed, chunk); diff != nil {
+				t.Errorf("ControlChunk %q didn't round trip: %v", chunk.String(), diff)
+			}
+		}
+	})
+}
+
+func FuzzContentPacket(f *testing.F) {
+	f.Add("packet|1", `client\1`, "0|text|with|pipes")
+	f.Add("", "", "")
+	f.Add(`\`, `|`, `\|`)
+	// fields that start with a binary tag byte
+	f.Add("\x01", "0", "0")
+	f.Add("\x03", "\x04", "\x02|x")
+	f.Fuzz(func(t *testing.T, packetId, clientId, data string) {
+		packet := ContentPacket{PacketId: packetId, ClientId: clientId, Data: data}
+		parsed := ParseContentPacket(packet.String())
+		if parsed != packet {
+			t.Errorf("ContentPacket %q didn't round trip, got %+v", packet.String(), parsed)
+		}
+	})
+}
+
+func FuzzContentChunk(f *testing.F) {
+	f.Add(0, 5, "text|with|pipes")
+	f.Add(12, CoNewline, "")
+	f.Add(3, 0, `\|\`)
+	f.Fuzz(func(t *testing.T, seq, offset int, text string) {
+		if seq < 0 {
+			seq = 0
+		}
+		chunk := ContentChunk{Seq: seq, Offset: offset, Text: text}
+		parsed := ParseContentChunk(chunk.String())
+		if parsed != chunk {
+			t.Errorf("ContentChunk %q didn't round trip, got %+v", chunk.String(), parsed)
+		}
+	})
+}
+
+func FuzzParseControl(f *testing.F) {
+	f.Add("past-text-speech-id|p|1|s")
+	f.Add("past-text-speech-id|p")
+	f.Add(`hello|2|a\|b,c`)
+	f.Fuzz(func(t *testing.T, packet string) {
+		m, err := ParseControl(packet)
+		if err != nil {
+			return
+		}
+		// anything that parses must re-encode to something that parses the same
+		again, err := ParseControl(EncodeControl(m))
+		if err != nil {
+			t.Fatalf("re-encoded %q doesn't parse: %v", packet, err)
+		}
+		if diff := deep.Equal(again, m); diff != nil {
+			t.Errorf("re-encoded %q parses differently: %v", packet, diff)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A ControlMessage is the typed form of a control packet. Each action
+// has its own message type, registered along with the schema of its
+// arguments, so that packets can be validated as they are parsed.
+type ControlMessage interface {
+	Action() string
+	Args() []string
+}
+
+// EncodeControl produces the packet for a control message.
+func EncodeControl(m ControlMessage) string {
+	return ControlChunk{Action: m.Action(), Args: m.Args()}.String()
+}
+
+// An ArgKind says what values a control message argument can take.
+type ArgKind string
+
+const (
+	ArgString ArgKind = "string" // any text, including empty
+	ArgId     ArgKind = "id"     // non-empty text
+	ArgInt    ArgKind = "int"    // a non-negative decimal integer
+	ArgList   ArgKind = "list"   // comma-separated non-empty items, possibly none
+)
+
+// An ArgSpec declares one argument of a control message.
+// Optional arguments can only follow required ones.
+type ArgSpec struct {
+	Name     string
+	Kind     ArgKind
+	Optional bool
+}
+
+type controlSpec struct {
+	args   []ArgSpec
+	decode func(args []string) (ControlMessage, error)
+}
+
+var controlSpecs = make(map[string]controlSpec)
+
+// registerControl declares a control action. The decode function is only
+// called with arguments that match the schema, and with any missing
+// optional arguments filled in as empty strings.
+func registerControl(action string, decode func(args []string) (ControlMessage, error), args ...ArgSpec) {
+	if _, ok := controlSpecs[action]; ok {
+		panic(fmt.Sprintf("control action %q registered twice", action))
+	}
+	controlSpecs[action] = controlSpec{args: args, decode: decode}
+}
+
+// ControlActions lists all the registered control actions, in order.
+func ControlActions() []string {
+	actions := make([]string, 0, len(controlSpecs))
+	for action := range controlSpecs {
+		actions = append(actions, action)
+	}
+	slices.Sort(actions)
+	return actions
+}
+
+// ControlSchema returns the declared arguments of a control action.
+func ControlSchema(action string) ([]ArgSpec, bool) {
+	spec, ok := controlSpecs[action]
+	return slices.Clone(spec.args), ok
+}
+
+// ParseControl parses a control packet into its typed message,
+// or explains why the packet is not valid.
+func ParseControl(packet string) (ControlMessage, error) {
+	chunk := ParseControlChunk(packet)
+	spec, args, err := checkControl(chunk)
+	if err != nil {
+		return nil, err
+	}
+	m, err := spec.decode(args)
+	if err != nil {
+		return nil, fmt.Errorf("control action %q: %v", chunk.Action, err)
+	}
+	return m, nil
+}
+
+// checkControl checks a control chunk against the schema of its action,
+// and returns the spec and the arguments, with any missing optional ones
+// filled in as empty strings.
+func checkControl(chunk ControlChunk) (controlSpec, []string, error) {
+	spec, ok := controlSpecs[chunk.Action]
+	if !ok {
+		return spec, nil, fmt.Errorf("unknown control action %q", chunk.Action)
+	}
+	args := chunk.Args
+	required := 0
+	for _, a := range spec.args {
+		if !a.Optional {
+			required++
+		}
+	}
+	// a single empty argument is how packets without arguments are encoded
+	if len(args) == 1 && args[0] == "" && required == 0 {
+		args = nil
+	}
+	if len(args) < required || len(args) > len(spec.args) {
+		return spec, nil, fmt.Errorf("control action %q takes %s, got %d", chunk.Action, argCount(required, len(spec.args)), len(args))
+	}
+	for i, a := range spec.args[:len(args)] {
+		if err := a.validate(args[i]); err != nil {
+			return spec, nil, fmt.Errorf("control action %q: %v", chunk.Action, err)
+		}
+	}
+	for len(args) < len(spec.args) {
+		args = append(args, "")
+	}
+	return spec, args, nil
+}
+
+func argCount(required, total int) string {
+	switch {
+	case total == 0:
+		return "no arguments"
+	case required == total && total == 1:
+		return "1 argument"
+	case required == total:
+		return fmt.Sprintf("%d arguments", total)
+	}
+	return fmt.Sprintf("%d to %d arguments", required, total)
+}
+
+func (a ArgSpec) validate(arg string) error {
+	switch a.Kind {
+	case ArgId:
+		if arg == "" {
+			return fmt.Errorf("argument %q is empty", a.Name)
+		}
+	case ArgInt:
+		if n, err := strconv.ParseInt(arg, 10, 64); err != nil || n < 0 {
+			return fmt.Errorf("argument %q is not a non-negative integer: %q", a.Name, arg)
+		}
+	case ArgList:
+		if arg != "" && slices.Contains(strings.Split(arg, ","), "") {
+			return fmt.Errorf("argument %q has an empty item: %q", a.Name, arg)
+		}
+	}
+	return nil
+}
+
+// parseList splits a validated list argument.
+func parseList(arg string) []string {
+	if arg == "" {
+		return []string{}
+	}
+	return strings.Split(arg, ",")
+}
+
+// parseInt converts a validated integer argument.
+func parseInt(arg string) int64 {
+	n, _ := strconv.ParseInt(arg, 10, 64)
+	return n
+}
+
+// parseAs parses a control packet that is expected to have a specific type.
+func parseAs[T ControlMessage](packet string) (T, bool) {
+	m, err := ParseControl(packet)
+	if err != nil {
+		var zero T
+		return zero, false
+	}
+	t, ok := m.(T)
+	return t, ok
+}
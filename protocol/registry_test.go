@@ -0,0 +1,106 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestControlRoundTrip(t *testing.T) {
+	covered := make(map[string]bool)
+	for _, m := range controlSamples {
+		covered[m.Action()] = true
+		packet := EncodeControl(m)
+		parsed, err := ParseControl(packet)
+		if err != nil {
+			t.Errorf("ParseControl(%q) failed: %v", packet, err)
+			continue
+		}
+		if diff := deep.Equal(parsed, m); diff != nil {
+			t.Errorf("ParseControl(%q) didn't round trip: %v", packet, diff)
+		}
+		if again := EncodeControl(parsed); again != packet {
+			t.Errorf("EncodeControl() of parsed %q failed, got %q", packet, again)
+		}
+		binaryPacket := EncodingBinary.Control(m)
+		if parsed, err := ParseControl(binaryPacket); err != nil || deep.Equal(parsed, m) != nil {
+			t.Errorf("binary %q didn't round trip, got %#v, %v", packet, parsed, err)
+		}
+	}
+	for _, action := range ControlActions() {
+		if !covered[action] {
+			t.Errorf("no round trip sample for control action %q", action)
+		}
+	}
+}
+
+func TestParseControlErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet string
+		error  string
+	}{
+		{"unknown action", "dance|now", `unknown control action "dance"`},
+		{"no action", "", `unknown control action ""`},
+		{"speech id missing args", "past-text-speech-id|packet-1", "takes 3 arguments, got 1"},
+		{"speech id bad line", "past-text-speech-id|packet-1|first|speech-1", `argument "line" is not a non-negative integer`},
+		{"speech id empty packet", "past-text-speech-id||0|speech-1", `argument "packetId" is empty`},
+		{"resynced without client", "live-resynced|", "takes 1 argument, got 0"},
+		{"negative mute", "muted|-5", `argument "until" is not a non-negative integer`},
+		{"end with args", "end|now", "takes no arguments, got 1"},
+		{"hello too many args", "hello|2|a|b", "takes 1 to 2 arguments, got 3"},
+		{"hello empty feature", "hello|2|a,,b", `argument "features" has an empty item`},
+		{"hello zero version", "hello|0|a", "protocol version 0 is not valid"},
+		{"unknown encoding", "encoding|morse", `unknown encoding "morse"`},
+		{"catch-up part out of range", "catch-up|c|2|2|text", "part 2 of 2 doesn't exist"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseControl(tt.packet)
+			if err == nil {
+				t.Fatalf("ParseControl(%q) failed, got %#v, want error", tt.packet, m)
+			}
+			if !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("ParseControl(%q) failed, got error %q, want %q", tt.packet, err, tt.error)
+			}
+		})
+	}
+}
+
+func TestIsPastTextSpeechIdPacket(t *testing.T) {
+	packet := PastTextSpeechIdPacket("packet-1", 2, "speech-1")
+	if packet != "past-text-speech-id|packet-1|2|speech-1" {
+		t.Errorf("PastTextSpeechIdPacket() failed, got %q", packet)
+	}
+	ok, packetId, line, speechId := IsPastTextSpeechIdPacket(packet)
+	if !ok || packetId != "packet-1" || line != "2" || speechId != "speech-1" {
+		t.Errorf("IsPastTextSpeechIdPacket(%q) failed, got %v, %q, %q, %q", packet, ok, packetId, line, speechId)
+	}
+	for _, malformed := range []string{"past-text-speech-id|", "past-text-speech-id|packet-1", "past-text-speech-id"} {
+		if ok, _, _, _ := IsPastTextSpeechIdPacket(malformed); ok {
+			t.Errorf("IsPastTextSpeechIdPacket(%q) accepted a malformed packet", malformed)
+		}
+	}
+}
+
+func TestControlSchema(t *testing.T) {
+	schema, ok := ControlSchema("past-text-speech-id")
+	expected := []ArgSpec{
+		{Name: "packetId", Kind: ArgId},
+		{Name: "line", Kind: ArgInt},
+		{Name: "speechId", Kind: ArgId},
+	}
+	if !ok || deep.Equal(schema, expected) != nil {
+		t.Errorf("ControlSchema() failed, got %v, %v", schema, ok)
+	}
+	if _, ok := ControlSchema("dance"); ok {
+		t.Errorf("ControlSchema() found an unregistered action")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rich content chunks add to live text without changing it. They use
+// offsets below CoPlaySound, and clients released before they existed
+// don't understand them, so a client may only send them if it negotiated
+// FeatureRichContent, and should only send them if every other participant
+// in the session has that feature too.
+const (
+	CoEmphasis     = -3 // Emphasize a span of live text, given by the chunk Text as `start:end`
+	CoHighlight    = -4 // Highlight a span of live text, given by the chunk Text as `start:end`
+	CoReplacePast  = -5 // Correct a line of past text, given by the chunk Text as `linesBack:text`
+	CoTypingPaused = -6 // The whisperer has paused typing (ignore chunk Text)
+	CoReaction     = -7 // Show the emoji reaction in the chunk Text
+)
+
+func init() {
+	ccNames[CoEmphasis] = "emphasis"
+	ccNames[CoHighlight] = "highlight"
+	ccNames[CoReplacePast] = "replace past"
+	ccNames[CoTypingPaused] = "typing paused"
+	ccNames[CoReaction] = "reaction"
+}
+
+// IsRich tells whether the chunk is one of the rich content kinds.
+func (c ContentChunk) IsRich() bool {
+	return c.Offset <= CoEmphasis && c.Offset >= CoReaction
+}
+
+// EmphasisChunk emphasizes the live text between two offsets,
+// counted in the sender's offset unit.
+func EmphasisChunk(start, end int) ContentChunk {
+	return ContentChunk{Offset: CoEmphasis, Text: fmt.Sprintf("%d:%d", start, end)}
+}
+
+// HighlightChunk highlights the live text between two offsets,
+// counted in the sender's offset unit.
+func HighlightChunk(start, end int) ContentChunk {
+	return ContentChunk{Offset: CoHighlight, Text: fmt.Sprintf("%d:%d", start, end)}
+}
+
+// Span returns the span of live text that an emphasis or highlight chunk marks.
+func (c ContentChunk) Span() (start, end int, ok bool) {
+	if c.Offset != CoEmphasis && c.Offset != CoHighlight {
+		return 0, 0, false
+	}
+	left, right, found := strings.Cut(c.Text, ":")
+	if !found {
+		return 0, 0, false
+	}
+	start, err1 := strconv.Atoi(left)
+	end, err2 := strconv.Atoi(right)
+	if err1 != nil || err2 != nil || start < 0 || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// ReplacePastChunk replaces a line of past text, counted back from the
+// most recent line (which is 1 line back), with corrected text.
+func ReplacePastChunk(linesBack int, text string) ContentChunk {
+	return ContentChunk{Offset: CoReplacePast, Text: fmt.Sprintf("%d:%s", linesBack, text)}
+}
+
+// Correction returns the line and corrected text of a replace past chunk.
+func (c ContentChunk) Correction() (linesBack int, text string, ok bool) {
+	if c.Offset != CoReplacePast {
+		return 0, "", false
+	}
+	left, text, found := strings.Cut(c.Text, ":")
+	if !found {
+		return 0, "", false
+	}
+	linesBack, err := strconv.Atoi(left)
+	if err != nil || linesBack < 1 {
+		return 0, "", false
+	}
+	return linesBack, text, true
+}
+
+func TypingPausedChunk() ContentChunk {
+	return ContentChunk{Offset: CoTypingPaused}
+}
+
+func ReactionChunk(emoji string) ContentChunk {
+	return ContentChunk{Offset: CoReaction, Text: emoji}
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import "testing"
+
+func TestRichChunks(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk ContentChunk
+		wire  string
+		debug string
+	}{
+		{"emphasis", EmphasisChunk(2, 5), "-3|2:5", "emphasis: 2:5"},
+		{"highlight", HighlightChunk(0, 3), "-4|0:3", "highlight: 0:3"},
+		{"replace past", ReplacePastChunk(1, "fixed: a|b"), "-5|1:fixed: a|b", "replace past: 1:fixed: a|b"},
+		{"typing paused", TypingPausedChunk(), "-6|", "typing paused"},
+		{"reaction", ReactionChunk("👍🏽"), "-7|👍🏽", "reaction: 👍🏽"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !tt.chunk.IsRich() {
+				t.Errorf("IsRich() failed for %s chunk", tt.name)
+			}
+			if wire := tt.chunk.String(); wire != tt.wire {
+				t.Errorf("String() failed, got %q, want %q", wire, tt.wire)
+			}
+			if parsed := ParseContentChunk(tt.wire); parsed != tt.chunk {
+				t.Errorf("ParseContentChunk(%q) failed, got %+v, want %+v", tt.wire, parsed, tt.chunk)
+			}
+			if debug := tt.chunk.DebugString(); debug != tt.debug {
+				t.Errorf("DebugString() failed, got %q, want %q", debug, tt.debug)
+			}
+			if live, past := ProcessLiveChunk("live", tt.chunk, OffsetUTF16); live != "live" || past != nil {
+				t.Errorf("ProcessLiveChunk() changed text, got %q, %v", live, past)
+			}
+		})
+	}
+	for _, c := range []ContentChunk{{Offset: 0}, {Offset: CoNewline}, {Offset: CoPlaySound}, {Offset: CoIgnore}} {
+		if c.IsRich() {
+			t.Errorf("IsRich() succeeded for offset %d", c.Offset)
+		}
+	}
+}
+
+func TestChunkSpan(t *testing.T) {
+	tests := []struct {
+		chunk      ContentChunk
+		start, end int
+		ok         bool
+	}{
+		{EmphasisChunk(1, 4), 1, 4, true},
+		{HighlightChunk(3, 3), 3, 3, true},
+		{ContentChunk{Offset: CoEmphasis, Text: "4:1"}, 0, 0, false},
+		{ContentChunk{Offset: CoEmphasis, Text: "-1:1"}, 0, 0, false},
+		{ContentChunk{Offset: CoHighlight, Text: "1"}, 0, 0, false},
+		{ContentChunk{Offset: CoReaction, Text: "1:2"}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, ok := tt.chunk.Span()
+		if start != tt.start || end != tt.end || ok != tt.ok {
+			t.Errorf("Span() of %q failed, got %d, %d, %v", tt.chunk.DebugString(), start, end, ok)
+		}
+	}
+}
+
+func TestChunkCorrection(t *testing.T) {
+	tests := []struct {
+		chunk     ContentChunk
+		linesBack int
+		text      string
+		ok        bool
+	}{
+		{ReplacePastChunk(1, "x:y"), 1, "x:y", true},
+		{ReplacePastChunk(3, ""), 3, "", true},
+		{ContentChunk{Offset: CoReplacePast, Text: "0:x"}, 0, "", false},
+		{ContentChunk{Offset: CoReplacePast, Text: "x"}, 0, "", false},
+		{ContentChunk{Offset: 0, Text: "1:x"}, 0, "", false},
+	}
+	for _, tt := range tests {
+		linesBack, text, ok := tt.chunk.Correction()
+		if linesBack != tt.linesBack || text != tt.text || ok != tt.ok {
+			t.Errorf("Correction() of %q failed, got %d, %q, %v", tt.chunk.DebugString(), linesBack, text, ok)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"slices"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+//go:embed typescript.ts.tmpl
+var typescriptTemplate string
+
+// WriteTypeScript writes TypeScript bindings for the text encoding of the
+// protocol: its constants, the schemas of the control actions, and the
+// functions that encode and parse packets.
+func WriteTypeScript(w io.Writer) error {
+	t, err := template.New("typescript").Funcs(template.FuncMap{
+		"ts": tsLiteral,
+	}).Parse(typescriptTemplate)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, typescriptData())
+}
+
+// tsLiteral writes a value as a TypeScript literal, preferring the
+// single-quoted strings used in the web apps.
+func tsLiteral(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	s := string(b)
+	if inner, ok := strings.CutPrefix(s, `"`); ok && !strings.ContainsAny(inner[:len(inner)-1], `'"\`) {
+		return "'" + inner[:len(inner)-1] + "'", nil
+	}
+	return s, nil
+}
+
+type tsConstant struct {
+	Name  string
+	Value any
+}
+
+type tsSchema struct {
+	Action string
+	Args   []ArgSpec
+}
+
+func typescriptData() any {
+	var offsets []tsConstant
+	for offset, name := range ccNames {
+		offsets = append(offsets, tsConstant{Name: camelCase(name), Value: offset})
+	}
+	slices.SortFunc(offsets, func(a, b tsConstant) int { return b.Value.(int) - a.Value.(int) })
+	var features []tsConstant
+	for _, feature := range ServerFeatures {
+		features = append(features, tsConstant{Name: camelCase(feature), Value: feature})
+	}
+	var schemas []tsSchema
+	for _, action := range ControlActions() {
+		args, _ := ControlSchema(action)
+		schemas = append(schemas, tsSchema{Action: action, Args: args})
+	}
+	return map[string]any{
+		"Version":           ProtocolVersion,
+		"MinVersion":        MinProtocolVersion,
+		"Features":          features,
+		"OffsetUnits":       []OffsetUnit{OffsetBytes, OffsetRunes, OffsetUTF16},
+		"DefaultOffsetUnit": DefaultOffsetUnit,
+		"Offsets":           offsets,
+		"Schemas":           schemas,
+	}
+}
+
+// camelCase turns names like "play sound" and "rate-limits" into identifiers.
+func camelCase(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == ' ' || r == '-' })
+	for i := 1; i < len(words); i++ {
+		r := []rune(words[i])
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, "")
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	tests := []struct {
+		path  string
+		write func(io.Writer) error
+	}{
+		{"testdata/vectors.json", WriteVectors},
+		{"../listen.js/src/protocol.gen.ts", WriteTypeScript},
+		{"../saywhat.js/src/protocol.gen.ts", WriteTypeScript},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var expected bytes.Buffer
+			if err := tt.write(&expected); err != nil {
+				t.Fatalf("generation failed: %v", err)
+			}
+			actual, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatalf("can't read generated file: %v", err)
+			}
+			if !bytes.Equal(actual, expected.Bytes()) {
+				t.Errorf("%s is out of date: run the protocol command from the repository root", tt.path)
+			}
+		})
+	}
+}
+
+func TestConformanceVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatalf("can't read vectors: %v", err)
+	}
+	var v Vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("can't parse vectors: %v", err)
+	}
+	for _, c := range v.ContentChunks {
+		expected := ContentChunk{Seq: c.Seq, Offset: c.Offset, Text: c.Text}
+		for _, packet := range []string{c.Packet, string(c.Binary)} {
+			if packet != "" && ParseContentChunk(packet) != expected {
+				t.Errorf("ParseContentChunk(%q) failed, got %v, want %v", packet, ParseContentChunk(packet), expected)
+			}
+		}
+	}
+	for _, p := range v.ContentPackets {
+		expected := ContentPacket{PacketId: p.PacketId, ClientId: p.ClientId, Data: p.Data}
+		for _, packet := range []string{p.Packet, string(p.Binary)} {
+			if packet != "" && ParseContentPacket(packet) != expected {
+				t.Errorf("ParseContentPacket(%q) failed, got %v, want %v", packet, ParseContentPacket(packet), expected)
+			}
+		}
+	}
+	for _, c := range v.Controls {
+		for _, packet := range []string{c.Packet, string(c.Binary)} {
+			if packet == "" {
+				continue
+			}
+			m, err := ParseControl(packet)
+			if err != nil {
+				t.Errorf("ParseControl(%q) failed: %v", packet, err)
+				continue
+			}
+			if diff := deep.Equal([]any{m.Action(), controlArgs(m)}, []any{c.Action, c.Args}); diff != nil {
+				t.Errorf("ParseControl(%q) failed: %v", packet, diff)
+			}
+		}
+	}
+	for _, bad := range v.InvalidControls {
+		if _, err := ParseControl(bad.Packet); err == nil {
+			t.Errorf("ParseControl(%q) accepted an invalid packet", bad.Packet)
+		}
+	}
+}
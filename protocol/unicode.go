@@ -0,0 +1,249 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// An OffsetUnit is what a client counts in when it computes the offset
+// of a content chunk. Each client negotiates its unit when it starts
+// whispering, because clients written in different languages count
+// differently: Swift and JavaScript strings count UTF-16 code units.
+type OffsetUnit string
+
+const (
+	OffsetBytes OffsetUnit = "bytes" // UTF-8 bytes, as Go strings count
+	OffsetRunes OffsetUnit = "runes" // Unicode code points
+	OffsetUTF16 OffsetUnit = "utf16" // UTF-16 code units, as Swift and JavaScript count
+)
+
+// DefaultOffsetUnit is the unit used by clients that don't negotiate one.
+// All the clients released before negotiation existed count UTF-16 code units.
+const DefaultOffsetUnit = OffsetUTF16
+
+// ParseOffsetUnit validates a unit named by a client.
+func ParseOffsetUnit(s string) (OffsetUnit, bool) {
+	switch u := OffsetUnit(s); u {
+	case OffsetBytes, OffsetRunes, OffsetUTF16:
+		return u, true
+	}
+	return DefaultOffsetUnit, false
+}
+
+// Length returns the length of s counted in the unit.
+func (u OffsetUnit) Length(s string) int {
+	switch u {
+	case OffsetBytes:
+		return len(s)
+	case OffsetRunes:
+		return utf8.RuneCountInString(s)
+	}
+	n := 0
+	for _, r := range s {
+		n += runeUTF16Len(r)
+	}
+	return n
+}
+
+// Offset converts a byte index into s to an offset counted in the unit.
+func (u OffsetUnit) Offset(s string, byteIndex int) int {
+	return u.Length(s[:byteIndex])
+}
+
+// ByteIndex converts an offset counted in the unit to a byte index into s.
+// An offset that falls inside an encoded character is moved back to the
+// start of that character, and an offset beyond the end of s gives len(s).
+func (u OffsetUnit) ByteIndex(s string, offset int) int {
+	if u == OffsetBytes {
+		if offset >= len(s) {
+			return len(s)
+		}
+		for offset > 0 && !utf8.RuneStart(s[offset]) {
+			offset--
+		}
+		return offset
+	}
+	n := 0
+	for i, r := range s {
+		if u == OffsetRunes {
+			n++
+		} else {
+			n += runeUTF16Len(r)
+		}
+		if n > offset {
+			return i
+		}
+	}
+	return len(s)
+}
+
+func runeUTF16Len(r rune) int {
+	if n := utf16.RuneLen(r); n > 0 {
+		return n
+	}
+	// invalid UTF-8 decodes as the replacement character
+	return 1
+}
+
+// graphemeStart returns the start of the grapheme cluster in s
+// that contains the byte at index i.
+func graphemeStart(s string, i int) int {
+	start := 0
+	for start < len(s) {
+		end := nextGraphemeBoundary(s, start)
+		if end > i {
+			return start
+		}
+		start = end
+	}
+	return len(s)
+}
+
+// nextGraphemeBoundary returns the end of the grapheme cluster in s that
+// starts at byte index i. It follows the extended grapheme cluster rules
+// of Unicode Annex #29, except that it doesn't handle prepended
+// concatenation marks, and it approximates the Extended_Pictographic
+// property by the blocks where emoji are assigned.
+func nextGraphemeBoundary(s string, i int) int {
+	if i >= len(s) {
+		return len(s)
+	}
+	prev, size := utf8.DecodeRuneInString(s[i:])
+	prevClass := graphemeClassOf(prev)
+	pictographic := prevClass == gcPictographic
+	regional := 0
+	if prevClass == gcRegional {
+		regional = 1
+	}
+	for j := i + size; j < len(s); j += size {
+		var next rune
+		next, size = utf8.DecodeRuneInString(s[j:])
+		nextClass := graphemeClassOf(next)
+		if !graphemesJoin(prevClass, nextClass, pictographic, regional) {
+			return j
+		}
+		switch nextClass {
+		case gcRegional:
+			regional++
+		case gcPictographic:
+			pictographic = true
+		case gcExtend, gcZWJ:
+		default:
+			pictographic = false
+		}
+		prevClass = nextClass
+	}
+	return len(s)
+}
+
+type graphemeClass int
+
+const (
+	gcOther graphemeClass = iota
+	gcCR
+	gcLF
+	gcControl
+	gcExtend
+	gcZWJ
+	gcSpacingMark
+	gcRegional
+	gcPictographic
+	gcHangulL
+	gcHangulV
+	gcHangulT
+	gcHangulLV
+	gcHangulLVT
+)
+
+// graphemesJoin decides whether two adjacent characters are in the same cluster.
+// The pictographic flag says whether the cluster so far is an emoji followed by
+// extenders, and the regional count is the number of regional indicators in it.
+func graphemesJoin(prev, next graphemeClass, pictographic bool, regional int) bool {
+	switch {
+	case prev == gcCR && next == gcLF:
+		return true
+	case prev == gcCR || prev == gcLF || prev == gcControl:
+		return false
+	case next == gcCR || next == gcLF || next == gcControl:
+		return false
+	case prev == gcHangulL:
+		if next == gcHangulL || next == gcHangulV || next == gcHangulLV || next == gcHangulLVT {
+			return true
+		}
+	case prev == gcHangulLV || prev == gcHangulV:
+		if next == gcHangulV || next == gcHangulT {
+			return true
+		}
+	case prev == gcHangulLVT || prev == gcHangulT:
+		if next == gcHangulT {
+			return true
+		}
+	}
+	switch {
+	case next == gcExtend || next == gcZWJ || next == gcSpacingMark:
+		return true
+	case prev == gcZWJ && next == gcPictographic:
+		return pictographic
+	case prev == gcRegional && next == gcRegional:
+		return regional%2 == 1
+	}
+	return false
+}
+
+func graphemeClassOf(r rune) graphemeClass {
+	switch {
+	case r == '\r':
+		return gcCR
+	case r == '\n':
+		return gcLF
+	case r == 0x200D:
+		return gcZWJ
+	case r == 0x200C, r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+		// zero width non-joiner, emoji skin tone modifiers, emoji tags
+		return gcExtend
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return gcExtend
+	case unicode.Is(unicode.Mc, r):
+		return gcSpacingMark
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return gcControl
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return gcRegional
+	case isPictographic(r):
+		return gcPictographic
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return gcHangulL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return gcHangulV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return gcHangulT
+	case r >= 0xAC00 && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return gcHangulLV
+		}
+		return gcHangulLVT
+	}
+	return gcOther
+}
+
+func isPictographic(r rune) bool {
+	switch {
+	case r == 0x00A9, r == 0x00AE, r == 0x203C, r == 0x2049, r == 0x2122, r == 0x2139:
+		return true
+	case r >= 0x2194 && r <= 0x21AA, r >= 0x2300 && r <= 0x23FF, r >= 0x25A0 && r <= 0x27BF:
+		return true
+	case r >= 0x2B00 && r <= 0x2BFF, r == 0x3030, r == 0x303D, r == 0x3297, r == 0x3299:
+		return true
+	case r >= 0x1F000 && r <= 0x1FAFF:
+		// excludes the regional indicators and skin tone modifiers, classified earlier
+		return true
+	}
+	return false
+}
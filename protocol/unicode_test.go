@@ -0,0 +1,271 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+var allOffsetUnits = []OffsetUnit{OffsetBytes, OffsetRunes, OffsetUTF16}
+
+func TestParseOffsetUnit(t *testing.T) {
+	for _, u := range allOffsetUnits {
+		if parsed, ok := ParseOffsetUnit(string(u)); !ok || parsed != u {
+			t.Errorf("ParseOffsetUnit(%q) failed, got %q, %v", u, parsed, ok)
+		}
+	}
+	if parsed, ok := ParseOffsetUnit("graphemes"); ok || parsed != DefaultOffsetUnit {
+		t.Errorf("ParseOffsetUnit(%q) failed, got %q, %v", "graphemes", parsed, ok)
+	}
+}
+
+func TestOffsetUnitLength(t *testing.T) {
+	tests := []struct {
+		text                string
+		bytes, runes, utf16 int
+	}{
+		{"hello", 5, 5, 5},
+		{"café", 5, 4, 4},
+		{"日本語", 9, 3, 3},
+		{"नमस्ते", 18, 6, 6},
+		{"👍🏽", 8, 2, 4},
+		{"🇺🇸", 8, 2, 4},
+		{"👨‍👩‍👧", 18, 5, 8},
+		{"a\xffb", 3, 3, 3},
+	}
+	for _, tt := range tests {
+		for u, expected := range map[OffsetUnit]int{OffsetBytes: tt.bytes, OffsetRunes: tt.runes, OffsetUTF16: tt.utf16} {
+			if actual := u.Length(tt.text); actual != expected {
+				t.Errorf("%s.Length(%q) failed, got %d, want %d", u, tt.text, actual, expected)
+			}
+		}
+	}
+}
+
+func TestOffsetUnitByteIndex(t *testing.T) {
+	text := "é👍x"
+	tests := []struct {
+		unit     OffsetUnit
+		offset   int
+		expected int
+	}{
+		{OffsetBytes, 0, 0},
+		{OffsetBytes, 1, 0}, // inside é
+		{OffsetBytes, 2, 2},
+		{OffsetBytes, 4, 2}, // inside 👍
+		{OffsetBytes, 6, 6},
+		{OffsetBytes, 9, 7},
+		{OffsetRunes, 1, 2},
+		{OffsetRunes, 2, 6},
+		{OffsetRunes, 3, 7},
+		{OffsetUTF16, 1, 2},
+		{OffsetUTF16, 2, 2}, // between the surrogates of 👍
+		{OffsetUTF16, 3, 6},
+		{OffsetUTF16, 4, 7},
+	}
+	for _, tt := range tests {
+		if actual := tt.unit.ByteIndex(text, tt.offset); actual != tt.expected {
+			t.Errorf("%s.ByteIndex(%q, %d) failed, got %d, want %d", tt.unit, text, tt.offset, actual, tt.expected)
+		}
+		if tt.expected < len(text) && tt.unit.ByteIndex(text, tt.unit.Offset(text, tt.expected)) != tt.expected {
+			t.Errorf("%s.Offset(%q, %d) doesn't round trip", tt.unit, text, tt.expected)
+		}
+	}
+}
+
+func graphemes(s string) []string {
+	var result []string
+	for i := 0; i < len(s); {
+		end := nextGraphemeBoundary(s, i)
+		result = append(result, s[i:end])
+		i = end
+	}
+	return result
+}
+
+func TestGraphemeClusters(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{"ascii", "abc", []string{"a", "b", "c"}},
+		{"crlf", "a\r\nb", []string{"a", "\r\n", "b"}},
+		{"combining accent", "cafe\u0301!", []string{"c", "a", "f", "e\u0301", "!"}},
+		{"devanagari", "नमस्ते", []string{"न", "म", "स्", "ते"}},
+		{"hangul jamo", "각한", []string{"각", "한"}},
+		{"skin tone", "👍🏽👍", []string{"👍🏽", "👍"}},
+		{"zwj family", "👨‍👩‍👧!", []string{"👨‍👩‍👧", "!"}},
+		{"flags", "🇺🇸🇫🇷🇩", []string{"🇺🇸", "🇫🇷", "🇩"}},
+		{"keycap", "1️⃣2", []string{"1️⃣", "2"}},
+		{"tag sequence", "🏴󠁧󠁢󠁳󠁣󠁴󠁿x", []string{"🏴󠁧󠁢󠁳󠁣󠁴󠁿", "x"}},
+		{"zwj after letter", "a‍👍", []string{"a‍", "👍"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := deep.Equal(graphemes(tt.text), tt.expected); diff != nil {
+				t.Errorf("graphemes(%q) failed: %v", tt.text, diff)
+			}
+		})
+	}
+}
+
+func TestUnicodeLiveChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldLive  string
+		newLive  string
+		expected map[OffsetUnit][]ContentChunk
+	}{
+		{
+			"append after accent",
+			"café",
+			"café au lait",
+			map[OffsetUnit][]ContentChunk{
+				OffsetBytes: {{Offset: 5, Text: " au lait"}},
+				OffsetRunes: {{Offset: 4, Text: " au lait"}},
+				OffsetUTF16: {{Offset: 4, Text: " au lait"}},
+			},
+		},
+		{
+			"change skin tone",
+			"hi 👋🏻",
+			"hi 👋🏾",
+			map[OffsetUnit][]ContentChunk{
+				OffsetBytes: {{Offset: 3, Text: "👋🏾"}},
+				OffsetRunes: {{Offset: 3, Text: "👋🏾"}},
+				OffsetUTF16: {{Offset: 3, Text: "👋🏾"}},
+			},
+		},
+		{
+			"add skin tone",
+			"ok 👍",
+			"ok 👍🏽 done",
+			map[OffsetUnit][]ContentChunk{
+				OffsetBytes: {{Offset: 3, Text: "👍🏽 done"}},
+				OffsetRunes: {{Offset: 3, Text: "👍🏽 done"}},
+				OffsetUTF16: {{Offset: 3, Text: "👍🏽 done"}},
+			},
+		},
+		{
+			"delete after emoji",
+			"🇯🇵 日本語",
+			"🇯🇵 日本",
+			map[OffsetUnit][]ContentChunk{
+				OffsetBytes: {{Offset: 15, Text: ""}},
+				OffsetRunes: {{Offset: 5, Text: ""}},
+				OffsetUTF16: {{Offset: 7, Text: ""}},
+			},
+		},
+		{
+			"combine accent",
+			"resume",
+			"resume\u0301",
+			map[OffsetUnit][]ContentChunk{
+				OffsetBytes: {{Offset: 5, Text: "e\u0301"}},
+				OffsetRunes: {{Offset: 5, Text: "e\u0301"}},
+				OffsetUTF16: {{Offset: 5, Text: "e\u0301"}},
+			},
+		},
+		{
+			"newline after emoji",
+			"👨‍👩‍👧",
+			"👨‍👩‍👧\nمرحبا",
+			map[OffsetUnit][]ContentChunk{
+				OffsetBytes: {{Offset: 18, Text: ""}, {Offset: CoNewline}, {Offset: 0, Text: "مرحبا"}},
+				OffsetRunes: {{Offset: 5, Text: ""}, {Offset: CoNewline}, {Offset: 0, Text: "مرحبا"}},
+				OffsetUTF16: {{Offset: 8, Text: ""}, {Offset: CoNewline}, {Offset: 0, Text: "مرحبا"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, u := range allOffsetUnits {
+			t.Run(tt.name+"/"+string(u), func(t *testing.T) {
+				chunks := DiffLines(tt.oldLive, tt.newLive, u)
+				if diff := deep.Equal(chunks, tt.expected[u]); diff != nil {
+					t.Errorf("DiffLines(%q, %q, %s) failed: %v", tt.oldLive, tt.newLive, u, diff)
+				}
+				checkPlayback(t, tt.oldLive, tt.newLive, chunks, u)
+			})
+		}
+	}
+}
+
+// TestUnicodeEditConformance checks that, for every pair of edits in a
+// multilingual corpus, playing the diff reproduces the edited text.
+func TestUnicodeEditConformance(t *testing.T) {
+	corpus := []string{
+		"",
+		"hello",
+		"héllo wörld",
+		"Straße",
+		"日本語のテキスト",
+		"नमस्ते दुनिया",
+		"안녕하세요",
+		"مرحبا بالعالم",
+		"שָׁלוֹם",
+		"👍🏽👍🏿 thumbs",
+		"👨‍👩‍👧‍👦 family",
+		"🇺🇸🇨🇦🇲🇽",
+		"1️⃣2️⃣3️⃣",
+		"mixed 日本 👋🏻 café\nsecond line 🎉",
+		"e\u0301e\u0301e\u0301",
+	}
+	for _, u := range allOffsetUnits {
+		for _, oldLive := range corpus {
+			for _, newLive := range corpus {
+				if strings.Contains(oldLive, "\n") {
+					continue
+				}
+				checkPlayback(t, oldLive, newLive, DiffLines(oldLive, newLive, u), u)
+			}
+		}
+	}
+}
+
+func checkPlayback(t *testing.T, oldLive, newLive string, chunks []ContentChunk, u OffsetUnit) {
+	t.Helper()
+	live, past := oldLive, []string(nil)
+	for _, chunk := range chunks {
+		if chunk.Offset >= 0 && graphemeStart(live, u.ByteIndex(live, chunk.Offset)) != u.ByteIndex(live, chunk.Offset) {
+			t.Errorf("DiffLines(%q, %q, %s) produced offset %d inside a grapheme cluster",
+				oldLive, newLive, u, chunk.Offset)
+		}
+		var newPast []string
+		live, newPast = ProcessLiveChunk(live, chunk, u)
+		past = append(past, newPast...)
+	}
+	if actual := strings.Join(append(past, live), "\n"); actual != newLive {
+		t.Errorf("playing DiffLines(%q, %q, %s) failed, got %q", oldLive, newLive, u, actual)
+	}
+}
+
+func TestProcessLiveChunkInsideCluster(t *testing.T) {
+	tests := []struct {
+		name     string
+		unit     OffsetUnit
+		oldLive  string
+		chunk    ContentChunk
+		expected string
+	}{
+		{"between surrogates", OffsetUTF16, "a👍b", ContentChunk{Offset: 2, Text: "!"}, "a!"},
+		{"before skin tone", OffsetRunes, "a👍🏽b", ContentChunk{Offset: 2, Text: "!"}, "a!"},
+		{"inside utf-8", OffsetBytes, "añb", ContentChunk{Offset: 2, Text: "n"}, "an"},
+		{"beyond emoji", OffsetUTF16, "👍", ContentChunk{Offset: 4, Text: "x"}, "👍??x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if live, _ := ProcessLiveChunk(tt.oldLive, tt.chunk, tt.unit); live != tt.expected {
+				t.Errorf("ProcessLiveChunk(%q, %v, %s) failed, got %q, want %q",
+					tt.oldLive, tt.chunk, tt.unit, live, tt.expected)
+			}
+		})
+	}
+}
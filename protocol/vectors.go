@@ -0,0 +1,221 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Vectors are conformance test cases for the protocol, generated from
+// this implementation so that clients written in other languages can
+// check that they encode and parse packets exactly the way it does.
+//
+// Text packets must parse to the given values and, unless they are marked
+// as parse-only, the values must encode to the packet. Binary packets
+// (base64 in JSON) must parse to the same values, and only need to be
+// checked by clients that negotiate FeatureBinary.
+type Vectors struct {
+	ProtocolVersion int                    `json:"protocolVersion"`
+	Escapes         []EscapeVector         `json:"escapes"`
+	ContentChunks   []ChunkVector          `json:"contentChunks"`
+	ContentPackets  []PacketVector         `json:"contentPackets"`
+	Controls        []ControlVector        `json:"controls"`
+	InvalidControls []InvalidControlVector `json:"invalidControls"`
+}
+
+type EscapeVector struct {
+	Field   string `json:"field"`
+	Escaped string `json:"escaped"`
+}
+
+type ChunkVector struct {
+	Packet    string `json:"packet"`
+	Binary    []byte `json:"binary,omitempty"`
+	ParseOnly bool   `json:"parseOnly,omitempty"`
+	Seq       int    `json:"seq"`
+	Offset    int    `json:"offset"`
+	Text      string `json:"text"`
+}
+
+type PacketVector struct {
+	Packet    string `json:"packet"`
+	Binary    []byte `json:"binary,omitempty"`
+	ParseOnly bool   `json:"parseOnly,omitempty"`
+	PacketId  string `json:"packetId"`
+	ClientId  string `json:"clientId"`
+	Data      string `json:"data"`
+}
+
+type ControlVector struct {
+	Packet    string   `json:"packet"`
+	Binary    []byte   `json:"binary,omitempty"`
+	ParseOnly bool     `json:"parseOnly,omitempty"`
+	Action    string   `json:"action"`
+	Args      []string `json:"args"`
+}
+
+// An InvalidControlVector is a packet that must be rejected. If Schema is
+// true, the packet doesn't match the schema of its action, so even a
+// parser that only knows the schemas must reject it.
+type InvalidControlVector struct {
+	Packet string `json:"packet"`
+	Schema bool   `json:"schema"`
+	Error  string `json:"error"`
+}
+
+// controlSamples has at least one message of every registered action.
+var controlSamples = []ControlMessage{
+	RequestsPending{},
+	ParticipantsChanged{},
+	PastTextSpeechId{PacketId: "packet-1", Line: 0, SpeechId: "speech-1"},
+	PastTextSpeechId{PacketId: "packet-2", Line: 12, SpeechId: "speech-2"},
+	ResendLive{},
+	LiveResynced{ClientId: "client-1"},
+	RateWarning{Limit: "session bytes"},
+	Muted{Until: 1736196000000},
+	ContentEncrypted{},
+	End{},
+	Hello{Capabilities: Capabilities{Version: 2, Features: []string{FeatureSequenced, FeatureResync}}},
+	Hello{Capabilities: Capabilities{Version: 1, Features: []string{}}},
+	Welcome{Capabilities: Capabilities{Version: 2, Features: []string{FeatureEncryption}}},
+	Incompatible{MinVersion: 1, Missing: []string{FeatureEncryption}},
+	EncodingChanged{Encoding: EncodingBinary},
+	EncodingChanged{Encoding: EncodingText},
+	CatchUp{Id: "catch-1", Part: 0, Parts: 2, Text: "past|line\nlive"},
+	RequestCatchUp{},
+	IdleWarning{Reason: "whisperer-absent", EndsAt: 1736196060000},
+	ListenApproved{},
+	ListenDenied{},
+	Removed{Reason: "banned"},
+	RoleChanged{ClientId: "client-2", Role: RoleWhisperer},
+	WhispererLive{ClientId: "client-2", Text: "half a|line"},
+	WhispererLivePart{ClientId: "client-2", Id: "live-1", Part: 0, Parts: 2, Text: "part of a|line"},
+	Recording{State: RecordingOn},
+}
+
+// controlParseOnlySamples are packets that parse, but aren't what
+// the server would send.
+var controlParseOnlySamples = []string{
+	"end",
+	"hello|2",
+	`live-resynced|client\x`,
+	`end|\`,
+}
+
+var invalidControlSamples = []string{
+	"dance|now",
+	"",
+	"past-text-speech-id|packet-1",
+	"past-text-speech-id|packet-1|first|speech-1",
+	"past-text-speech-id||0|speech-1",
+	"live-resynced|",
+	`live-resynced|\`,
+	"muted|-5",
+	"end|now",
+	"hello|2|a|b",
+	"hello|2|a,,b",
+	"hello|0|a",
+	"encoding|morse",
+	"catch-up|c|2|2|text",
+}
+
+var chunkSamples = []ContentChunk{
+	{Offset: 0, Text: "hello"},
+	{Seq: 3, Offset: 5, Text: " world"},
+	{Offset: 12, Text: "日本語 🎉"},
+	{Offset: 0, Text: `pipes | and \ stay raw`},
+	{Offset: CoNewline},
+	{Seq: 7, Offset: CoNewline},
+	{Offset: CoPlaySound, Text: "alert"},
+	EmphasisChunk(0, 5),
+	HighlightChunk(2, 4),
+	ReplacePastChunk(1, "fixed|text"),
+	TypingPausedChunk(),
+	ReactionChunk("🎉"),
+}
+
+var chunkParseOnlySamples = []string{"no pipe", "x|y", "0:3|z", "-1|ignored text"}
+
+var packetSamples = []ContentPacket{
+	{PacketId: "8f1b1c8e-4b5f-4d2c-9c1a-0e6f2b7d3a91", ClientId: "0aa7d570-0063-4f91-bfa4-89c46cdb4adb", Data: "0|hello"},
+	{PacketId: "a|b", ClientId: `c\d`, Data: "5|x|y"},
+	{PacketId: "p1", ClientId: "c1", Data: ""},
+}
+
+var packetParseOnlySamples = []string{"p1", "p1|c1"}
+
+var escapeSamples = []string{"", "plain", "a|b", `a\b`, `\|`, `trailing\`, "日本|語", "\x03tagged", "a\x01b"}
+
+// ConformanceVectors generates the conformance test cases.
+func ConformanceVectors() Vectors {
+	v := Vectors{ProtocolVersion: ProtocolVersion}
+	for _, s := range escapeSamples {
+		v.Escapes = append(v.Escapes, EscapeVector{Field: s, Escaped: EscapeField(s)})
+	}
+	for _, c := range chunkSamples {
+		v.ContentChunks = append(v.ContentChunks, ChunkVector{
+			Packet: c.String(), Binary: []byte(EncodingBinary.Chunk(c)), Seq: c.Seq, Offset: c.Offset, Text: c.Text,
+		})
+	}
+	for _, s := range chunkParseOnlySamples {
+		c := ParseContentChunk(s)
+		v.ContentChunks = append(v.ContentChunks, ChunkVector{
+			Packet: s, ParseOnly: true, Seq: c.Seq, Offset: c.Offset, Text: c.Text,
+		})
+	}
+	for _, p := range packetSamples {
+		v.ContentPackets = append(v.ContentPackets, PacketVector{
+			Packet: p.String(), Binary: []byte(EncodingBinary.Packet(p)), PacketId: p.PacketId, ClientId: p.ClientId, Data: p.Data,
+		})
+	}
+	for _, s := range packetParseOnlySamples {
+		p := ParseContentPacket(s)
+		v.ContentPackets = append(v.ContentPackets, PacketVector{
+			Packet: s, ParseOnly: true, PacketId: p.PacketId, ClientId: p.ClientId, Data: p.Data,
+		})
+	}
+	for _, m := range controlSamples {
+		v.Controls = append(v.Controls, ControlVector{
+			Packet: EncodeControl(m), Binary: []byte(EncodingBinary.Control(m)), Action: m.Action(), Args: controlArgs(m),
+		})
+	}
+	for _, s := range controlParseOnlySamples {
+		m, err := ParseControl(s)
+		if err != nil {
+			panic(err)
+		}
+		v.Controls = append(v.Controls, ControlVector{Packet: s, ParseOnly: true, Action: m.Action(), Args: controlArgs(m)})
+	}
+	for _, s := range invalidControlSamples {
+		_, err := ParseControl(s)
+		if err == nil {
+			panic("invalid control sample parses: " + s)
+		}
+		_, _, schemaErr := checkControl(ParseControlChunk(s))
+		v.InvalidControls = append(v.InvalidControls, InvalidControlVector{Packet: s, Schema: schemaErr != nil, Error: err.Error()})
+	}
+	return v
+}
+
+// controlArgs gives the arguments of a message as a parser that only knows
+// the schemas would: with missing optional ones filled in.
+func controlArgs(m ControlMessage) []string {
+	_, args, _ := checkControl(ParseControlChunk(EncodeControl(m)))
+	if args == nil {
+		args = []string{}
+	}
+	return args
+}
+
+// WriteVectors writes the conformance test cases as indented JSON.
+func WriteVectors(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(ConformanceVectors())
+}
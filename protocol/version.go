@@ -0,0 +1,175 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the version of the wire protocol spoken by this server.
+//
+// Version 1 is the protocol spoken by clients released before the handshake
+// existed: they never announce themselves, and they are assumed to have none
+// of the optional features.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// Optional protocol features. A feature is only used with a participant
+// if both the participant and the server have announced it.
+const (
+	FeatureSequenced    = "sequenced"     // content chunks carry sequence numbers
+	FeatureResync       = "resync"        // understands resend-live and live-resynced
+	FeatureRateLimits   = "rate-limits"   // understands rate-warning and muted
+	FeatureEncryption   = "encryption"    // can encrypt and decrypt content
+	FeatureRichContent  = "rich-content"  // understands emphasis, corrections, typing pauses and reactions
+	FeatureBinary       = "binary"        // can read and write the binary encoding
+	FeatureCatchUp      = "catch-up"      // understands catch-up and request-catch-up
+	FeatureCoWhisperers = "co-whisperers" // understands role-changed and whisperer-live
+)
+
+// ServerFeatures lists the optional features this server supports.
+var ServerFeatures = []string{
+	FeatureSequenced, FeatureResync, FeatureRateLimits, FeatureEncryption, FeatureRichContent, FeatureBinary,
+	FeatureCatchUp, FeatureCoWhisperers,
+}
+
+// Capabilities are what a participant has announced it can do.
+type Capabilities struct {
+	Version  int
+	Features []string
+}
+
+// LegacyCapabilities are assumed for participants that never announce themselves.
+var LegacyCapabilities = Capabilities{Version: MinProtocolVersion}
+
+func (c Capabilities) Has(feature string) bool {
+	return slices.Contains(c.Features, feature)
+}
+
+// Negotiate returns the capabilities shared by the participant and the server:
+// the lower of the two versions and the features both support.
+func (c Capabilities) Negotiate() Capabilities {
+	result := Capabilities{Version: min(c.Version, ProtocolVersion), Features: []string{}}
+	for _, f := range ServerFeatures {
+		if c.Has(f) {
+			result.Features = append(result.Features, f)
+		}
+	}
+	return result
+}
+
+// Missing returns those of the required features that the participant lacks.
+func (c Capabilities) Missing(required ...string) []string {
+	var missing []string
+	for _, f := range required {
+		if !c.Has(f) {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
+
+func init() {
+	registerControl("hello", func(args []string) (ControlMessage, error) {
+		c, err := decodeCapabilities(args)
+		return Hello{Capabilities: c}, err
+	}, capabilityArgs...)
+	registerControl("welcome", func(args []string) (ControlMessage, error) {
+		c, err := decodeCapabilities(args)
+		return Welcome{Capabilities: c}, err
+	}, capabilityArgs...)
+	registerControl("incompatible", func(args []string) (ControlMessage, error) {
+		c, err := decodeCapabilities(args)
+		return Incompatible{MinVersion: c.Version, Missing: c.Features}, err
+	}, capabilityArgs...)
+}
+
+var capabilityArgs = []ArgSpec{
+	{Name: "version", Kind: ArgInt},
+	{Name: "features", Kind: ArgList, Optional: true},
+}
+
+func (c Capabilities) args() []string {
+	return []string{strconv.Itoa(c.Version), strings.Join(c.Features, ",")}
+}
+
+func decodeCapabilities(args []string) (Capabilities, error) {
+	version := int(parseInt(args[0]))
+	if version < 1 {
+		return Capabilities{}, fmt.Errorf("protocol version %d is not valid", version)
+	}
+	return Capabilities{Version: version, Features: parseList(args[1])}, nil
+}
+
+// Hello is how a client announces its protocol version and features.
+// Clients send it as their presence data when they attach to a session.
+type Hello struct {
+	Capabilities
+}
+
+func (Hello) Action() string   { return "hello" }
+func (m Hello) Args() []string { return m.Capabilities.args() }
+
+func HelloPacket(c Capabilities) string {
+	return EncodeControl(Hello{Capabilities: c})
+}
+
+// IsHelloPacket checks if the given packet has action "hello".
+// If it does, it also returns the announced capabilities.
+func IsHelloPacket(packet string) (bool, Capabilities) {
+	m, ok := parseAs[Hello](packet)
+	return ok, m.Capabilities
+}
+
+// Welcome answers a hello with the version and features that the
+// server will use with that client.
+type Welcome struct {
+	Capabilities
+}
+
+func (Welcome) Action() string   { return "welcome" }
+func (m Welcome) Args() []string { return m.Capabilities.args() }
+
+func WelcomePacket(c Capabilities) string {
+	return EncodeControl(Welcome{Capabilities: c})
+}
+
+// IsWelcomePacket checks if the given packet has action "welcome".
+// If it does, it also returns the negotiated capabilities.
+func IsWelcomePacket(packet string) (bool, Capabilities) {
+	m, ok := parseAs[Welcome](packet)
+	return ok, m.Capabilities
+}
+
+// Incompatible answers a hello from a client that can't take part
+// in the session, because its version is too old or it lacks the
+// given features. The client is removed from the session.
+type Incompatible struct {
+	MinVersion int
+	Missing    []string
+}
+
+func (Incompatible) Action() string { return "incompatible" }
+func (m Incompatible) Args() []string {
+	return Capabilities{Version: m.MinVersion, Features: m.Missing}.args()
+}
+
+func IncompatiblePacket(minVersion int, missing []string) string {
+	return EncodeControl(Incompatible{MinVersion: minVersion, Missing: missing})
+}
+
+// IsIncompatiblePacket checks if the given packet has action "incompatible".
+// If it does, it also returns the minimum version and the missing features.
+func IsIncompatiblePacket(packet string) (bool, int, []string) {
+	m, ok := parseAs[Incompatible](packet)
+	return ok, m.MinVersion, m.Missing
+}
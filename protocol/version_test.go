@@ -0,0 +1,71 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+func TestHelloPacket(t *testing.T) {
+	tests := []struct {
+		name     string
+		packet   string
+		ok       bool
+		expected Capabilities
+	}{
+		{"round trip", HelloPacket(Capabilities{Version: 2, Features: []string{"a", "b"}}), true, Capabilities{Version: 2, Features: []string{"a", "b"}}},
+		{"no features", "hello|3|", true, Capabilities{Version: 3, Features: []string{}}},
+		{"version only", "hello|1", true, Capabilities{Version: 1, Features: []string{}}},
+		{"bad version", "hello|two|a", false, Capabilities{}},
+		{"zero version", "hello|0|a", false, Capabilities{}},
+		{"no args", "hello|", false, Capabilities{}},
+		{"extra args", "hello|2|a|b", false, Capabilities{}},
+		{"other action", "welcome|2|a", false, Capabilities{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, c := IsHelloPacket(tt.packet)
+			if ok != tt.ok {
+				t.Fatalf("IsHelloPacket(%q) failed, got %v, want %v", tt.packet, ok, tt.ok)
+			}
+			if diff := deep.Equal(c, tt.expected); diff != nil {
+				t.Errorf("IsHelloPacket(%q) capabilities: %v", tt.packet, diff)
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	client := Capabilities{Version: ProtocolVersion + 5, Features: []string{"future", FeatureEncryption, FeatureSequenced}}
+	expected := Capabilities{Version: ProtocolVersion, Features: []string{FeatureSequenced, FeatureEncryption}}
+	negotiated := client.Negotiate()
+	if diff := deep.Equal(negotiated, expected); diff != nil {
+		t.Errorf("Negotiate() failed: %v", diff)
+	}
+	if ok, welcomed := IsWelcomePacket(WelcomePacket(negotiated)); !ok || deep.Equal(welcomed, expected) != nil {
+		t.Errorf("WelcomePacket() didn't round trip, got %+v", welcomed)
+	}
+	if legacy := LegacyCapabilities.Negotiate(); legacy.Version != MinProtocolVersion || len(legacy.Features) != 0 {
+		t.Errorf("legacy capabilities negotiated to %+v", legacy)
+	}
+	if missing := client.Missing(FeatureEncryption, FeatureResync); deep.Equal(missing, []string{FeatureResync}) != nil {
+		t.Errorf("Missing() failed, got %v", missing)
+	}
+}
+
+func TestIncompatiblePacket(t *testing.T) {
+	packet := IncompatiblePacket(2, []string{FeatureEncryption})
+	ok, minVersion, missing := IsIncompatiblePacket(packet)
+	if !ok || minVersion != 2 || deep.Equal(missing, []string{FeatureEncryption}) != nil {
+		t.Errorf("IsIncompatiblePacket(%q) failed, got %v, %d, %v", packet, ok, minVersion, missing)
+	}
+	if ok, _, _ := IsIncompatiblePacket("incompatible|"); ok {
+		t.Errorf("IsIncompatiblePacket() accepted a packet without a version")
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	RoleWhisperer = "whisperer"
+	RoleListener  = "listener"
+)
+
+func init() {
+	registerControl("role-changed", func(args []string) (ControlMessage, error) {
+		switch args[1] {
+		case RoleWhisperer, RoleListener:
+			return RoleChanged{ClientId: args[0], Role: args[1]}, nil
+		}
+		return nil, fmt.Errorf("unknown role %q", args[1])
+	}, ArgSpec{Name: "clientId", Kind: ArgId}, ArgSpec{Name: "role", Kind: ArgId})
+	registerControl("whisperer-live", func(args []string) (ControlMessage, error) {
+		return WhispererLive{ClientId: args[0], Text: args[1]}, nil
+	}, ArgSpec{Name: "clientId", Kind: ArgId}, ArgSpec{Name: "text", Kind: ArgString})
+	registerControl("whisperer-live-part", func(args []string) (ControlMessage, error) {
+		m := WhispererLivePart{ClientId: args[0], Id: args[1], Part: int(parseInt(args[2])), Parts: int(parseInt(args[3])), Text: args[4]}
+		if m.Part >= m.Parts {
+			return nil, fmt.Errorf("part %d of %d doesn't exist", m.Part, m.Parts)
+		}
+		return m, nil
+	},
+		ArgSpec{Name: "clientId", Kind: ArgId},
+		ArgSpec{Name: "id", Kind: ArgId},
+		ArgSpec{Name: "part", Kind: ArgInt},
+		ArgSpec{Name: "parts", Kind: ArgInt},
+		ArgSpec{Name: "text", Kind: ArgString},
+	)
+}
+
+// RoleChanged tells participants that the given client is now
+// a whisperer or a listener in the session.
+type RoleChanged struct {
+	ClientId string
+	Role     string
+}
+
+func (RoleChanged) Action() string   { return "role-changed" }
+func (m RoleChanged) Args() []string { return []string{m.ClientId, m.Role} }
+
+func RoleChangedPacket(clientId, role string) string {
+	return EncodeControl(RoleChanged{ClientId: clientId, Role: role})
+}
+
+// IsRoleChangedPacket checks if the given packet has action "role-changed".
+// If it does, it also returns the client ID and its new role.
+func IsRoleChangedPacket(packet string) (bool, string, string) {
+	m, ok := parseAs[RoleChanged](packet)
+	return ok, m.ClientId, m.Role
+}
+
+// WhispererLive gives a client the live text of one whisperer. Clients
+// that negotiate FeatureCoWhisperers get one of these for each whisperer
+// after a catch-up, because the catch-up text has no live text of its own.
+// Live text too long for one message is sent as WhispererLivePart messages.
+type WhispererLive struct {
+	ClientId string
+	Text     string
+}
+
+func (WhispererLive) Action() string   { return "whisperer-live" }
+func (m WhispererLive) Args() []string { return []string{m.ClientId, m.Text} }
+
+func WhispererLivePacket(clientId, text string) string {
+	return EncodeControl(WhispererLive{ClientId: clientId, Text: text})
+}
+
+// WhispererLivePart is one part of the live text of one whisperer, split
+// the same way as a catch-up, so the parts have to be put back together
+// before use.
+type WhispererLivePart struct {
+	ClientId string
+	Id       string // the same for all parts of one whisperer's live text
+	Part     int    // numbered from 0
+	Parts    int
+	Text     string
+}
+
+func (WhispererLivePart) Action() string { return "whisperer-live-part" }
+func (m WhispererLivePart) Args() []string {
+	return []string{m.ClientId, m.Id, fmt.Sprint(m.Part), fmt.Sprint(m.Parts), m.Text}
+}
+
+// WhispererLivePackets makes the packets that give a client the live text
+// of one whisperer, with no more than maxBytes of text in each packet.
+// Live text that fits in one packet gets a single WhispererLive packet.
+func WhispererLivePackets(id, clientId, text string, maxBytes int) []string {
+	parts := splitText(text, maxBytes)
+	if len(parts) == 1 {
+		return []string{WhispererLivePacket(clientId, text)}
+	}
+	packets := make([]string, len(parts))
+	for i, part := range parts {
+		packets[i] = EncodeControl(WhispererLivePart{ClientId: clientId, Id: id, Part: i, Parts: len(parts), Text: part})
+	}
+	return packets
+}
+
+// AssembleWhispererLive puts the parts of a whisperer's live text back
+// together, in whatever order they were received.
+func AssembleWhispererLive(parts []WhispererLivePart) (clientId, text string, err error) {
+	if len(parts) == 0 {
+		return "", "", fmt.Errorf("no whisperer live parts")
+	}
+	sorted := slices.Clone(parts)
+	slices.SortFunc(sorted, func(a, b WhispererLivePart) int { return a.Part - b.Part })
+	var b strings.Builder
+	for i, part := range sorted {
+		if part.ClientId != sorted[0].ClientId || part.Id != sorted[0].Id || part.Parts != len(sorted) || part.Part != i {
+			return "", "", fmt.Errorf("whisperer live part %d of %d (id %s) doesn't belong", part.Part, part.Parts, part.Id)
+		}
+		b.WriteString(part.Text)
+	}
+	return sorted[0].ClientId, b.String(), nil
+}
+
+// IsWhispererLivePacket checks if the given packet has action "whisperer-live".
+// If it does, it also returns the whisperer's client ID and live text.
+func IsWhispererLivePacket(packet string) (bool, string, string) {
+	m, ok := parseAs[WhispererLive](packet)
+	return ok, m.ClientId, m.Text
+}
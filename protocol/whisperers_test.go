@@ -0,0 +1,83 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoleChangedPacket(t *testing.T) {
+	packet := RoleChangedPacket("client1", RoleWhisperer)
+	if packet != "role-changed|client1|whisperer" {
+		t.Errorf("RoleChangedPacket() failed, got %q, want %q", packet, "role-changed|client1|whisperer")
+	}
+	if ok, clientId, role := IsRoleChangedPacket(packet); !ok || clientId != "client1" || role != RoleWhisperer {
+		t.Errorf("IsRoleChangedPacket(%q) failed, got %v, %q, %q", packet, ok, clientId, role)
+	}
+	if ok, _, _ := IsRoleChangedPacket("role-changed|client1|owner"); ok {
+		t.Errorf("IsRoleChangedPacket accepted an unknown role")
+	}
+}
+
+func TestWhispererLivePacket(t *testing.T) {
+	packet := WhispererLivePacket("client1", "a|b")
+	if ok, clientId, text := IsWhispererLivePacket(packet); !ok || clientId != "client1" || text != "a|b" {
+		t.Errorf("IsWhispererLivePacket(%q) failed, got %v, %q, %q", packet, ok, clientId, text)
+	}
+	if ok, clientId, text := IsWhispererLivePacket("whisperer-live|client1|"); !ok || clientId != "client1" || text != "" {
+		t.Errorf("IsWhispererLivePacket failed on empty live text, got %v, %q, %q", ok, clientId, text)
+	}
+}
+
+func TestWhispererLivePackets(t *testing.T) {
+	if packets := WhispererLivePackets("l", "client1", "short", 10); len(packets) != 1 || packets[0] != "whisperer-live|client1|short" {
+		t.Errorf("WhispererLivePackets() of short text failed, got %q", packets)
+	}
+	text := strings.Repeat("héllo|", 10)
+	packets := WhispererLivePackets("l", "client1", text, 16)
+	if len(packets) < 2 {
+		t.Fatalf("WhispererLivePackets() failed, got %d packets, want several", len(packets))
+	}
+	var parts []WhispererLivePart
+	for _, packet := range packets {
+		m, err := ParseControl(packet)
+		if err != nil {
+			t.Fatalf("ParseControl(%q) failed: %v", packet, err)
+		}
+		part := m.(WhispererLivePart)
+		if len(part.Text) > 16 {
+			t.Errorf("WhispererLivePackets() failed, got a part of %d bytes", len(part.Text))
+		}
+		parts = append([]WhispererLivePart{part}, parts...)
+	}
+	if clientId, got, err := AssembleWhispererLive(parts); err != nil || clientId != "client1" || got != text {
+		t.Errorf("AssembleWhispererLive() failed, got %q, %q (%v), want %q", clientId, got, err, text)
+	}
+	if _, err := ParseControl("whisperer-live-part|client1|l|2|2|text"); err == nil {
+		t.Errorf("ParseControl() accepted a part that doesn't exist")
+	}
+}
+
+func TestAssembleWhispererLiveErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parts []WhispererLivePart
+	}{
+		{"no parts", nil},
+		{"missing part", []WhispererLivePart{{ClientId: "w", Id: "l", Part: 0, Parts: 2}}},
+		{"mixed ids", []WhispererLivePart{{ClientId: "w", Id: "l", Part: 0, Parts: 2}, {ClientId: "w", Id: "m", Part: 1, Parts: 2}}},
+		{"mixed whisperers", []WhispererLivePart{{ClientId: "w", Id: "l", Part: 0, Parts: 2}, {ClientId: "v", Id: "l", Part: 1, Parts: 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := AssembleWhispererLive(tt.parts); err == nil {
+				t.Errorf("AssembleWhispererLive() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/whisper-project/server.golang/platform"
@@ -27,38 +30,107 @@ func sLog() *zap.Logger {
 type ClientStatus struct {
 	ClientId string
 	IsOnline bool
+	Control  string // the control packet the client announced with its presence, if any
 }
 
 type StatusReceiver chan ClientStatus
 
+// An AblyManager multiplexes all of this server's sessions over a single
+// realtime connection, which is opened when the first session starts.
 type AblyManager struct {
-	sessions map[string]*session
+	mutex           sync.Mutex
+	client          *ably.Realtime
+	rest            *ably.REST
+	webhookPresence bool
+	sMutex          sync.RWMutex // protects sessions
+	sessions        map[string]*session
+}
+
+// UseWebhookPresence controls whether sessions started after this call
+// learn about presence from Ably webhooks (see ApplyWebhookBatch) rather
+// than by subscribing to each session's presence channel.
+func (m *AblyManager) UseWebhookPresence(on bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.webhookPresence = on
 }
 
 func (m *AblyManager) StartSession(sessionId string, cr protocol.ContentReceiver, sr StatusReceiver) error {
-	if _, ok := m.sessions[sessionId]; ok {
+	if !m.reserveSession(sessionId) {
 		return fmt.Errorf("session %s already started", sessionId)
 	}
-	s := &session{id: sessionId, cr: cr, sr: sr}
-	if err := s.start(); err != nil {
+	s := &session{id: sessionId, cr: cr, sr: sr, participants: make(map[string]*participant), done: make(chan struct{})}
+	err := m.startSession(s)
+	m.addSession(s, err == nil)
+	return err
+}
+
+func (m *AblyManager) startSession(s *session) error {
+	client, err := m.realtime()
+	if err != nil {
 		return err
 	}
-	m.sessions[sessionId] = s
-	return nil
+	if s.rest, err = m.webhookRest(); err != nil {
+		return err
+	}
+	return s.start(client)
 }
 
 func (m *AblyManager) EndSession(sessionId string) error {
-	s, ok := m.sessions[sessionId]
+	s, ok := m.dropSession(sessionId)
 	if !ok {
 		return fmt.Errorf("no session %s", sessionId)
 	}
 	s.end()
-	delete(m.sessions, sessionId)
 	return nil
 }
 
+// session returns a started session. Sessions that are still
+// starting have a nil entry, and aren't returned.
+func (m *AblyManager) session(sessionId string) (*session, bool) {
+	m.sMutex.RLock()
+	defer m.sMutex.RUnlock()
+	s := m.sessions[sessionId]
+	return s, s != nil
+}
+
+// reserveSession marks a session as starting, so it can't be started twice.
+// It fails if the session is already started or starting.
+func (m *AblyManager) reserveSession(sessionId string) bool {
+	m.sMutex.Lock()
+	defer m.sMutex.Unlock()
+	if _, ok := m.sessions[sessionId]; ok {
+		return false
+	}
+	m.sessions[sessionId] = nil
+	return true
+}
+
+// addSession replaces the reservation for a session with the
+// session, if it started, or removes the reservation if it didn't.
+func (m *AblyManager) addSession(s *session, started bool) {
+	m.sMutex.Lock()
+	defer m.sMutex.Unlock()
+	if started {
+		m.sessions[s.id] = s
+	} else {
+		delete(m.sessions, s.id)
+	}
+}
+
+func (m *AblyManager) dropSession(sessionId string) (*session, bool) {
+	m.sMutex.Lock()
+	defer m.sMutex.Unlock()
+	s := m.sessions[sessionId]
+	if s == nil {
+		return nil, false
+	}
+	delete(m.sessions, sessionId)
+	return s, true
+}
+
 func (m *AblyManager) AddWhisperer(sessionId, clientId string) (bool, error) {
-	s, ok := m.sessions[sessionId]
+	s, ok := m.session(sessionId)
 	if !ok {
 		return false, fmt.Errorf("no session %s", sessionId)
 	}
@@ -66,15 +138,25 @@ func (m *AblyManager) AddWhisperer(sessionId, clientId string) (bool, error) {
 }
 
 func (m *AblyManager) AddListener(sessionId, clientId string) (bool, error) {
-	s, ok := m.sessions[sessionId]
+	s, ok := m.session(sessionId)
 	if !ok {
 		return false, fmt.Errorf("no session %s", sessionId)
 	}
 	return s.addListener(clientId)
 }
 
+// AddWaitLister adds a client that's waiting to be admitted. It can hear
+// control packets, but not content.
+func (m *AblyManager) AddWaitLister(sessionId, clientId string) (bool, error) {
+	s, ok := m.session(sessionId)
+	if !ok {
+		return false, fmt.Errorf("no session %s", sessionId)
+	}
+	return s.addWaitLister(clientId)
+}
+
 func (m *AblyManager) ClientToken(sessionId, clientId string) ([]byte, error) {
-	s, ok := m.sessions[sessionId]
+	s, ok := m.session(sessionId)
 	if !ok {
 		return nil, fmt.Errorf("no session %s", sessionId)
 	}
@@ -82,15 +164,70 @@ func (m *AblyManager) ClientToken(sessionId, clientId string) ([]byte, error) {
 }
 
 func (m *AblyManager) RemoveClient(sessionId, clientId string) error {
-	s, ok := m.sessions[sessionId]
+	s, ok := m.session(sessionId)
 	if !ok {
 		return fmt.Errorf("no session %s", sessionId)
 	}
 	return s.removeClient(clientId)
 }
 
+// RevokeClient removes the client from the session, and revokes the
+// pubsub tokens issued to it, so it loses access now rather than when
+// its token expires. Revocation needs an Ably key with revocable tokens
+// enabled; without one, access lasts until the client's token expires,
+// since it won't be issued a new one.
+func (m *AblyManager) RevokeClient(sessionId, clientId string) error {
+	s, ok := m.session(sessionId)
+	if !ok {
+		return fmt.Errorf("no session %s", sessionId)
+	}
+	if err := s.removeClient(clientId); err != nil {
+		return err
+	}
+	return m.revokeTokens(clientId)
+}
+
+// revokeTokens revokes all the tokens issued to a client.
+func (m *AblyManager) revokeTokens(clientId string) error {
+	rest, err := m.restClient()
+	if err != nil {
+		return err
+	}
+	keyName, _, _ := strings.Cut(platform.GetConfig().AblyPublishKey, ":")
+	body := map[string][]string{"targets": {"clientId:" + clientId}}
+	res, err := rest.Request(http.MethodPost, "/keys/"+keyName+"/revokeTokens", ably.RequestWithBody(body)).
+		Pages(context.Background())
+	if err != nil {
+		sLog().Error("ably token revocation failure", zap.String("clientId", clientId), zap.Error(err))
+		return err
+	}
+	if !res.Success() {
+		err = fmt.Errorf("token revocation failed with status %d: %s", res.StatusCode(), res.ErrorMessage())
+		sLog().Error("ably token revocation refused", zap.String("clientId", clientId), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SetWhisperer gives or takes away a participant's ability to publish content.
+// Taking it away revokes the participant's tokens, so the client has to
+// authenticate again and gets a token that can only subscribe.
+func (m *AblyManager) SetWhisperer(sessionId, clientId string, canWhisper bool) error {
+	s, ok := m.session(sessionId)
+	if !ok {
+		return fmt.Errorf("no session %s", sessionId)
+	}
+	if err := s.setWhisperer(clientId, canWhisper); err != nil {
+		return err
+	}
+	if canWhisper {
+		return nil
+	}
+	return m.revokeTokens(clientId)
+}
+
 func (m *AblyManager) Send(sessionId, clientId, packet string) error {
-	s, ok := m.sessions[sessionId]
+	s, ok := m.session(sessionId)
 	if !ok {
 		return fmt.Errorf("no session %s", sessionId)
 	}
@@ -98,13 +235,100 @@ func (m *AblyManager) Send(sessionId, clientId, packet string) error {
 }
 
 func (m *AblyManager) Broadcast(sessionId, packet string) error {
-	s, ok := m.sessions[sessionId]
+	s, ok := m.session(sessionId)
 	if !ok {
 		return fmt.Errorf("no session %s", sessionId)
 	}
 	return s.broadcast(packet)
 }
 
+// Close shuts down the shared realtime connection. It should only be
+// called once all sessions have ended; if another session is started
+// after that, a new connection will be opened for it.
+func (m *AblyManager) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.client == nil {
+		return
+	}
+	sLog().Info("closing ably realtime connection")
+	m.client.Close()
+	m.client = nil
+}
+
+// realtime returns the shared realtime client, creating it if necessary.
+func (m *AblyManager) realtime() (*ably.Realtime, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.client != nil {
+		return m.client, nil
+	}
+	sLog().Info("opening ably realtime connection", zap.String("clientId", storage.ServerId))
+	client, err := ably.NewRealtime(
+		ably.WithClientID(storage.ServerId),
+		ably.WithKey(platform.GetConfig().AblyPublishKey),
+		ably.WithEchoMessages(false),
+		ably.WithAutoConnect(true),
+	)
+	if err != nil {
+		sLog().Error("ably client create failure", zap.Error(err))
+		return nil, err
+	}
+	client.Connection.OnAll(connectionMonitor)
+	m.client = client
+	return client, nil
+}
+
+// webhookRest returns the REST client used for presence by sessions
+// that rely on webhooks, or nil if sessions subscribe to presence.
+func (m *AblyManager) webhookRest() (*ably.REST, error) {
+	m.mutex.Lock()
+	on := m.webhookPresence
+	m.mutex.Unlock()
+	if !on {
+		return nil, nil
+	}
+	return m.restClient()
+}
+
+// restClient returns the shared REST client, creating it if necessary.
+func (m *AblyManager) restClient() (*ably.REST, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.rest != nil {
+		return m.rest, nil
+	}
+	rest, err := ably.NewREST(ably.WithKey(platform.GetConfig().AblyPublishKey))
+	if err != nil {
+		sLog().Error("ably rest client create failure", zap.Error(err))
+		return nil, err
+	}
+	m.rest = rest
+	return rest, nil
+}
+
+func connectionMonitor(change ably.ConnectionStateChange) {
+	fields := []zap.Field{
+		zap.String("event", change.Event.String()),
+		zap.String("previous", change.Previous.String()),
+		zap.String("current", change.Current.String()),
+	}
+	if change.RetryIn > 0 {
+		fields = append(fields, zap.Duration("retryIn", change.RetryIn))
+	}
+	if change.Reason != nil {
+		fields = append(fields, zap.Error(change.Reason))
+	}
+	switch change.Current {
+	case ably.ConnectionStateFailed:
+		sLog().Error("ably connection failed", fields...)
+	case ably.ConnectionStateDisconnected, ably.ConnectionStateSuspended:
+		sLog().Warn("ably connection interrupted", fields...)
+	default:
+		sLog().Info("ably connection state change", fields...)
+	}
+}
+
 func NewAblyManager() *AblyManager {
 	return &AblyManager{
 		sessions: make(map[string]*session),
@@ -116,6 +340,7 @@ type session struct {
 	cr              protocol.ContentReceiver
 	sr              StatusReceiver
 	client          *ably.Realtime
+	rest            *ably.REST // if set, presence comes from webhooks, not a subscription
 	controlId       string
 	presenceId      string
 	contentId       string
@@ -123,6 +348,23 @@ type session struct {
 	presenceChannel *ably.RealtimeChannel
 	contentChannel  *ably.RealtimeChannel
 	participants    map[string]*participant
+	pMutex          sync.Mutex     // protects participants and statuses
+	statuses        []ClientStatus // status changes waiting to be sent, in the order they were made
+	sMutex          sync.Mutex     // held while sending statuses, so they are sent in order
+	done            chan struct{}  // closed when the session ends
+	offs            []func()
+	stopReconciler  context.CancelFunc
+	reconcileNow    chan struct{}
+	// content recovery state, protected by the mutex
+	mutex      sync.Mutex
+	seen       *recentIds
+	attachedAt int64 // when the content channel first attached
+	lastSeen   int64 // Ably timestamp of the last content message delivered
+	recovering bool
+	held       []*ably.Message // live messages that arrived during recovery
+	ending     bool
+	packets    []protocol.ContentPacket // content waiting to be sent, in the order it was delivered
+	cMutex     sync.Mutex               // held while sending content, so it is sent in order
 }
 
 type participant struct {
@@ -132,105 +374,140 @@ type participant struct {
 	attached   bool
 }
 
-func (s *session) start() error {
-	sLog().Info("opening ably client", zap.String("sessionId", s.id))
-	hubId := fmt.Sprintf("%s:%s", storage.ServerId, s.id)
+func (s *session) start(client *ably.Realtime) (err error) {
+	sLog().Info("starting ably session", zap.String("sessionId", s.id))
 	s.controlId = fmt.Sprintf("%s:%s", s.id, "control")
 	s.presenceId = fmt.Sprintf("%s:%s", s.id, "presence")
 	s.contentId = fmt.Sprintf("%s:%s", s.id, "content")
-	client, err := ably.NewRealtime(
-		ably.WithClientID(hubId),
-		ably.WithKey(platform.GetConfig().AblyPublishKey),
-		ably.WithEchoMessages(false),
-		ably.WithAutoConnect(true),
-	)
-	if err != nil {
-		sLog().Error("ably client create failure", zap.String("sessionId", s.id), zap.Error(err))
-		return err
-	}
+	s.seen = newRecentIds(recentIdLimit)
+	s.reconcileNow = make(chan struct{}, 1)
+	s.client = client
+	s.controlChannel = client.Channels.Get(s.controlId)
+	s.presenceChannel = client.Channels.Get(s.presenceId)
+	s.contentChannel = client.Channels.Get(s.contentId)
 	defer func() {
 		if err != nil {
-			client.Close()
+			s.release()
 		}
 	}()
-	controlChannel := client.Channels.Get(s.controlId)
-	presenceChannel := client.Channels.Get(s.presenceId)
-	contentChannel := client.Channels.Get(s.contentId)
-	_, err = presenceChannel.Presence.SubscribeAll(context.Background(), s.presenceReceiver())
-	if err != nil {
-		sLog().Error("ably presence subscribe failure", zap.String("sessionId", s.id), zap.Error(err))
-		return err
+	s.offs = append(s.offs,
+		s.controlChannel.OnAll(s.channelMonitor("control", s.controlChannel)),
+		s.presenceChannel.OnAll(s.channelMonitor("presence", s.presenceChannel)),
+		s.contentChannel.OnAll(s.channelMonitor("content", s.contentChannel)),
+	)
+	if s.rest == nil {
+		_, err = s.presenceChannel.Presence.SubscribeAll(context.Background(), s.presenceReceiver())
+		if err != nil {
+			sLog().Error("ably presence subscribe failure", zap.String("sessionId", s.id), zap.Error(err))
+			return err
+		}
 	}
-	contentChannel.Once(ably.ChannelEventAttached, func(_ ably.ChannelStateChange) {
+	s.contentChannel.Once(ably.ChannelEventAttached, func(_ ably.ChannelStateChange) {
 		sLog().Info("ably content channel attached", zap.String("sessionId", s.id))
+		s.mutex.Lock()
+		s.attachedAt = time.Now().UnixMilli()
 		// signal the content receiver that we are attached
-		s.cr <- protocol.ContentPacket{}
+		s.packets = append(s.packets, protocol.ContentPacket{})
+		s.mutex.Unlock()
+		s.sendContent()
 	})
-	_, err = contentChannel.SubscribeAll(context.Background(), s.contentReceiver())
+	_, err = s.contentChannel.SubscribeAll(context.Background(), s.contentReceiver())
 	if err != nil {
 		sLog().Error("ably content subscribe failure", zap.String("sessionId", s.id), zap.Error(err))
 		return err
 	}
-	s.client = client
-	s.controlChannel = controlChannel
-	s.presenceChannel = presenceChannel
-	s.contentChannel = contentChannel
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopReconciler = cancel
+	go s.reconcilePresence(ctx)
 	return nil
 }
 
 func (s *session) end() {
 	sLog().Info("ending session", zap.String("sessionId", s.id))
-	ctx := context.Background()
-	if err := s.contentChannel.Detach(ctx); err != nil {
-		sLog().Error("ably failure detaching content channel",
-			zap.String("sessionId", s.id), zap.Error(err))
+	s.mutex.Lock()
+	s.ending = true
+	s.mutex.Unlock()
+	close(s.done)
+	s.stopReconciler()
+	s.release()
+}
+
+// release gives back all the channels used by the session, leaving
+// the shared connection open for other sessions.
+func (s *session) release() {
+	for _, off := range s.offs {
+		off()
 	}
-	if err := s.presenceChannel.Detach(ctx); err != nil {
-		sLog().Error("ably failure detaching presence channel",
-			zap.String("sessionId", s.id), zap.Error(err))
+	s.offs = nil
+	ctx := context.Background()
+	for _, name := range []string{s.contentId, s.presenceId, s.controlId} {
+		if err := s.client.Channels.Release(ctx, name); err != nil {
+			sLog().Error("ably failure releasing channel",
+				zap.String("sessionId", s.id), zap.String("channel", name), zap.Error(err))
+		}
 	}
-	go func() {
-		time.Sleep(1 * time.Second)
-		s.client.Close()
-		sLog().Info("closed ably client", zap.String("sessionId", s.id))
-	}()
 }
 
 func (s *session) addWhisperer(clientId string) (bool, error) {
-	if p, ok := s.participants[clientId]; ok {
-		p.canWhisper = true
-		p.canListen = true
-		return p.attached, nil
-	}
-	attached := s.updatePresence(clientId)
-	l := &participant{clientId: clientId, canWhisper: true, canListen: true, attached: attached}
-	s.participants[clientId] = l
-	return attached, nil
+	return s.addParticipant(clientId, true, true), nil
 }
 
 func (s *session) addListener(clientId string) (bool, error) {
-	if p, ok := s.participants[clientId]; ok {
-		p.canListen = true
-		return p.attached, nil
-	}
-	attached := s.updatePresence(clientId)
-	l := &participant{clientId: clientId, canWhisper: false, canListen: true, attached: attached}
-	s.participants[clientId] = l
-	return attached, nil
+	return s.addParticipant(clientId, false, true), nil
 }
 
 func (s *session) addWaitLister(clientId string) (bool, error) {
+	return s.addParticipant(clientId, false, false), nil
+}
+
+// addParticipant adds the client with the given capabilities, or extends the
+// capabilities of an existing participant. It returns whether the client is attached.
+func (s *session) addParticipant(clientId string, canWhisper, canListen bool) bool {
+	s.pMutex.Lock()
 	if p, ok := s.participants[clientId]; ok {
-		return p.attached, nil
+		p.extend(canWhisper, canListen)
+		s.pMutex.Unlock()
+		return p.attached
 	}
+	s.pMutex.Unlock()
 	attached := s.updatePresence(clientId)
-	l := &participant{clientId: clientId, canWhisper: false, canListen: false, attached: attached}
+	s.pMutex.Lock()
+	defer s.pMutex.Unlock()
+	if p, ok := s.participants[clientId]; ok {
+		// the client was added while we were checking its presence
+		p.extend(canWhisper, canListen)
+		return p.attached
+	}
+	l := &participant{clientId: clientId, canWhisper: canWhisper, canListen: canListen, attached: attached}
 	s.participants[clientId] = l
-	return attached, nil
+	return attached
+}
+
+func (s *session) setWhisperer(clientId string, canWhisper bool) error {
+	s.pMutex.Lock()
+	defer s.pMutex.Unlock()
+	p, ok := s.participants[clientId]
+	if !ok {
+		return fmt.Errorf("unknown client: %s", clientId)
+	}
+	p.canWhisper = canWhisper
+	p.canListen = true
+	return nil
+}
+
+func (p *participant) extend(canWhisper, canListen bool) {
+	p.canWhisper = p.canWhisper || canWhisper
+	p.canListen = p.canListen || canListen
 }
 
 func (s *session) clientToken(clientId string) ([]byte, error) {
+	s.pMutex.Lock()
 	p, ok := s.participants[clientId]
+	var canWhisper, canListen bool
+	if ok {
+		canWhisper, canListen = p.canWhisper, p.canListen
+	}
+	s.pMutex.Unlock()
 	if !ok {
 		return nil, nil
 	}
@@ -238,17 +515,17 @@ func (s *session) clientToken(clientId string) ([]byte, error) {
 		s.presenceId: {"presence"},
 		s.controlId:  {"subscribe"},
 	}
-	if p.canWhisper {
+	if canWhisper {
 		capabilities[s.contentId] = []string{"publish", "subscribe"}
-	}
-	if p.canListen {
+	} else if canListen {
 		capabilities[s.contentId] = []string{"subscribe"}
 	}
 	payload, err := json.Marshal(capabilities)
 	if err != nil {
 		return nil, err
 	}
-	params := ably.TokenParams{ClientID: clientId, Capability: string(payload)}
+	// tokens are short-lived, so clients that are removed lose access soon even without revocation
+	params := ably.TokenParams{ClientID: clientId, Capability: string(payload), TTL: clientTokenTTL.Milliseconds()}
 	request, err := s.client.Auth.CreateTokenRequest(&params)
 	if err != nil {
 		return nil, err
@@ -261,6 +538,8 @@ func (s *session) clientToken(clientId string) ([]byte, error) {
 }
 
 func (s *session) removeClient(clientId string) error {
+	s.pMutex.Lock()
+	defer s.pMutex.Unlock()
 	_, ok := s.participants[clientId]
 	if !ok {
 		return fmt.Errorf("unknown client: %s", clientId)
@@ -270,11 +549,13 @@ func (s *session) removeClient(clientId string) error {
 }
 
 func (s *session) send(clientId, packet string) error {
+	s.pMutex.Lock()
 	p, ok := s.participants[clientId]
+	s.pMutex.Unlock()
 	if !ok {
 		return fmt.Errorf("unknown client: %s", clientId)
 	}
-	err := s.controlChannel.Publish(context.Background(), p.clientId, packet)
+	err := s.controlChannel.Publish(context.Background(), p.clientId, wireData(packet))
 	if err != nil {
 		sLog().Error("ably failure publishing to control channel",
 			zap.String("sessionId", s.id), zap.String("clientId", p.clientId), zap.Error(err))
@@ -283,7 +564,7 @@ func (s *session) send(clientId, packet string) error {
 }
 
 func (s *session) broadcast(packet string) error {
-	err := s.controlChannel.Publish(context.Background(), "all", packet)
+	err := s.controlChannel.Publish(context.Background(), "all", wireData(packet))
 	if err != nil {
 		sLog().Error("ably failure publishing to control channel",
 			zap.String("sessionId", s.id), zap.Error(err))
@@ -292,67 +573,327 @@ func (s *session) broadcast(packet string) error {
 }
 
 func (s *session) updatePresence(clientId string) bool {
-	msgs, err := s.presenceChannel.Presence.Get(context.Background())
+	present, err := s.presentClients(context.Background())
 	if err != nil {
 		return false
 	}
-	for _, m := range msgs {
-		if m.ClientID == clientId {
-			return true
+	return present[clientId]
+}
+
+// presentClients returns the IDs of the clients present on the presence channel.
+// If the session isn't subscribed to presence, the channel's presence is fetched
+// over REST, so the presence channel doesn't get attached.
+func (s *session) presentClients(ctx context.Context) (map[string]bool, error) {
+	present := make(map[string]bool)
+	if s.rest == nil {
+		msgs, err := s.presenceChannel.Presence.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			present[m.ClientID] = true
 		}
+		return present, nil
 	}
-	return false
+	items, err := s.rest.Channels.Get(s.presenceId).Presence.Get().Items(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for items.Next(ctx) {
+		present[items.Item().ClientID] = true
+	}
+	if err := items.Err(); err != nil {
+		return nil, err
+	}
+	return present, nil
 }
 
 func (s *session) contentReceiver() func(*ably.Message) {
 	return func(msg *ably.Message) {
-		packet := protocol.ContentPacket{
-			PacketId: msg.ID,
-			ClientId: msg.ClientID,
-			Data:     msg.String(),
+		s.mutex.Lock()
+		if s.recovering {
+			// hold live messages until the recovered ones have been delivered
+			s.held = append(s.held, msg)
+			s.mutex.Unlock()
+			return
 		}
-		sLog().Debug("received content packet",
-			zap.String("sessionId", s.id),
-			zap.Any("packet", packet),
-		)
-		s.cr <- packet
+		s.deliver(msg)
+		s.mutex.Unlock()
+		s.sendContent()
 	}
 }
 
-func (s *session) presenceReceiver() func(*ably.PresenceMessage) {
-	return func(msg *ably.PresenceMessage) {
-		p, ok := s.participants[msg.ClientID]
-		if !ok {
+// deliver queues a content message for the content receiver, unless it
+// has already been delivered. The caller must hold the session mutex,
+// and call sendContent once it has released it.
+func (s *session) deliver(msg *ably.Message) {
+	if !s.seen.add(msg.ID) {
+		sLog().Debug("skipping duplicate content packet",
+			zap.String("sessionId", s.id), zap.String("packetId", msg.ID))
+		return
+	}
+	if msg.Timestamp > s.lastSeen {
+		s.lastSeen = msg.Timestamp
+	}
+	packet := protocol.ContentPacket{
+		PacketId: msg.ID,
+		ClientId: msg.ClientID,
+		Data:     messageData(msg),
+	}
+	sLog().Debug("received content packet",
+		zap.String("sessionId", s.id),
+		zap.Any("packet", packet),
+	)
+	s.packets = append(s.packets, packet)
+}
+
+// sendContent sends the queued content to the content receiver, in order.
+// The caller must not hold the session mutex, so that a slow receiver
+// doesn't hold up everything else that needs it. Content is dropped once
+// the session has ended, since nothing is receiving it.
+func (s *session) sendContent() {
+	s.cMutex.Lock()
+	defer s.cMutex.Unlock()
+	for {
+		s.mutex.Lock()
+		if len(s.packets) == 0 {
+			s.mutex.Unlock()
 			return
 		}
-		sLog().Debug("received presence message",
+		packet := s.packets[0]
+		s.packets = s.packets[1:]
+		s.mutex.Unlock()
+		select {
+		case s.cr <- packet:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// channelMonitor logs the state changes of a session channel, re-attaches
+// it if it fails, and recovers missed content if continuity is lost.
+func (s *session) channelMonitor(name string, channel *ably.RealtimeChannel) func(ably.ChannelStateChange) {
+	return func(change ably.ChannelStateChange) {
+		fields := []zap.Field{
 			zap.String("sessionId", s.id),
-			zap.String("clientId", msg.ClientID),
-			zap.String("action", msg.Action.String()),
-		)
-		attached := p.attached
-		switch msg.Action {
-		case ably.PresenceActionEnter, ably.PresenceActionPresent:
-			attached = true
-		case ably.PresenceActionLeave, ably.PresenceActionAbsent:
-			attached = false
-		case ably.PresenceActionUpdate:
-			// we shouldn't get these, because clients are not sending updates
-			sLog().Warn("received an unexpected presence message",
-				zap.String("sessionId", s.id),
-				zap.String("clientId", p.clientId),
-				zap.String("action", msg.Action.String()),
-			)
+			zap.String("channel", name),
+			zap.String("event", change.Event.String()),
+			zap.String("previous", change.Previous.String()),
+			zap.String("current", change.Current.String()),
+			zap.Bool("resumed", change.Resumed),
+		}
+		if change.Reason != nil {
+			fields = append(fields, zap.Error(change.Reason))
+		}
+		s.mutex.Lock()
+		ending, attachedAt := s.ending, s.attachedAt
+		s.mutex.Unlock()
+		switch change.Current {
+		case ably.ChannelStateFailed, ably.ChannelStateDetached:
+			if ending {
+				sLog().Info("ably channel state change", fields...)
+				return
+			}
+			sLog().Warn("ably channel lost, re-attaching", fields...)
+			go s.reattach(name, channel)
+		case ably.ChannelStateSuspended:
+			// the library retries suspended channels by itself
+			sLog().Warn("ably channel suspended", fields...)
+		case ably.ChannelStateAttached:
+			sLog().Info("ably channel state change", fields...)
+			if name == "content" && !change.Resumed && attachedAt != 0 && !ending {
+				go s.recoverContent()
+			}
+			if name == "presence" && !change.Resumed && !ending {
+				// presence events may have been missed while detached
+				s.requestReconcile()
+			}
 		default:
-			sLog().Warn("received an unknown presence action",
-				zap.String("sessionId", s.id),
-				zap.String("clientId", p.clientId),
-				zap.String("action", msg.Action.String()),
-			)
+			sLog().Info("ably channel state change", fields...)
+		}
+	}
+}
+
+func (s *session) reattach(name string, channel *ably.RealtimeChannel) {
+	ctx, cancel := context.WithTimeout(context.Background(), reattachTimeout)
+	defer cancel()
+	if err := channel.Attach(ctx); err != nil {
+		sLog().Error("ably failure re-attaching channel",
+			zap.String("sessionId", s.id), zap.String("channel", name), zap.Error(err))
+	}
+}
+
+// recoverContent fetches from channel history any content messages
+// published since the last one delivered, and delivers them in order
+// before any live messages that arrived in the meantime.
+func (s *session) recoverContent() {
+	s.mutex.Lock()
+	if s.recovering || s.ending {
+		s.mutex.Unlock()
+		return
+	}
+	s.recovering = true
+	since := s.lastSeen
+	if since == 0 {
+		since = s.attachedAt
+	}
+	s.mutex.Unlock()
+	recovered := 0
+	defer func() {
+		s.mutex.Lock()
+		for _, msg := range s.held {
+			s.deliver(msg)
 		}
-		if attached != p.attached {
-			p.attached = attached
-			s.sr <- ClientStatus{ClientId: p.clientId, IsOnline: attached}
+		s.held = nil
+		s.recovering = false
+		s.mutex.Unlock()
+		s.sendContent()
+		sLog().Info("ably content recovery completed",
+			zap.String("sessionId", s.id), zap.Int("recovered", recovered))
+	}()
+	sLog().Info("ably content recovery started",
+		zap.String("sessionId", s.id), zap.Int64("since", since))
+	ctx, cancel := context.WithTimeout(context.Background(), recoveryTimeout)
+	defer cancel()
+	history := s.contentChannel.History(
+		ably.HistoryWithStart(time.UnixMilli(since)),
+		ably.HistoryWithDirection(ably.Forwards),
+	)
+	items, err := history.Items(ctx)
+	if err != nil {
+		sLog().Error("ably content history failure", zap.String("sessionId", s.id), zap.Error(err))
+		return
+	}
+	for items.Next(ctx) {
+		s.mutex.Lock()
+		if s.seen.contains(items.Item().ID) {
+			s.mutex.Unlock()
+			continue
 		}
+		s.deliver(items.Item())
+		s.mutex.Unlock()
+		s.sendContent()
+		recovered++
+	}
+	if err := items.Err(); err != nil {
+		sLog().Error("ably content history failure", zap.String("sessionId", s.id), zap.Error(err))
+	}
+}
+
+// wireData is what gets published for a packet: binary packets
+// are published as bytes, because they aren't valid text.
+func wireData(packet string) any {
+	if protocol.IsBinary(packet) {
+		return []byte(packet)
+	}
+	return packet
+}
+
+func messageData(msg *ably.Message) string {
+	switch data := msg.Data.(type) {
+	case string:
+		return data
+	case []byte:
+		return string(data)
+	default:
+		return fmt.Sprint(data)
+	}
+}
+
+const (
+	recentIdLimit   = 1000
+	reattachTimeout = 30 * time.Second
+	clientTokenTTL  = 10 * time.Minute
+	recoveryTimeout = 30 * time.Second
+)
+
+// recentIds remembers the IDs of the most recently delivered messages,
+// so that messages recovered from history aren't delivered twice.
+type recentIds struct {
+	limit int
+	ids   map[string]bool
+	order []string
+}
+
+func newRecentIds(limit int) *recentIds {
+	return &recentIds{limit: limit, ids: make(map[string]bool, limit)}
+}
+
+func (r *recentIds) contains(id string) bool {
+	return r.ids[id]
+}
+
+// add remembers the id, and returns whether it was new.
+func (r *recentIds) add(id string) bool {
+	if r.ids[id] {
+		return false
+	}
+	if len(r.order) >= r.limit {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.ids[id] = true
+	r.order = append(r.order, id)
+	return true
+}
+
+func (s *session) presenceReceiver() func(*ably.PresenceMessage) {
+	return func(msg *ably.PresenceMessage) {
+		s.applyPresence(msg.ClientID, msg.Action, msg.Data)
+	}
+}
+
+// presenceControl returns the presence data of a client if it is one of
+// the control packets clients announce with their presence: a protocol
+// handshake or a catch-up request.
+func presenceControl(data any) string {
+	if packet, ok := data.(string); ok {
+		if isHello, _ := protocol.IsHelloPacket(packet); isHello || protocol.IsRequestCatchUpPacket(packet) {
+			return packet
+		}
+	}
+	return ""
+}
+
+// applyPresence updates a participant's attached status from a presence
+// action, whether received on the channel or via webhook, and notifies
+// the status receiver if it changed or if the client announced itself.
+func (s *session) applyPresence(clientId string, action ably.PresenceAction, data any) {
+	s.pMutex.Lock()
+	s.applyPresenceLocked(clientId, action, data)
+	s.pMutex.Unlock()
+	s.sendStatuses()
+}
+
+// applyPresenceLocked updates a participant's attached status, and queues
+// its status if need be. The caller must hold pMutex.
+func (s *session) applyPresenceLocked(clientId string, action ably.PresenceAction, data any) {
+	p, ok := s.participants[clientId]
+	if !ok {
+		return
+	}
+	sLog().Debug("received presence message",
+		zap.String("sessionId", s.id),
+		zap.String("clientId", clientId),
+		zap.String("action", action.String()),
+	)
+	attached, control := p.attached, ""
+	switch action {
+	case ably.PresenceActionEnter, ably.PresenceActionPresent, ably.PresenceActionUpdate:
+		// clients update their presence to announce themselves again
+		attached, control = true, presenceControl(data)
+	case ably.PresenceActionLeave, ably.PresenceActionAbsent:
+		attached = false
+	default:
+		sLog().Warn("received an unknown presence action",
+			zap.String("sessionId", s.id),
+			zap.String("clientId", p.clientId),
+			zap.String("action", action.String()),
+		)
+	}
+	if attached != p.attached || control != "" {
+		p.attached = attached
+		s.queueStatus(ClientStatus{ClientId: p.clientId, IsOnline: attached, Control: control})
 	}
 }
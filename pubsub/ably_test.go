@@ -0,0 +1,172 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package pubsub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ably/ably-go/ably"
+	"github.com/go-test/deep"
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/platform"
+	"github.com/whisper-project/server.golang/protocol"
+	"github.com/whisper-project/server.golang/storage"
+)
+
+func TestMain(m *testing.M) {
+	storage.ServerLogger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+func TestRecentIds(t *testing.T) {
+	r := newRecentIds(3)
+	for i := 0; i < 3; i++ {
+		if !r.add(fmt.Sprintf("id%d", i)) {
+			t.Errorf("add of new id%d reported a duplicate", i)
+		}
+	}
+	if r.add("id1") {
+		t.Errorf("add of id1 twice was not reported as a duplicate")
+	}
+	if !r.add("id3") {
+		t.Errorf("add of new id3 reported a duplicate")
+	}
+	if r.contains("id0") {
+		t.Errorf("oldest id0 was not forgotten when the limit was reached")
+	}
+	for _, id := range []string{"id1", "id2", "id3"} {
+		if !r.contains(id) {
+			t.Errorf("recent %s was forgotten", id)
+		}
+	}
+}
+
+func TestClientTokenCapabilities(t *testing.T) {
+	client, err := ably.NewRealtime(
+		ably.WithKey(platform.GetConfig().AblyPublishKey), ably.WithAutoConnect(false))
+	if err != nil {
+		t.Fatalf("NewRealtime() failed: %v", err)
+	}
+	s := &session{id: "test", client: client, participants: make(map[string]*participant),
+		presenceId: "test:presence", controlId: "test:control", contentId: "test:content"}
+	s.participants["w"] = &participant{clientId: "w", canWhisper: true, canListen: true}
+	s.participants["l"] = &participant{clientId: "l", canListen: true}
+	s.participants["wait"] = &participant{clientId: "wait"}
+	tests := []struct {
+		clientId string
+		content  []string
+	}{
+		{"w", []string{"publish", "subscribe"}},
+		{"l", []string{"subscribe"}},
+		{"wait", nil},
+	}
+	for _, tt := range tests {
+		payload, err := s.clientToken(tt.clientId)
+		if err != nil {
+			t.Fatalf("clientToken(%q) failed: %v", tt.clientId, err)
+		}
+		var request ably.TokenRequest
+		if err = json.Unmarshal(payload, &request); err != nil {
+			t.Fatalf("clientToken(%q) returned invalid request: %v", tt.clientId, err)
+		}
+		var capabilities map[string][]string
+		if err = json.Unmarshal([]byte(request.Capability), &capabilities); err != nil {
+			t.Fatalf("clientToken(%q) returned invalid capability: %v", tt.clientId, err)
+		}
+		if diff := deep.Equal(capabilities["test:content"], tt.content); diff != nil {
+			t.Errorf("clientToken(%q) failed, got content capability %v, want %v",
+				tt.clientId, capabilities["test:content"], tt.content)
+		}
+		if request.TTL != clientTokenTTL.Milliseconds() {
+			t.Errorf("clientToken(%q) failed, got ttl %d, want %d", tt.clientId, request.TTL, clientTokenTTL.Milliseconds())
+		}
+	}
+	if payload, err := s.clientToken("unknown"); payload != nil || err != nil {
+		t.Errorf("clientToken() of unknown client failed, got %s, %v, want nil", payload, err)
+	}
+}
+
+func TestSetWhisperer(t *testing.T) {
+	s := &session{id: "test", participants: make(map[string]*participant)}
+	s.participants["w"] = &participant{clientId: "w", canWhisper: true, canListen: true}
+	s.participants["l"] = &participant{clientId: "l", canListen: true}
+	if err := s.setWhisperer("l", true); err != nil || !s.participants["l"].canWhisper {
+		t.Errorf("setWhisperer(l, true) failed, got %v, %v", s.participants["l"].canWhisper, err)
+	}
+	if err := s.setWhisperer("w", false); err != nil || s.participants["w"].canWhisper || !s.participants["w"].canListen {
+		t.Errorf("setWhisperer(w, false) failed, got %+v, %v", *s.participants["w"], err)
+	}
+	if err := s.setWhisperer("unknown", true); err == nil {
+		t.Errorf("setWhisperer() of unknown client succeeded")
+	}
+}
+
+func TestStatusesSentInOrderWithoutLock(t *testing.T) {
+	s := &session{id: "test", sr: make(StatusReceiver), done: make(chan struct{}),
+		participants: make(map[string]*participant)}
+	s.pMutex.Lock()
+	s.queueStatus(ClientStatus{ClientId: "a", IsOnline: true})
+	s.queueStatus(ClientStatus{ClientId: "a", IsOnline: false})
+	s.pMutex.Unlock()
+	sent := make(chan struct{})
+	go func() {
+		s.sendStatuses()
+		close(sent)
+	}()
+	// the receiver can use the session while a status is waiting for it
+	time.Sleep(10 * time.Millisecond)
+	if err := s.send("unknown", "packet"); err == nil {
+		t.Errorf("send() to unknown client succeeded")
+	}
+	for i, online := range []bool{true, false} {
+		if status := <-s.sr; status.IsOnline != online {
+			t.Errorf("status %d was %+v, want online %v", i, status, online)
+		}
+	}
+	<-sent
+	// once the session has ended, queued statuses are dropped
+	s.pMutex.Lock()
+	s.queueStatus(ClientStatus{ClientId: "a", IsOnline: true})
+	s.pMutex.Unlock()
+	close(s.done)
+	s.sendStatuses()
+}
+
+func TestContentSentWithoutLock(t *testing.T) {
+	s := &session{id: "test", cr: make(protocol.ContentReceiver), done: make(chan struct{}),
+		seen: newRecentIds(recentIdLimit)}
+	receive := s.contentReceiver()
+	delivered := make(chan struct{})
+	go func() {
+		receive(&ably.Message{ID: "m1", ClientID: "w", Data: "0|one"})
+		receive(&ably.Message{ID: "m1", ClientID: "w", Data: "0|one"})
+		receive(&ably.Message{ID: "m2", ClientID: "w", Data: "0|two"})
+		close(delivered)
+	}()
+	// while content waits for the receiver, the session can still be used
+	time.Sleep(10 * time.Millisecond)
+	s.mutex.Lock()
+	ending := s.ending
+	s.mutex.Unlock()
+	if ending {
+		t.Errorf("session is ending")
+	}
+	for _, data := range []string{"0|one", "0|two"} {
+		if packet := <-s.cr; packet.Data != data {
+			t.Errorf("content packet was %+v, want data %q", packet, data)
+		}
+	}
+	<-delivered
+	// once the session has ended, content is dropped
+	close(s.done)
+	receive(&ably.Message{ID: "m3", ClientID: "w", Data: "0|three"})
+}
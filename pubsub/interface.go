@@ -13,8 +13,11 @@ type Manager = interface {
 	EndSession(sessionId string) error
 	AddWhisperer(sessionId, clientId string) (bool, error)
 	AddListener(sessionId, clientId string) (bool, error)
+	AddWaitLister(sessionId, clientId string) (bool, error)
 	ClientToken(sessionId, clientId string) ([]byte, error)
 	RemoveClient(sessionId, clientId string) error
+	RevokeClient(sessionId, clientId string) error
+	SetWhisperer(sessionId, clientId string, canWhisper bool) error
 	Send(sessionId, clientId, packet string) error
 	Broadcast(sessionId, packet string) error
 }
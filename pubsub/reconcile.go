@@ -0,0 +1,134 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package pubsub
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	reconcileInterval = 30 * time.Second
+	reconcileTimeout  = 10 * time.Second
+)
+
+// PresenceMetrics summarizes presence reconciliation across all sessions.
+type PresenceMetrics struct {
+	Reconciliations int64 // completed reconciliation passes
+	Corrections     int64 // participant statuses that had drifted and were corrected
+	Failures        int64 // passes that couldn't fetch channel presence
+}
+
+var presenceMetrics struct {
+	reconciliations atomic.Int64
+	corrections     atomic.Int64
+	failures        atomic.Int64
+}
+
+// CurrentPresenceMetrics returns the reconciliation counts since server start.
+func CurrentPresenceMetrics() PresenceMetrics {
+	return PresenceMetrics{
+		Reconciliations: presenceMetrics.reconciliations.Load(),
+		Corrections:     presenceMetrics.corrections.Load(),
+		Failures:        presenceMetrics.failures.Load(),
+	}
+}
+
+// reconcilePresence periodically compares channel presence against
+// the participants' attached status, and corrects any drift caused by
+// missed presence events. It runs until the context is cancelled.
+func (s *session) reconcilePresence(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.reconcileNow:
+		}
+		s.reconcile(ctx)
+	}
+}
+
+// requestReconcile asks for a reconciliation pass as soon as possible.
+func (s *session) requestReconcile() {
+	select {
+	case s.reconcileNow <- struct{}{}:
+	default:
+		// one is already pending
+	}
+}
+
+func (s *session) reconcile(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, reconcileTimeout)
+	defer cancel()
+	present, err := s.presentClients(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			presenceMetrics.failures.Add(1)
+			sLog().Error("ably presence fetch failure during reconciliation",
+				zap.String("sessionId", s.id), zap.Error(err))
+		}
+		return
+	}
+	drift := 0
+	s.pMutex.Lock()
+	for _, p := range s.participants {
+		if online := present[p.clientId]; online != p.attached {
+			sLog().Info("correcting participant presence",
+				zap.String("sessionId", s.id), zap.String("clientId", p.clientId),
+				zap.Bool("isOnline", online))
+			p.attached = online
+			drift++
+			// queue while locked, so the correction can't overtake a presence event
+			s.queueStatus(ClientStatus{ClientId: p.clientId, IsOnline: online})
+		}
+	}
+	s.pMutex.Unlock()
+	s.sendStatuses()
+	presenceMetrics.reconciliations.Add(1)
+	if drift > 0 {
+		presenceMetrics.corrections.Add(int64(drift))
+		sLog().Warn("presence drift corrected",
+			zap.String("sessionId", s.id), zap.Int("drift", drift))
+	}
+}
+
+// queueStatus queues a status change for the status receiver. The caller
+// must hold pMutex, so that statuses are queued in the order the changes
+// to the participants were made.
+func (s *session) queueStatus(status ClientStatus) {
+	s.statuses = append(s.statuses, status)
+}
+
+// sendStatuses sends the queued status changes to the status receiver, in
+// order. The caller must not hold pMutex, because the session may need it
+// before it can take another status. Statuses are dropped once the session
+// has ended, since nothing is receiving them.
+func (s *session) sendStatuses() {
+	s.sMutex.Lock()
+	defer s.sMutex.Unlock()
+	for {
+		s.pMutex.Lock()
+		if len(s.statuses) == 0 {
+			s.pMutex.Unlock()
+			return
+		}
+		status := s.statuses[0]
+		s.statuses = s.statuses[1:]
+		s.pMutex.Unlock()
+		select {
+		case s.sr <- status:
+		case <-s.done:
+			return
+		}
+	}
+}
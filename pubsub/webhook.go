@@ -0,0 +1,156 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package pubsub
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ably/ably-go/ably"
+	"go.uber.org/zap"
+)
+
+// A WebhookBatch is an enveloped batch of events delivered by an Ably webhook.
+type WebhookBatch struct {
+	Items []WebhookItem `json:"items"`
+}
+
+type WebhookItem struct {
+	WebhookId string          `json:"webhookId"`
+	Source    string          `json:"source"`
+	Serial    string          `json:"serial"`
+	Timestamp int64           `json:"timestamp"`
+	Name      string          `json:"name"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type webhookPresenceData struct {
+	ChannelId string `json:"channelId"`
+	Presence  []struct {
+		ClientId string              `json:"clientId"`
+		Action   ably.PresenceAction `json:"action"`
+		Data     any                 `json:"data"`
+	} `json:"presence"`
+}
+
+type webhookLifecycleData struct {
+	ChannelId string `json:"channelId"`
+	Name      string `json:"name"`
+}
+
+// VerifyWebhookSignature checks that a webhook body was signed by Ably
+// with the given API key. The keyName and signature are the values of
+// the X-Ably-Key and X-Ably-Signature headers on the webhook request.
+func VerifyWebhookSignature(apiKey string, body []byte, keyName, signature string) error {
+	name, secret, found := strings.Cut(apiKey, ":")
+	if !found {
+		return fmt.Errorf("webhook API key has no secret")
+	}
+	if keyName != name {
+		return fmt.Errorf("webhook signed with unknown key %q", keyName)
+	}
+	expected, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("webhook signature is not base64: %v", err)
+	}
+	if !hmac.Equal(expected, SignWebhookBody(secret, body)) {
+		return fmt.Errorf("webhook signature mismatch")
+	}
+	return nil
+}
+
+// SignWebhookBody computes the signature Ably puts on a webhook body,
+// given the secret part of the signing API key.
+func SignWebhookBody(secret string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+func ParseWebhookBatch(body []byte) (*WebhookBatch, error) {
+	var batch WebhookBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("webhook body is not an enveloped batch: %v", err)
+	}
+	return &batch, nil
+}
+
+// ApplyWebhookBatch feeds presence and channel lifecycle events from a
+// webhook into the sessions they belong to, so they reach each session's
+// status receiver exactly as if they had arrived on a presence subscription.
+// Events for channels that aren't session presence channels on this server
+// are ignored. It returns the number of events applied.
+func (m *AblyManager) ApplyWebhookBatch(batch *WebhookBatch) int {
+	applied := 0
+	for _, item := range batch.Items {
+		switch item.Source {
+		case "channel.presence":
+			var data webhookPresenceData
+			if err := json.Unmarshal(item.Data, &data); err != nil {
+				sLog().Warn("unreadable webhook presence data",
+					zap.String("webhookId", item.WebhookId), zap.Error(err))
+				continue
+			}
+			s := m.presenceSession(data.ChannelId)
+			if s == nil {
+				continue
+			}
+			for _, p := range data.Presence {
+				s.applyPresence(p.ClientId, p.Action, p.Data)
+				applied++
+			}
+		case "channel.lifecycle":
+			var data webhookLifecycleData
+			if err := json.Unmarshal(item.Data, &data); err != nil {
+				sLog().Warn("unreadable webhook lifecycle data",
+					zap.String("webhookId", item.WebhookId), zap.Error(err))
+				continue
+			}
+			s := m.presenceSession(data.ChannelId)
+			if s == nil {
+				continue
+			}
+			sLog().Info("received webhook channel lifecycle event",
+				zap.String("sessionId", s.id), zap.String("name", item.Name))
+			if item.Name == "channel.closed" {
+				// once the presence channel closes, nobody is present
+				s.detachAll()
+			}
+			applied++
+		default:
+			sLog().Debug("ignoring webhook event",
+				zap.String("webhookId", item.WebhookId), zap.String("source", item.Source))
+		}
+	}
+	return applied
+}
+
+func (m *AblyManager) presenceSession(channelId string) *session {
+	sessionId, found := strings.CutSuffix(channelId, ":presence")
+	if !found {
+		return nil
+	}
+	s, _ := m.session(sessionId)
+	return s
+}
+
+// detachAll marks every participant as no longer attached.
+func (s *session) detachAll() {
+	s.pMutex.Lock()
+	for _, p := range s.participants {
+		if p.attached {
+			p.attached = false
+			s.queueStatus(ClientStatus{ClientId: p.clientId, IsOnline: false})
+		}
+	}
+	s.pMutex.Unlock()
+	s.sendStatuses()
+}
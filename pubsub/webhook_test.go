@@ -0,0 +1,162 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package pubsub
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-test/deep"
+)
+
+const testWebhookKey = "testapp.keyname:testsecret"
+
+// replayWebhook reads a recorded webhook payload, signs and verifies it
+// as Ably would, and applies it to the manager.
+func replayWebhook(t *testing.T, m *AblyManager, path string) int {
+	t.Helper()
+	body, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("can't read recorded webhook %s: %v", path, err)
+	}
+	signature := base64.StdEncoding.EncodeToString(SignWebhookBody("testsecret", body))
+	if err := VerifyWebhookSignature(testWebhookKey, body, "testapp.keyname", signature); err != nil {
+		t.Fatalf("recorded webhook %s failed verification: %v", path, err)
+	}
+	batch, err := ParseWebhookBatch(body)
+	if err != nil {
+		t.Fatalf("recorded webhook %s failed to parse: %v", path, err)
+	}
+	return m.ApplyWebhookBatch(batch)
+}
+
+func drainStatuses(sr StatusReceiver) []ClientStatus {
+	var statuses []ClientStatus
+	for {
+		select {
+		case status := <-sr:
+			statuses = append(statuses, status)
+		default:
+			return statuses
+		}
+	}
+}
+
+func TestReplayRecordedWebhooks(t *testing.T) {
+	m := NewAblyManager()
+	sr := make(StatusReceiver, 10)
+	m.sessions["conv-1"] = &session{
+		id: "conv-1",
+		sr: sr,
+		participants: map[string]*participant{
+			"whisperer-1": {clientId: "whisperer-1", canWhisper: true, canListen: true},
+			"listener-1":  {clientId: "listener-1", canListen: true},
+		},
+	}
+	paths, err := filepath.Glob(filepath.Join("testdata", "webhooks", "*.json"))
+	if err != nil || len(paths) != 3 {
+		t.Fatalf("expected 3 recorded webhooks, found %v (%v)", paths, err)
+	}
+	expected := [][]ClientStatus{
+		{{ClientId: "whisperer-1", IsOnline: true}, {ClientId: "listener-1", IsOnline: true, Control: "hello|2|sequenced,resync"}},
+		{{ClientId: "listener-1", IsOnline: false}},
+		{{ClientId: "whisperer-1", IsOnline: false}},
+	}
+	for i, path := range paths {
+		replayWebhook(t, m, path)
+		if diff := deep.Equal(drainStatuses(sr), expected[i]); diff != nil {
+			t.Errorf("statuses after %s: %v", filepath.Base(path), diff)
+		}
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"items":[]}`)
+	good := base64.StdEncoding.EncodeToString(SignWebhookBody("testsecret", body))
+	bad := base64.StdEncoding.EncodeToString(SignWebhookBody("othersecret", body))
+	if err := VerifyWebhookSignature(testWebhookKey, body, "testapp.keyname", good); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := VerifyWebhookSignature(testWebhookKey, body, "testapp.keyname", bad); err == nil {
+		t.Errorf("invalid signature accepted")
+	}
+	if err := VerifyWebhookSignature(testWebhookKey, body, "testapp.other", good); err == nil {
+		t.Errorf("signature from unknown key accepted")
+	}
+	if err := VerifyWebhookSignature(testWebhookKey, body, "testapp.keyname", "not base64!"); err == nil {
+		t.Errorf("malformed signature accepted")
+	}
+}
+
+// TestSessionRegistryStress is meant to be run with -race.
+func TestSessionRegistryStress(t *testing.T) {
+	m := NewAblyManager()
+	sr := make(StatusReceiver, 10000)
+	batch := func(action int) *WebhookBatch {
+		body := fmt.Sprintf(`{"items":[{"source":"channel.presence","data":{"channelId":"conv-1:presence",`+
+			`"presence":[{"clientId":"listener-1","action":%d}]}}]}`, action)
+		b, err := ParseWebhookBatch([]byte(body))
+		if err != nil {
+			t.Fatalf("ParseWebhookBatch() failed: %v", err)
+		}
+		return b
+	}
+	enter, leave := batch(2), batch(3)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				switch (i + j) % 4 {
+				case 0:
+					if m.reserveSession("conv-1") {
+						s := &session{id: "conv-1", sr: sr, participants: map[string]*participant{
+							"listener-1": {clientId: "listener-1", canListen: true},
+						}}
+						m.addSession(s, true)
+					}
+				case 1:
+					m.dropSession("conv-1")
+				case 2:
+					m.ApplyWebhookBatch(enter)
+					_ = m.RemoveClient("conv-1", "listener-1")
+				case 3:
+					m.ApplyWebhookBatch(leave)
+					_, _ = m.ClientToken("conv-1", "nobody")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDetachAllWithoutLock(t *testing.T) {
+	s := &session{id: "conv-1", sr: make(StatusReceiver), done: make(chan struct{}),
+		participants: map[string]*participant{
+			"whisperer-1": {clientId: "whisperer-1", canWhisper: true, canListen: true, attached: true},
+			"listener-1":  {clientId: "listener-1", canListen: true, attached: true},
+		}}
+	detached := make(chan struct{})
+	go func() {
+		s.detachAll()
+		close(detached)
+	}()
+	// the first status waits for the receiver, who can still use the session
+	status := <-s.sr
+	if err := s.removeClient(status.ClientId); err != nil || status.IsOnline {
+		t.Errorf("removeClient() while detaching failed, got %+v, %v", status, err)
+	}
+	if status := <-s.sr; status.IsOnline {
+		t.Errorf("second status was %+v, want offline", status)
+	}
+	<-detached
+}
@@ -6,8 +6,9 @@
 
 import { generateSpeech, getModels, getVoices } from './model/speech'
 import assert from 'node:assert'
-import { writeFileSync } from 'node:fs'
+import { readFileSync, writeFileSync } from 'node:fs'
 import { getHistoryItemAudio, getHistoryItems } from './model/history'
+import { checkVectors } from './protocol.gen'
 
 async function testVoices() {
     const voices = await getVoices()
@@ -52,9 +53,18 @@ async function testGeneration() {
     }
 }
 
+async function testProtocol() {
+    const vectors = JSON.parse(readFileSync('../protocol/testdata/vectors.json', 'utf8'))
+    const failures = checkVectors(vectors)
+    assert(failures.length == 0, `Protocol conformance failures:\n${failures.join('\n')}`)
+}
+
 async function testAll(...tests: string[]) {
     if (tests.length == 0) {
-        tests = ['voice', 'model', 'history', 'generation']
+        tests = ['protocol', 'voice', 'model', 'history', 'generation']
+    }
+    if (tests.includes('protocol')) {
+        await testProtocol()
     }
     if (tests.includes('voice')) {
         await testVoices()
@@ -7,6 +7,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 
 	"go.uber.org/zap"
@@ -17,9 +18,11 @@ import (
 )
 
 type Conversation struct {
-	Id    string `redis:"id"`
-	Owner string `redis:"owner"`
-	Name  string `redis:"name"`
+	Id          string `redis:"id"`
+	Owner       string `redis:"owner"`
+	Name        string `redis:"name"`
+	Encrypted   bool   `redis:"encrypted"`   // sessions have end-to-end encrypted content
+	Transcribed bool   `redis:"transcribed"` // sessions are transcribed from the start
 }
 
 func (c *Conversation) StoragePrefix() string {
@@ -69,7 +72,7 @@ func NewConversation(owner, name string) *Conversation {
 }
 
 func IsOwnedConversation(profileId, conversationId string) (bool, error) {
-	var conversation Conversation
+	conversation := Conversation{Id: conversationId}
 	if conversationId == "" {
 		sLog().Info("Empty conversation id")
 		return false, nil
@@ -87,6 +90,30 @@ func IsOwnedConversation(profileId, conversationId string) (bool, error) {
 	return true, nil
 }
 
+// GetConversation loads the conversation with the given ID,
+// returning nil if there is no such conversation.
+func GetConversation(conversationId string) (*Conversation, error) {
+	conversation := &Conversation{Id: conversationId}
+	if err := platform.LoadFields(sCtx(), conversation); err != nil {
+		if errors.Is(err, platform.StructPointerNotFoundError) {
+			return nil, nil
+		}
+		sLog().Error("Load Fields failure on conversation retrieval",
+			zap.String("conversationId", conversationId), zap.Error(err))
+		return nil, err
+	}
+	return conversation, nil
+}
+
+func SaveConversation(conversation *Conversation) error {
+	if err := platform.SaveFields(sCtx(), conversation); err != nil {
+		sLog().Error("Save Fields failure on conversation update",
+			zap.String("conversationId", conversation.Id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
 type AllowedListeners string
 
 func (a AllowedListeners) StoragePrefix() string {
@@ -118,3 +145,60 @@ func IsAllowedListener(profileId, conversationId string) (bool, error) {
 	}
 	return ok, err
 }
+
+type BannedProfiles string
+
+func (b BannedProfiles) StoragePrefix() string {
+	return "banned-profiles:"
+}
+
+func (b BannedProfiles) StorageId() string {
+	return string(b)
+}
+
+// BanProfile keeps a profile from listening to a conversation, including
+// if it was an allowed listener.
+func BanProfile(profileId, conversationId string) error {
+	if err := platform.AddMembers(sCtx(), BannedProfiles(conversationId), profileId); err != nil {
+		sLog().Error("storage failure adding banned profile",
+			zap.String("conversationId", conversationId), zap.String("profileId", profileId),
+			zap.Error(err))
+		return err
+	}
+	if err := platform.RemoveMembers(sCtx(), AllowedListeners(conversationId), profileId); err != nil {
+		sLog().Error("storage failure removing allowed listener",
+			zap.String("conversationId", conversationId), zap.String("profileId", profileId),
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func UnbanProfile(profileId, conversationId string) error {
+	if err := platform.RemoveMembers(sCtx(), BannedProfiles(conversationId), profileId); err != nil {
+		sLog().Error("storage failure removing banned profile",
+			zap.String("conversationId", conversationId), zap.String("profileId", profileId),
+			zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func IsBannedProfile(profileId, conversationId string) (bool, error) {
+	ok, err := platform.IsMember(sCtx(), BannedProfiles(conversationId), profileId)
+	if err != nil {
+		sLog().Error("storage failure retrieving banned profile",
+			zap.String("conversationId", conversationId), zap.String("profileId", profileId),
+			zap.Error(err))
+	}
+	return ok, err
+}
+
+func GetBannedProfiles(conversationId string) ([]string, error) {
+	profiles, err := platform.FetchMembers(sCtx(), BannedProfiles(conversationId))
+	if err != nil {
+		sLog().Error("storage failure retrieving banned profiles",
+			zap.String("conversationId", conversationId), zap.Error(err))
+	}
+	return profiles, err
+}
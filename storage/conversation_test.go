@@ -40,3 +40,32 @@ func TestAllowedListenersInterface(t *testing.T) {
 	a := AllowedListeners(id)
 	platform.StorableInterfaceTester(t, a, "allowed-listeners:", id)
 }
+
+func TestBannedProfilesInterface(t *testing.T) {
+	id := uuid.NewString()
+	b := BannedProfiles(id)
+	platform.StorableInterfaceTester(t, b, "banned-profiles:", id)
+}
+
+func TestBanUnbanProfile(t *testing.T) {
+	id := uuid.NewString()
+	defer platform.DeleteStorage(sCtx(), BannedProfiles(id))
+	if err := MakeAllowedListener("p1", id); err != nil {
+		t.Fatalf("MakeAllowedListener() failed: %v", err)
+	}
+	if err := BanProfile("p1", id); err != nil {
+		t.Fatalf("BanProfile() failed: %v", err)
+	}
+	if banned, err := IsBannedProfile("p1", id); err != nil || !banned {
+		t.Errorf("IsBannedProfile() failed, got %v, %v, want true", banned, err)
+	}
+	if allowed, err := IsAllowedListener("p1", id); err != nil || allowed {
+		t.Errorf("IsAllowedListener() of banned profile failed, got %v, %v, want false", allowed, err)
+	}
+	if err := UnbanProfile("p1", id); err != nil {
+		t.Fatalf("UnbanProfile() failed: %v", err)
+	}
+	if profiles, err := GetBannedProfiles(id); err != nil || len(profiles) != 0 {
+		t.Errorf("GetBannedProfiles() failed, got %v, %v, want none", profiles, err)
+	}
+}
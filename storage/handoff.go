@@ -0,0 +1,69 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"time"
+
+	"github.com/whisper-project/server.golang/platform"
+)
+
+// Suspended sessions are handed off to the next server instance through
+// a queue. A server claims a session for long enough to resume it, and
+// acknowledges the claim once it has. Claims that aren't acknowledged in
+// time are requeued, and sessions that can't be resumed are dead lettered.
+
+var SessionHandoffQueue = platform.StorableQueue("session-handoff")
+
+// LegacySuspendedSessions is the list that server instances of earlier
+// versions suspend sessions to. While they may still be running, as in a
+// rolling deploy, their sessions are moved into the handoff queue.
+var LegacySuspendedSessions = platform.StorableList("suspended-session-list")
+
+type HandoffClaim = platform.QueueClaim
+
+type Handoffs = platform.QueueContents
+
+// SuspendSession queues a suspended session for handoff.
+func SuspendSession(id string) error {
+	return platform.Enqueue(sCtx(), SessionHandoffQueue, id)
+}
+
+// MigrateLegacyHandoffs moves sessions suspended by earlier versions into
+// the handoff queue, oldest first, and returns how many it moved.
+func MigrateLegacyHandoffs() (int64, error) {
+	return platform.EnqueueList(sCtx(), LegacySuspendedSessions, false, SessionHandoffQueue)
+}
+
+// ClaimHandoff claims the next suspended session for this server instance,
+// and returns whether there was one.
+func ClaimHandoff(ttl time.Duration) (HandoffClaim, bool, error) {
+	return platform.ClaimFromQueue(sCtx(), SessionHandoffQueue, ServerId, time.Now().Add(ttl))
+}
+
+// AckHandoff records that a claimed session was resumed, and returns
+// whether the claim was still held.
+func AckHandoff(claim HandoffClaim) (bool, error) {
+	return platform.AckQueueClaim(sCtx(), SessionHandoffQueue, claim)
+}
+
+// FailHandoff gives up a claimed session so it can be tried again, and returns
+// whether it has instead been dead lettered after too many attempts.
+func FailHandoff(claim HandoffClaim, maxAttempts int64) (bool, error) {
+	return platform.FailQueueClaim(sCtx(), SessionHandoffQueue, claim, maxAttempts)
+}
+
+// RequeueExpiredHandoffs gives up claims that weren't acknowledged in time,
+// and returns how many were requeued and dead lettered.
+func RequeueExpiredHandoffs(maxAttempts int64) (int64, int64, error) {
+	return platform.RequeueExpiredClaims(sCtx(), SessionHandoffQueue, time.Now(), maxAttempts)
+}
+
+// PendingHandoffs returns the queued, claimed, and dead lettered handoffs.
+func PendingHandoffs() (*Handoffs, error) {
+	return platform.FetchQueueContents(sCtx(), SessionHandoffQueue)
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/whisper-project/server.golang/platform"
+)
+
+func TestSessionHandoff(t *testing.T) {
+	saved := SessionHandoffQueue
+	SessionHandoffQueue = platform.StorableQueue("test-handoff-" + uuid.NewString())
+	defer func() {
+		_ = platform.DeleteQueue(sCtx(), SessionHandoffQueue)
+		SessionHandoffQueue = saved
+	}()
+	if err := SuspendSession("s1"); err != nil {
+		t.Fatalf("SuspendSession() failed: %v", err)
+	}
+	claim, ok, err := ClaimHandoff(time.Minute)
+	if err != nil || !ok || claim.Element != "s1" || claim.Owner != ServerId {
+		t.Fatalf("ClaimHandoff() failed, got %v, %v, %v, want s1 claimed here", claim, ok, err)
+	}
+	if dead, err := FailHandoff(claim, 1); err != nil || !dead {
+		t.Errorf("FailHandoff() failed, got %v, %v, want dead lettered", dead, err)
+	}
+	// a new suspension starts over
+	if err := SuspendSession("s1"); err != nil {
+		t.Fatalf("SuspendSession() failed: %v", err)
+	}
+	if claim, _, _ = ClaimHandoff(time.Minute); claim.Attempts != 1 {
+		t.Errorf("ClaimHandoff() after resuspend failed, got %d attempts, want 1", claim.Attempts)
+	}
+	handoffs, err := PendingHandoffs()
+	if err != nil || len(handoffs.Claimed) != 1 || len(handoffs.Dead) != 1 {
+		t.Errorf("PendingHandoffs() failed, got %v, %v, want one claimed and one dead", handoffs, err)
+	}
+	if ok, err = AckHandoff(claim); err != nil || !ok {
+		t.Errorf("AckHandoff() failed, got %v, %v, want true", ok, err)
+	}
+}
+
+func TestMigrateLegacyHandoffs(t *testing.T) {
+	savedQueue, savedList := SessionHandoffQueue, LegacySuspendedSessions
+	SessionHandoffQueue = platform.StorableQueue("test-handoff-" + uuid.NewString())
+	LegacySuspendedSessions = platform.StorableList("test-suspended-" + uuid.NewString())
+	defer func() {
+		_ = platform.DeleteQueue(sCtx(), SessionHandoffQueue)
+		_ = platform.DeleteStorage(sCtx(), LegacySuspendedSessions)
+		SessionHandoffQueue, LegacySuspendedSessions = savedQueue, savedList
+	}()
+	// earlier versions pushed suspended sessions on the left, and resumed them from the right
+	if err := platform.PushRange(sCtx(), LegacySuspendedSessions, true, "s1", "s2"); err != nil {
+		t.Fatalf("legacy suspend failed: %v", err)
+	}
+	if moved, err := MigrateLegacyHandoffs(); err != nil || moved != 2 {
+		t.Fatalf("MigrateLegacyHandoffs() failed, got %d, %v, want 2", moved, err)
+	}
+	for _, want := range []string{"s1", "s2"} {
+		if claim, ok, err := ClaimHandoff(time.Minute); err != nil || !ok || claim.Element != want {
+			t.Errorf("ClaimHandoff() failed, got %v, %v, %v, want %s", claim, ok, err, want)
+		}
+	}
+}
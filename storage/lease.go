@@ -0,0 +1,76 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"time"
+
+	"github.com/whisper-project/server.golang/platform"
+)
+
+// A SessionLease records which server instance owns a session.
+// Only the owner runs the session; other instances send its requests there.
+type SessionLease struct {
+	SessionId string
+	Owner     string // the owner's ServerId
+	OwnerUrl  string // the owner's ServerUrl
+	Token     int64  // the fencing token, which increases with each new owner
+}
+
+func (l SessionLease) holder() platform.LeaseHolder {
+	return platform.LeaseHolder{Owner: l.Owner, Data: l.OwnerUrl, Token: l.Token}
+}
+
+// IsOwnedHere returns whether this server instance holds the lease.
+func (l SessionLease) IsOwnedHere() bool {
+	return l.Owner == ServerId
+}
+
+type sessionLease string
+
+func (s sessionLease) StoragePrefix() string {
+	return "session-lease:"
+}
+
+func (s sessionLease) StorageId() string {
+	return string(s)
+}
+
+func newSessionLease(id string, holder platform.LeaseHolder) SessionLease {
+	return SessionLease{SessionId: id, Owner: holder.Owner, OwnerUrl: holder.Data, Token: holder.Token}
+}
+
+// AcquireSessionLease makes this server instance the owner of the session,
+// unless another instance already owns it. It returns the current lease
+// and whether this instance holds it.
+func AcquireSessionLease(id string, ttl time.Duration) (SessionLease, bool, error) {
+	holder, ok, err := platform.AcquireLease(sCtx(), sessionLease(id), ServerId, ServerUrl, ttl)
+	if err != nil {
+		return SessionLease{}, false, err
+	}
+	return newSessionLease(id, holder), ok, nil
+}
+
+// RenewSessionLease extends the lease, and returns whether it's still held.
+func RenewSessionLease(l SessionLease, ttl time.Duration) (bool, error) {
+	return platform.RenewLease(sCtx(), sessionLease(l.SessionId), l.holder(), ttl)
+}
+
+// ReleaseSessionLease gives up the lease, if it's still held.
+func ReleaseSessionLease(l SessionLease) error {
+	return platform.ReleaseLease(sCtx(), sessionLease(l.SessionId), l.holder())
+}
+
+// GetSessionLease returns the current lease on the session, if there is one.
+func GetSessionLease(id string) (*SessionLease, error) {
+	holder, ok, err := platform.FetchLease(sCtx(), sessionLease(id))
+	if err != nil || !ok {
+		return nil, err
+	}
+	l := newSessionLease(id, holder)
+	return &l, nil
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/whisper-project/server.golang/platform"
+)
+
+func TestSessionLeaseInterfaceDefinition(t *testing.T) {
+	id := uuid.NewString()
+	platform.StorableInterfaceTester(t, sessionLease(id), "session-lease:", id)
+}
+
+func TestSessionLeaseOwnership(t *testing.T) {
+	id := uuid.NewString()
+	defer platform.DeleteStorage(sCtx(), sessionLease(id))
+	if l, err := GetSessionLease(id); err != nil || l != nil {
+		t.Fatalf("GetSessionLease() failed, got %v, %v, want nil", l, err)
+	}
+	l, ok, err := AcquireSessionLease(id, time.Minute)
+	if err != nil || !ok || !l.IsOwnedHere() {
+		t.Fatalf("AcquireSessionLease() failed, got %v, %v, %v, want owned here", l, ok, err)
+	}
+	// pretend to be another server instance
+	here := ServerId
+	ServerId = uuid.NewString()
+	other, ok, err := AcquireSessionLease(id, time.Minute)
+	ServerId = here
+	if err != nil || ok || other != l {
+		t.Errorf("AcquireSessionLease() elsewhere failed, got %v, %v, %v, want %v", other, ok, err, l)
+	}
+	if ok, err = RenewSessionLease(l, time.Minute); err != nil || !ok {
+		t.Errorf("RenewSessionLease() failed, got %v, %v, want true", ok, err)
+	}
+	if err = ReleaseSessionLease(l); err != nil {
+		t.Errorf("ReleaseSessionLease() failed: %v", err)
+	}
+	if ok, err = RenewSessionLease(l, time.Minute); err != nil || ok {
+		t.Errorf("RenewSessionLease() after release failed, got %v, %v, want false", ok, err)
+	}
+}
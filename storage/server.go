@@ -15,6 +15,7 @@ import (
 
 var (
 	ServerId      = uuid.NewString()
+	ServerUrl     string // where other server instances can reach this one
 	ServerLogger  *zap.Logger
 	ServerContext context.Context = context.Background()
 )
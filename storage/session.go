@@ -7,8 +7,15 @@
 package storage
 
 import (
+	"cmp"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/whisper-project/server.golang/protocol"
@@ -17,33 +24,6 @@ import (
 	"github.com/whisper-project/server.golang/platform"
 )
 
-var SuspendedSessionList = platform.StorableList("suspended-session-list")
-
-func SuspendSession(id string) error {
-	if err := platform.PushRange(context.Background(), SuspendedSessionList, true, id); err != nil {
-		return err
-	}
-	return nil
-}
-
-func RemoveSuspendedSession(id string) error {
-	if err := platform.RemoveElement(context.Background(), SuspendedSessionList, 1, id); err != nil {
-		return err
-	}
-	return nil
-}
-
-func WaitForSuspendedSession(timeout time.Duration) (string, error) {
-	id, err := platform.FetchOneBlocking(context.Background(), SuspendedSessionList, false, timeout)
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return "", nil
-		}
-		return "", err
-	}
-	return id, nil
-}
-
 type SessionState struct {
 	Id           string
 	Participants ParticipantMap
@@ -51,6 +31,14 @@ type SessionState struct {
 	PastText     []PastTextLine
 	StartedAt    int64
 	EndedAt      int64
+	Encrypted    bool   // content is end-to-end encrypted
+	ContentKey   []byte // the key for encrypted content, shared with participants
+	WrappedKey   []byte // the content key as stored, wrapped with the server's secret
+	// the transcript being recorded, if any, which starts
+	// at the given line of past text and time
+	TranscriptId   string
+	TranscriptFrom int
+	TranscriptAt   int64
 }
 
 func NewSessionState(id string) *SessionState {
@@ -61,6 +49,79 @@ func NewSessionState(id string) *SessionState {
 	}
 }
 
+// Clone returns a copy of the state that shares nothing with it,
+// so it can be saved while the session goes on changing.
+func (s *SessionState) Clone() *SessionState {
+	c := *s
+	if s.Participants != nil {
+		c.Participants = make(ParticipantMap, len(s.Participants))
+		for id, p := range s.Participants {
+			c.Participants[id] = p.clone()
+		}
+	}
+	c.Waitlist = slices.Clone(s.Waitlist)
+	for i, p := range c.Waitlist {
+		c.Waitlist[i] = p.clone()
+	}
+	c.PastText = slices.Clone(s.PastText)
+	c.ContentKey = slices.Clone(s.ContentKey)
+	return &c
+}
+
+// sealed returns the state as it should be stored. The content key is
+// shared only with participants, so the stored state has it wrapped with
+// the server's secret, rather than in the clear.
+func (s *SessionState) sealed() (*SessionState, error) {
+	if s.ContentKey == nil {
+		return s, nil
+	}
+	aead, err := contentKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	c := *s
+	c.ContentKey, c.WrappedKey = nil, aead.Seal(nonce, nonce, s.ContentKey, []byte(s.Id))
+	return &c, nil
+}
+
+// unseal unwraps the content key of a state that was stored.
+func (s *SessionState) unseal() error {
+	if s.WrappedKey == nil {
+		return nil
+	}
+	aead, err := contentKeyCipher()
+	if err != nil {
+		return err
+	}
+	if len(s.WrappedKey) < aead.NonceSize() {
+		return fmt.Errorf("wrapped content key of session %s is too short", s.Id)
+	}
+	nonce, wrapped := s.WrappedKey[:aead.NonceSize()], s.WrappedKey[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, wrapped, []byte(s.Id))
+	if err != nil {
+		return fmt.Errorf("can't unwrap content key of session %s: %v", s.Id, err)
+	}
+	s.ContentKey, s.WrappedKey = key, nil
+	return nil
+}
+
+func contentKeyCipher() (cipher.AEAD, error) {
+	secret := platform.GetConfig().ContentKeySecret
+	if secret == "" {
+		return nil, fmt.Errorf("no content key secret is configured")
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
 type ParticipantMap map[string]*Participant
 
 type Participant struct {
@@ -70,6 +131,12 @@ type Participant struct {
 	IsWhisperer bool   `json:"isWhisperer"`
 	IsOnline    bool   `json:"isOnline"`
 	JoinedAt    int64  `json:"joinedAt"`
+	// OffsetUnit is what the client counts content offsets in; empty means the default
+	OffsetUnit protocol.OffsetUnit `json:"offsetUnit,omitempty"`
+	// Version and Features are negotiated in the client's handshake;
+	// a zero version means the client never announced itself
+	Version  int      `json:"version,omitempty"`
+	Features []string `json:"features,omitempty"`
 }
 
 func NewParticipant(clientId, profileId, name string, isWhisperer bool) *Participant {
@@ -82,9 +149,19 @@ func NewParticipant(clientId, profileId, name string, isWhisperer bool) *Partici
 	}
 }
 
+func (p *Participant) clone() *Participant {
+	c := *p
+	c.Features = slices.Clone(p.Features)
+	return &c
+}
+
 type PastTextLine struct {
 	Time int64
 	Text string
+	// the whisperer who typed the line; lines from before
+	// sessions had co-whisperers have no author
+	AuthorId   string
+	AuthorName string
 }
 
 type suspendedSession string
@@ -98,7 +175,11 @@ func (s suspendedSession) StorageId() string {
 }
 
 func SuspendSessionState(s *SessionState) error {
-	if err := platform.StoreGob(context.Background(), suspendedSession(s.Id), s); err != nil {
+	sealed, err := s.sealed()
+	if err != nil {
+		return err
+	}
+	if err := platform.StoreGob(context.Background(), suspendedSession(s.Id), sealed); err != nil {
 		return err
 	}
 	return nil
@@ -114,9 +195,25 @@ func SuspendedSessionState(id string) (*SessionState, error) {
 	}
 	// once the state is picked up, it's maintained by the server, and so not accurate.
 	_ = platform.DeleteStorage(context.Background(), suspendedSession(id))
+	if err := state.unseal(); err != nil {
+		return nil, err
+	}
 	return &state, nil
 }
 
+// HasSuspendedSessionState checks whether a session's state is waiting
+// to be resumed, without picking it up.
+func HasSuspendedSessionState(id string) (bool, error) {
+	var state SessionState
+	if err := platform.FetchGob(context.Background(), suspendedSession(id), &state); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 type suspendedSessionPackets string
 
 func (s suspendedSessionPackets) StoragePrefix() string {
@@ -146,6 +243,8 @@ func SuspendSessionPackets(id string, packets ...protocol.ContentPacket) error {
 	if len(packets) == 0 {
 		return nil
 	}
+	// packets are stored as text, whatever the session's encoding,
+	// so any server version can resume the session
 	packetStrings := make([]string, len(packets))
 	for i, p := range packets {
 		packetStrings[i] = p.String()
@@ -160,27 +259,51 @@ func SuspendSessionPackets(id string, packets ...protocol.ContentPacket) error {
 type Transcript struct {
 	Id             string
 	ConversationId string
-	WhispererName  string
+	WhispererName  string   // the first of the whisperers
+	Whisperers     []string // everyone who whispered, in order of their first line
 	StartTime      int64
 	EndTime        int64
 	PastText       []PastTextLine
+	Recovered      bool // recovered from a draft, so lines at the end may be missing
 }
 
+// NewTranscript makes a transcript of the session's past text
+// from the time its transcript started being recorded.
 func NewTranscript(id string, state *SessionState) *Transcript {
-	whispererName := "Unknown Whisperer"
+	pastText := state.PastText[min(state.TranscriptFrom, len(state.PastText)):]
+	startTime := state.StartedAt
+	if state.TranscriptAt != 0 {
+		startTime = state.TranscriptAt
+	}
+	var whisperers []string
+	for _, line := range pastText {
+		if line.AuthorName != "" && !slices.Contains(whisperers, line.AuthorName) {
+			whisperers = append(whisperers, line.AuthorName)
+		}
+	}
+	// whisperers who didn't finish a line are listed in the order they joined
+	var silent []*Participant
 	for _, p := range state.Participants {
-		if p.IsWhisperer {
-			whispererName = p.Name
-			break
+		if p.IsWhisperer && !slices.Contains(whisperers, p.Name) {
+			silent = append(silent, p)
 		}
 	}
+	slices.SortFunc(silent, func(a, b *Participant) int { return cmp.Compare(a.JoinedAt, b.JoinedAt) })
+	for _, p := range silent {
+		whisperers = append(whisperers, p.Name)
+	}
+	whispererName := "Unknown Whisperer"
+	if len(whisperers) > 0 {
+		whispererName = whisperers[0]
+	}
 	return &Transcript{
 		Id:             id,
 		ConversationId: state.Id,
 		WhispererName:  whispererName,
-		StartTime:      state.StartedAt,
+		Whisperers:     whisperers,
+		StartTime:      startTime,
 		EndTime:        state.EndedAt,
-		PastText:       state.PastText,
+		PastText:       pastText,
 	}
 }
 
@@ -7,6 +7,8 @@
 package storage
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
 	"testing"
 	"time"
@@ -39,13 +41,73 @@ func sampleSessionState(id string) *SessionState {
 		s.Participants[c] = np
 	}
 	s.PastText = []PastTextLine{
-		{20000, "First line"},
-		{25000, "Second line"},
-		{30000, "Third line"},
+		{Time: 20000, Text: "First line", AuthorId: "client2", AuthorName: "name2"},
+		{Time: 25000, Text: "Second line", AuthorId: "client2", AuthorName: "name2"},
+		{Time: 30000, Text: "Third line", AuthorId: "client2", AuthorName: "name2"},
 	}
 	return s
 }
 
+func TestSessionStateClone(t *testing.T) {
+	state := sampleSessionState(uuid.NewString())
+	state.Participants["client0"].Features = []string{"binary"}
+	clone := state.Clone()
+	if diff := deep.Equal(clone, state); diff != nil {
+		t.Fatalf("Clone() failed: %v", diff)
+	}
+	clone.Participants["client0"].Features[0] = "changed"
+	clone.Participants["client1"].IsOnline = !state.Participants["client1"].IsOnline
+	clone.PastText[0].Text = "changed"
+	if state.Participants["client0"].Features[0] != "binary" ||
+		clone.Participants["client1"].IsOnline == state.Participants["client1"].IsOnline ||
+		state.PastText[0].Text == "changed" {
+		t.Errorf("Clone() shares data with the original")
+	}
+}
+
+func TestSessionStateSealing(t *testing.T) {
+	state := sampleSessionState(uuid.NewString())
+	key, _ := protocol.NewContentKey()
+	state.Encrypted, state.ContentKey = true, key
+	sealed, err := state.sealed()
+	if err != nil {
+		t.Fatalf("sealed() failed: %v", err)
+	}
+	var stored bytes.Buffer
+	if err := gob.NewEncoder(&stored).Encode(sealed); err != nil {
+		t.Fatalf("encoding of sealed state failed: %v", err)
+	}
+	if sealed.ContentKey != nil || bytes.Contains(stored.Bytes(), key) {
+		t.Errorf("sealed() failed, the content key is stored in the clear")
+	}
+	if state.ContentKey == nil || state.WrappedKey != nil {
+		t.Errorf("sealed() changed the original state")
+	}
+	var fetched SessionState
+	if err := gob.NewDecoder(&stored).Decode(&fetched); err != nil {
+		t.Fatalf("decoding of sealed state failed: %v", err)
+	}
+	moved := fetched
+	if err := fetched.unseal(); err != nil {
+		t.Fatalf("unseal() failed: %v", err)
+	}
+	if diff := deep.Equal(&fetched, state); diff != nil {
+		t.Errorf("unseal() failed: %v", diff)
+	}
+	// the wrapped key only works for its own session, and with the same secret
+	moved.Id = uuid.NewString()
+	if err := moved.unseal(); err == nil {
+		t.Errorf("unseal() of a key wrapped for another session succeeded")
+	}
+	env := platform.GetConfig()
+	env.ContentKeySecret = ""
+	platform.PushAlteredConfig(env)
+	defer platform.PopConfig()
+	if _, err := state.sealed(); err == nil {
+		t.Errorf("sealed() without a content key secret succeeded")
+	}
+}
+
 func TestSessionStateResumeSuspendResumeResume(t *testing.T) {
 	id := uuid.NewString()
 	s0, err := SuspendedSessionState(id)
@@ -74,11 +136,10 @@ func TestSuspendedSessionPacketsInterface(t *testing.T) {
 
 func TestSessionPacketsResumeSuspendResume(t *testing.T) {
 	id := uuid.NewString()
-	//goland:noinspection GoStructInitializationWithoutFieldNames
 	packets := []protocol.ContentPacket{
-		{"a", "a", "a"},
-		{"b", "b", "b"},
-		{"c", "c", "c"},
+		{PacketId: "a", ClientId: "a", Data: "a"},
+		{PacketId: "b", ClientId: "b", Data: "b"},
+		{PacketId: "c", ClientId: "c", Data: "c"},
 	}
 	if err := SuspendSessionPackets(id, packets...); err != nil {
 		t.Fatalf("store of new suspended packets failed: %v", err)
@@ -112,6 +173,10 @@ func TestNewTranscriptFetchStoreFetch(t *testing.T) {
 	if diff := deep.Equal(state.PastText, transcript.PastText); diff != nil {
 		t.Errorf("transcript mismatch: %v", diff)
 	}
+	state.TranscriptFrom, state.TranscriptAt = 1, 26000
+	if partial := NewTranscript(tId, state); len(partial.PastText) != 2 || partial.StartTime != 26000 {
+		t.Errorf("partial transcript has %d lines starting at %d", len(partial.PastText), partial.StartTime)
+	}
 	if err := StoreTranscript(transcript); err != nil {
 		t.Fatalf("store of new transcript failed: %v", err)
 	}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/whisper-project/server.golang/platform"
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+// Running sessions are snapshotted, so that if the server running them
+// dies without suspending them, another server can resume them. Each
+// server keeps a heartbeat while it's alive, and records which sessions
+// it has snapshotted.
+
+// A SessionSnapshot is the state of a running session at some point in time.
+type SessionSnapshot struct {
+	State       *SessionState
+	LivePackets []protocol.ContentPacket
+	Owner       string // the ServerId of the server running the session
+	TakenAt     int64
+}
+
+type sessionSnapshot string
+
+func (s sessionSnapshot) StoragePrefix() string {
+	return "session-snapshot:"
+}
+
+func (s sessionSnapshot) StorageId() string {
+	return string(s)
+}
+
+type serverSessions string
+
+func (s serverSessions) StoragePrefix() string {
+	return "server-sessions:"
+}
+
+func (s serverSessions) StorageId() string {
+	return string(s)
+}
+
+type serverHeartbeat string
+
+func (s serverHeartbeat) StoragePrefix() string {
+	return "server-heartbeat:"
+}
+
+func (s serverHeartbeat) StorageId() string {
+	return string(s)
+}
+
+type serverRecovery string
+
+func (s serverRecovery) StoragePrefix() string {
+	return "server-recovery:"
+}
+
+func (s serverRecovery) StorageId() string {
+	return string(s)
+}
+
+// KnownServers is the set of the IDs of servers that have snapshotted sessions.
+var KnownServers = platform.StorableSet("known-servers")
+
+// SaveSessionSnapshot saves a snapshot of a session running on this server.
+func SaveSessionSnapshot(state *SessionState, packets []protocol.ContentPacket) error {
+	sealed, err := state.sealed()
+	if err != nil {
+		return err
+	}
+	snapshot := SessionSnapshot{State: sealed, LivePackets: packets, Owner: ServerId, TakenAt: time.Now().UnixMilli()}
+	if err := platform.StoreGob(sCtx(), sessionSnapshot(state.Id), &snapshot); err != nil {
+		return err
+	}
+	return platform.AddMembers(sCtx(), serverSessions(ServerId), state.Id)
+}
+
+// GetSessionSnapshot returns the last snapshot of a session, if there is one.
+func GetSessionSnapshot(id string) (*SessionSnapshot, error) {
+	var snapshot SessionSnapshot
+	if err := platform.FetchGob(sCtx(), sessionSnapshot(id), &snapshot); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if snapshot.State != nil {
+		if err := snapshot.State.unseal(); err != nil {
+			return nil, err
+		}
+	}
+	return &snapshot, nil
+}
+
+// DeleteSessionSnapshot deletes the snapshot of a session that's no longer
+// running on this server, because it ended or was suspended.
+func DeleteSessionSnapshot(id string) error {
+	if err := platform.DeleteStorage(sCtx(), sessionSnapshot(id)); err != nil {
+		return err
+	}
+	return ForgetServerSession(ServerId, id)
+}
+
+// ForgetServerSession records that a session is no longer running on the
+// given server, without deleting its snapshot.
+func ForgetServerSession(serverId, id string) error {
+	return platform.RemoveMembers(sCtx(), serverSessions(serverId), id)
+}
+
+// ServerSessions returns the IDs of the sessions snapshotted by the given server.
+func ServerSessions(serverId string) ([]string, error) {
+	return platform.FetchMembers(sCtx(), serverSessions(serverId))
+}
+
+// A ServerHeartbeat shows that a server is alive for as long as it's renewed.
+type ServerHeartbeat = platform.LeaseHolder
+
+// StartServerHeartbeat shows that this server is alive for the given time.
+func StartServerHeartbeat(ttl time.Duration) (ServerHeartbeat, error) {
+	h, ok, err := platform.AcquireLease(sCtx(), serverHeartbeat(ServerId), ServerId, ServerUrl, ttl)
+	if err != nil {
+		return h, err
+	}
+	if !ok {
+		return h, fmt.Errorf("server %s already has a heartbeat", ServerId)
+	}
+	return h, platform.AddMembers(sCtx(), KnownServers, ServerId)
+}
+
+// RenewServerHeartbeat extends this server's heartbeat, and returns whether
+// it was still current.
+func RenewServerHeartbeat(h ServerHeartbeat, ttl time.Duration) (bool, error) {
+	return platform.RenewLease(sCtx(), serverHeartbeat(ServerId), h, ttl)
+}
+
+// IsServerAlive returns whether the given server's heartbeat is current.
+func IsServerAlive(serverId string) (bool, error) {
+	_, ok, err := platform.FetchLease(sCtx(), serverHeartbeat(serverId))
+	return ok, err
+}
+
+// ClaimServerRecovery makes this server responsible for resuming the sessions
+// of a dead server, for the given time, unless another server already is.
+func ClaimServerRecovery(serverId string, ttl time.Duration) (bool, error) {
+	_, ok, err := platform.AcquireLease(sCtx(), serverRecovery(serverId), ServerId, ServerUrl, ttl)
+	return ok, err
+}
+
+// KnownServerIds returns the IDs of all the servers that have snapshotted sessions.
+func KnownServerIds() ([]string, error) {
+	return platform.FetchMembers(sCtx(), KnownServers)
+}
+
+// ForgetServer removes a dead server, whose sessions have all been resumed.
+func ForgetServer(serverId string) error {
+	if err := platform.DeleteStorage(sCtx(), serverSessions(serverId)); err != nil {
+		return err
+	}
+	return platform.RemoveMembers(sCtx(), KnownServers, serverId)
+}
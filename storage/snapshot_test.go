@@ -0,0 +1,88 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+	"github.com/google/uuid"
+
+	"github.com/whisper-project/server.golang/protocol"
+)
+
+func TestSessionSnapshot(t *testing.T) {
+	id := uuid.NewString()
+	defer func() { _ = DeleteSessionSnapshot(id) }()
+	if snapshot, err := GetSessionSnapshot(id); err != nil || snapshot != nil {
+		t.Errorf("expected nil snapshot, got %v, %v", snapshot, err)
+	}
+	state := sampleSessionState(id)
+	packets := []protocol.ContentPacket{{PacketId: "p1", ClientId: "client2", Data: "0|live"}}
+	if err := SaveSessionSnapshot(state, packets); err != nil {
+		t.Fatalf("SaveSessionSnapshot() failed: %v", err)
+	}
+	snapshot, err := GetSessionSnapshot(id)
+	if err != nil || snapshot == nil {
+		t.Fatalf("GetSessionSnapshot() failed, got %v, %v", snapshot, err)
+	}
+	if snapshot.Owner != ServerId {
+		t.Errorf("snapshot owner is %q, want %q", snapshot.Owner, ServerId)
+	}
+	if diff := deep.Equal(snapshot.State, state); diff != nil {
+		t.Errorf("snapshot state mismatch: %v", diff)
+	}
+	if diff := deep.Equal(snapshot.LivePackets, packets); diff != nil {
+		t.Errorf("snapshot packets mismatch: %v", diff)
+	}
+	if ids, err := ServerSessions(ServerId); err != nil || !slices.Contains(ids, id) {
+		t.Errorf("ServerSessions() failed, got %v, %v, want it to contain %s", ids, err, id)
+	}
+	if err := DeleteSessionSnapshot(id); err != nil {
+		t.Fatalf("DeleteSessionSnapshot() failed: %v", err)
+	}
+	if ids, err := ServerSessions(ServerId); err != nil || slices.Contains(ids, id) {
+		t.Errorf("ServerSessions() after delete failed, got %v, %v", ids, err)
+	}
+}
+
+func TestServerHeartbeat(t *testing.T) {
+	saved := ServerId
+	ServerId = "test-server-" + uuid.NewString()
+	defer func() {
+		_ = ForgetServer(ServerId)
+		ServerId = saved
+	}()
+	if alive, err := IsServerAlive(ServerId); err != nil || alive {
+		t.Errorf("IsServerAlive() before heartbeat failed, got %v, %v", alive, err)
+	}
+	h, err := StartServerHeartbeat(time.Second)
+	if err != nil {
+		t.Fatalf("StartServerHeartbeat() failed: %v", err)
+	}
+	if ids, err := KnownServerIds(); err != nil || !slices.Contains(ids, ServerId) {
+		t.Errorf("KnownServerIds() failed, got %v, %v", ids, err)
+	}
+	if ok, err := RenewServerHeartbeat(h, time.Second); err != nil || !ok {
+		t.Errorf("RenewServerHeartbeat() failed, got %v, %v", ok, err)
+	}
+	if alive, err := IsServerAlive(ServerId); err != nil || !alive {
+		t.Errorf("IsServerAlive() during heartbeat failed, got %v, %v", alive, err)
+	}
+	if ok, err := ClaimServerRecovery(ServerId, time.Second); err != nil || !ok {
+		t.Errorf("ClaimServerRecovery() failed, got %v, %v", ok, err)
+	}
+	if ok, err := ClaimServerRecovery(ServerId, time.Second); err != nil || ok {
+		t.Errorf("second ClaimServerRecovery() failed, got %v, %v, want false", ok, err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if alive, err := IsServerAlive(ServerId); err != nil || alive {
+		t.Errorf("IsServerAlive() after heartbeat lapsed failed, got %v, %v", alive, err)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/whisper-project/server.golang/platform"
+)
+
+// A transcript that's being recorded is kept as a draft: the transcript
+// without its lines, and an append-only list of its lines as they are
+// committed. Corrections to a line are appended as well, and replace the
+// line when the draft is read back. When the transcript is finished, it
+// is stored and the draft is deleted. Drafts that are never finished,
+// because the server recording them crashed, can be recovered.
+
+type transcriptDraft string
+
+func (t transcriptDraft) StoragePrefix() string {
+	return "transcript-draft:"
+}
+
+func (t transcriptDraft) StorageId() string {
+	return string(t)
+}
+
+type transcriptLines string
+
+func (t transcriptLines) StoragePrefix() string {
+	return "transcript-lines:"
+}
+
+func (t transcriptLines) StorageId() string {
+	return string(t)
+}
+
+// TranscriptDrafts is the set of IDs of all the draft transcripts.
+var TranscriptDrafts = platform.StorableSet("transcript-drafts")
+
+// transcriptEntry is one line in a draft transcript. The index is
+// the line's position in the transcript.
+type transcriptEntry struct {
+	Index int          `json:"index"`
+	Line  PastTextLine `json:"line"`
+}
+
+// StartTranscriptDraft saves a new transcript as a draft.
+// Any lines it already has are ignored.
+func StartTranscriptDraft(t *Transcript) error {
+	header := *t
+	header.PastText = nil
+	if err := platform.StoreGob(sCtx(), transcriptDraft(t.Id), &header); err != nil {
+		sLog().Error("storage failure saving transcript draft",
+			zap.String("transcriptId", t.Id), zap.Error(err))
+		return err
+	}
+	if err := platform.AddMembers(sCtx(), TranscriptDrafts, t.Id); err != nil {
+		sLog().Error("storage failure adding transcript draft",
+			zap.String("transcriptId", t.Id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// CheckpointTranscriptLine appends a line to a draft transcript at the given index.
+// If there's already a line at that index, the new line replaces it.
+func CheckpointTranscriptLine(id string, index int, line PastTextLine) error {
+	entry, err := json.Marshal(transcriptEntry{Index: index, Line: line})
+	if err != nil {
+		return err
+	}
+	if err := platform.PushRange(sCtx(), transcriptLines(id), false, string(entry)); err != nil {
+		sLog().Error("storage failure checkpointing transcript line",
+			zap.String("transcriptId", id), zap.Int("index", index), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// TranscriptDraft returns a draft transcript with the lines checkpointed
+// so far, or nil if there's no such draft.
+func TranscriptDraft(id string) (*Transcript, error) {
+	var t Transcript
+	if err := platform.FetchGob(sCtx(), transcriptDraft(id), &t); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries, err := platform.FetchRange(sCtx(), transcriptLines(id), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		var entry transcriptEntry
+		if err := json.Unmarshal([]byte(e), &entry); err != nil {
+			sLog().Error("skipping invalid transcript line",
+				zap.String("transcriptId", id), zap.String("entry", e), zap.Error(err))
+			continue
+		}
+		if entry.Index < 0 || entry.Index > len(t.PastText) {
+			sLog().Error("skipping out of order transcript line",
+				zap.String("transcriptId", id), zap.Int("index", entry.Index), zap.Int("lines", len(t.PastText)))
+			continue
+		}
+		if entry.Index == len(t.PastText) {
+			t.PastText = append(t.PastText, entry.Line)
+		} else {
+			t.PastText[entry.Index] = entry.Line
+		}
+	}
+	// the whisperers known when the draft started may not have written anything
+	var whisperers []string
+	for _, line := range t.PastText {
+		if line.AuthorName != "" && !slices.Contains(whisperers, line.AuthorName) {
+			whisperers = append(whisperers, line.AuthorName)
+		}
+	}
+	for _, name := range t.Whisperers {
+		if !slices.Contains(whisperers, name) {
+			whisperers = append(whisperers, name)
+		}
+	}
+	if len(whisperers) > 0 {
+		t.Whisperers, t.WhispererName = whisperers, whisperers[0]
+	}
+	return &t, nil
+}
+
+// TranscriptDraftIds returns the IDs of all the draft transcripts.
+func TranscriptDraftIds() ([]string, error) {
+	return platform.FetchMembers(sCtx(), TranscriptDrafts)
+}
+
+// FinishTranscriptDraft stores a finished transcript, and deletes its draft.
+func FinishTranscriptDraft(t *Transcript) error {
+	if err := StoreTranscript(t); err != nil {
+		return err
+	}
+	return DeleteTranscriptDraft(t.Id)
+}
+
+// DeleteTranscriptDraft deletes a draft transcript.
+func DeleteTranscriptDraft(id string) error {
+	if err := platform.DeleteStorage(sCtx(), transcriptDraft(id)); err != nil {
+		return err
+	}
+	if err := platform.DeleteStorage(sCtx(), transcriptLines(id)); err != nil {
+		return err
+	}
+	return platform.RemoveMembers(sCtx(), TranscriptDrafts, id)
+}
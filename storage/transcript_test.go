@@ -0,0 +1,64 @@
+/*
+ * Copyright 2025 Daniel C. Brotsky. All rights reserved.
+ * All the copyrighted work in this repository is licensed under the
+ * GNU Affero General Public License v3, reproduced in the LICENSE file.
+ */
+
+package storage
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/google/uuid"
+)
+
+func TestTranscriptDraft(t *testing.T) {
+	tId := uuid.NewString()
+	defer func() { _ = DeleteTranscriptDraft(tId) }()
+	if draft, err := TranscriptDraft(tId); err != nil || draft != nil {
+		t.Errorf("expected nil draft, got %v, %v", draft, err)
+	}
+	state := sampleSessionState(uuid.NewString())
+	state.TranscriptFrom = len(state.PastText)
+	header := NewTranscript(tId, state)
+	if err := StartTranscriptDraft(header); err != nil {
+		t.Fatalf("StartTranscriptDraft() failed: %v", err)
+	}
+	lines := []PastTextLine{
+		{Time: 1, Text: "first", AuthorId: "client3", AuthorName: "name3"},
+		{Time: 2, Text: "secnod", AuthorId: "client2", AuthorName: "name2"},
+	}
+	for i, line := range lines {
+		if err := CheckpointTranscriptLine(tId, i, line); err != nil {
+			t.Fatalf("CheckpointTranscriptLine() failed: %v", err)
+		}
+	}
+	lines[1].Text = "second"
+	if err := CheckpointTranscriptLine(tId, 1, lines[1]); err != nil {
+		t.Fatalf("CheckpointTranscriptLine() of correction failed: %v", err)
+	}
+	if ids, err := TranscriptDraftIds(); err != nil || !slices.Contains(ids, tId) {
+		t.Errorf("TranscriptDraftIds() failed, got %v, %v, want it to contain %s", ids, err, tId)
+	}
+	draft, err := TranscriptDraft(tId)
+	if err != nil || draft == nil {
+		t.Fatalf("TranscriptDraft() failed, got %v, %v", draft, err)
+	}
+	if diff := deep.Equal(draft.PastText, lines); diff != nil {
+		t.Errorf("draft lines mismatch: %v", diff)
+	}
+	if draft.WhispererName != "name3" || draft.Whisperers[1] != "name2" {
+		t.Errorf("draft whisperers are %v (%q)", draft.Whisperers, draft.WhispererName)
+	}
+	if err := FinishTranscriptDraft(draft); err != nil {
+		t.Fatalf("FinishTranscriptDraft() failed: %v", err)
+	}
+	if stored, err := StoredTranscript(tId); err != nil || stored == nil || len(stored.PastText) != 2 {
+		t.Errorf("StoredTranscript() after finish failed, got %v, %v", stored, err)
+	}
+	if draft, err = TranscriptDraft(tId); err != nil || draft != nil {
+		t.Errorf("draft remained after finish: %v, %v", draft, err)
+	}
+}